@@ -1,2 +1,2 @@
-// Package mirror replicates the IPFIX packets with spoofing feature to 3rd party collector
+// Package mirror replicates the flow UDP packets with spoofing feature to 3rd party collectors
 package mirror
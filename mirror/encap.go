@@ -0,0 +1,106 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    encap.go
+//: details: exporter address encapsulation header
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package mirror
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+)
+
+// The encapsulation header is prepended to the packet in the udp mode
+// so the receiver could attribute the packet to the exporter:
+//
+//	 0                   1                   2                   3
+//	 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|         Magic (0x7666)        |    Version    | Family (4, 6) |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|         Exporter Port         |  Exporter Address (4 or 16)   ~
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+const (
+	// EncapMagic identifies the encapsulation header
+	EncapMagic = 0x7666
+
+	// EncapVersion is the encapsulation header version
+	EncapVersion = 1
+
+	// EncapHLen is the encapsulation header length without the address
+	EncapHLen = 6
+)
+
+var (
+	errShortEncapHeader   = errors.New("short encapsulation header")
+	errInvalidEncapHeader = errors.New("invalid encapsulation header")
+)
+
+// AppendEncap appends the encapsulation header of the exporter to b
+func AppendEncap(b []byte, src *net.UDPAddr) []byte {
+	var (
+		ip     = src.IP.To4()
+		family = byte(4)
+	)
+
+	if ip == nil {
+		ip = src.IP.To16()
+		family = 6
+	}
+
+	b = binary.BigEndian.AppendUint16(b, EncapMagic)
+	b = append(b, EncapVersion, family)
+	b = binary.BigEndian.AppendUint16(b, uint16(src.Port))
+
+	return append(b, ip...)
+}
+
+// DecodeEncap decodes the encapsulation header and returns
+// the exporter address and the original packet
+func DecodeEncap(b []byte) (*net.UDPAddr, []byte, error) {
+	var n int
+
+	if len(b) < EncapHLen {
+		return nil, nil, errShortEncapHeader
+	}
+
+	if binary.BigEndian.Uint16(b[0:]) != EncapMagic || b[2] != EncapVersion {
+		return nil, nil, errInvalidEncapHeader
+	}
+
+	switch b[3] {
+	case 4:
+		n = net.IPv4len
+	case 6:
+		n = net.IPv6len
+	default:
+		return nil, nil, errInvalidEncapHeader
+	}
+
+	if len(b) < EncapHLen+n {
+		return nil, nil, errShortEncapHeader
+	}
+
+	src := &net.UDPAddr{
+		IP:   append(net.IP{}, b[EncapHLen:EncapHLen+n]...),
+		Port: int(binary.BigEndian.Uint16(b[4:])),
+	}
+
+	return src, b[EncapHLen+n:], nil
+}
@@ -73,3 +73,15 @@ func (ip IPv4) SetAddrs(b []byte, src, dst net.IP) {
 	copy(b[12:16], src[12:16])
 	copy(b[16:20], dst[12:16])
 }
+
+// SetID sets the IPv4 identification
+func (ip IPv4) SetID(b []byte, id uint16) {
+	binary.BigEndian.PutUint16(b[4:], id)
+}
+
+// SetChecksum calculates and sets the IPv4 header checksum,
+// the other header fields should be set before
+func (ip IPv4) SetChecksum(b []byte) {
+	b[10], b[11] = 0, 0
+	binary.BigEndian.PutUint16(b[10:], ^fold(checksum(0, b[:IPv4HLen])))
+}
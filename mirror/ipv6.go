@@ -60,9 +60,9 @@ func (ip IPv6) Marshal() []byte {
 	return b
 }
 
-// SetLen sets IPv6 length
+// SetLen sets IPv6 payload length, it doesn't include the IPv6 header
 func (ip IPv6) SetLen(b []byte, n int) {
-	binary.BigEndian.PutUint16(b[4:], IPv6HLen+uint16(n))
+	binary.BigEndian.PutUint16(b[4:], uint16(n))
 }
 
 // SetAddrs sets IPv6 src and dst addresses
@@ -136,3 +136,76 @@ func TestSetLen(t *testing.T) {
 		t.Error("expect total len 35, got", h.TotalLen)
 	}
 }
+
+func TestIPv4Checksum(t *testing.T) {
+	ip := NewIPv4HeaderTpl(17)
+	b := ip.Marshal()
+	ip.SetAddrs(b, net.ParseIP("10.11.12.13"), net.ParseIP("192.17.11.1"))
+	ip.SetLen(b, 15)
+	ip.SetID(b, 0x1c46)
+	ip.SetChecksum(b)
+
+	h, err := ipv4.ParseHeader(b)
+	if err != nil {
+		t.Error("unexpected error", err)
+	}
+
+	if h.ID != 0x1c46 {
+		t.Error("expect ID 0x1c46, got", h.ID)
+	}
+
+	if h.Checksum == 0 || fold(checksum(0, b)) != 0xffff {
+		t.Errorf("invalid checksum 0x%x", h.Checksum)
+	}
+}
+
+func TestIPv6SetLen(t *testing.T) {
+	ip := NewIPv6HeaderTpl(17)
+	b := ip.Marshal()
+	ip.SetLen(b, 15)
+
+	h, err := ipv6.ParseHeader(b)
+	if err != nil {
+		t.Error("unexpected error", err)
+	}
+
+	if h.PayloadLen != 15 {
+		t.Error("expect payload len 15, got", h.PayloadLen)
+	}
+}
+
+func TestUDPChecksum(t *testing.T) {
+	var testCases = []struct {
+		src, dst string
+		length   int
+	}{
+		{"10.11.12.13", "192.17.11.1", 4},
+		{"2001:db8::1", "2001:db8::2", 16},
+	}
+
+	payload := []byte("hello")
+	for _, tc := range testCases {
+		src, dst := net.ParseIP(tc.src), net.ParseIP(tc.dst)
+
+		udp := UDP{DstPort: 4739}
+		b := udp.Marshal()
+		udp.SetSrcPort(b, 9995)
+		udp.SetLen(b, len(payload))
+		udp.SetChecksum(b, src, dst, payload)
+
+		if b[6] == 0 && b[7] == 0 {
+			t.Error("expect checksum, got zero")
+		}
+
+		// the sum with the checksum should be all ones
+		sum := checksum(0, src[len(src)-tc.length:])
+		sum = checksum(sum, dst[len(dst)-tc.length:])
+		sum += UDPProto + uint32(UDPHLen+len(payload))
+		sum = checksum(sum, b)
+		sum = checksum(sum, payload)
+
+		if fold(sum) != 0xffff {
+			t.Errorf("%s: invalid checksum 0x%x", tc.src, fold(sum))
+		}
+	}
+}
@@ -0,0 +1,45 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    rawconn_windows.go
+//: details: raw socket connection isn't supported on windows
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+//go:build windows
+// +build windows
+
+package mirror
+
+import (
+	"errors"
+	"net"
+)
+
+var errRawNotSupported = errors.New("raw socket is not supported")
+
+// NewRawConn constructs new raw socket
+func NewRawConn(raddr net.IP) (Conn, error) {
+	return Conn{}, errRawNotSupported
+}
+
+// Send tries to put the bytes to wire
+func (c *Conn) Send(b []byte) error {
+	return errRawNotSupported
+}
+
+// Close releases file descriptor
+func (c *Conn) Close(b []byte) error {
+	return nil
+}
@@ -0,0 +1,431 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    replicator.go
+//: details: replicates UDP packets to multiple destinations
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package mirror
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// FanOutAll replicates a packet to all the allowed destinations
+	FanOutAll = "all"
+
+	// FanOutHash sends a packet to one of the allowed destinations
+	// by hashing the exporter address, an exporter always lands on
+	// the same destination while the destinations don't change
+	FanOutHash = "hash"
+
+	defaultQueueSize = 1000
+	defaultBufSize   = 1500
+	defaultTTL       = 64
+
+	// maxPayload is the maximum UDP payload as the UDP
+	// length and the IPv4 total length are 16 bits
+	maxPayload = 0xffff - IPv4HLen - UDPHLen
+)
+
+// Destination represents a replicator destination
+type Destination struct {
+	// Addr is the destination IP address
+	Addr string `yaml:"addr"`
+
+	// Port is the destination UDP port
+	Port int `yaml:"port"`
+
+	// Exporters is the allowed exporters CIDR list, all the
+	// exporters are allowed if it's empty
+	Exporters []string `yaml:"exporters"`
+
+	// Sample replicates one out of every sample packets,
+	// zero or one replicates all the packets
+	Sample int `yaml:"sample"`
+
+	// Mode is raw or udp, the default is raw
+	Mode string `yaml:"mode"`
+
+	// Encap prepends the encapsulation header in the udp mode
+	Encap bool `yaml:"encap"`
+
+	// TTL is the IPv4 TTL or IPv6 hop limit in the raw mode, the default is 64
+	TTL int `yaml:"ttl"`
+}
+
+// Config represents the replicator configuration
+type Config struct {
+	// FanOut is all or hash, the default is all
+	FanOut string `yaml:"fan-out"`
+
+	// Workers is the number of senders per destination
+	Workers int `yaml:"workers"`
+
+	// QueueSize is the number of packets which can be queued per destination
+	QueueSize int `yaml:"queue-size"`
+
+	Destinations []Destination `yaml:"destinations"`
+}
+
+// Stats represents a destination counters, the unmirrorable packets
+// are the packets which can't be built for the destination like the
+// IPv6 exporter packets to IPv4 destination in the raw mode
+type Stats struct {
+	Destination  string
+	Sent         uint64
+	Dropped      uint64
+	Unmirrorable uint64
+}
+
+// Replicator replicates the UDP packets to the destinations, the exporter
+// address is the source address in the raw mode or it's carried by the
+// encapsulation header in the udp mode.
+type Replicator struct {
+	fanOut  string
+	workers int
+	dsts    []*destination
+	pool    sync.Pool
+	wg      sync.WaitGroup
+}
+
+type destination struct {
+	addr      net.IP
+	port      int
+	ipv4      bool
+	mode      string
+	encap     bool
+	ttl       int
+	maxLen    int
+	exporters []*net.IPNet
+	sample    uint64
+	ch        chan datagram
+
+	ipID         uint32 // IPv4 identification of the raw senders
+	count        uint64
+	sent         uint64
+	dropped      uint64
+	unmirrorable uint64
+}
+
+type datagram struct {
+	src  *net.UDPAddr
+	body []byte
+}
+
+var (
+	errUnknownFanOut = errors.New("unknown fan-out mode")
+	errNoDestination = errors.New("no destination")
+	errInvalidPort   = errors.New("invalid destination port")
+	errUnknownMode   = errors.New("unknown mirror mode")
+	errEncapRawMode  = errors.New("encapsulation needs udp mode")
+	errInvalidTTL    = errors.New("invalid ttl")
+)
+
+// NewReplicator validates the configuration, opens the
+// destinations connections and starts the senders
+func NewReplicator(cfg Config) (*Replicator, error) {
+	r, err := newReplicator(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	senders := make([][]sender, len(r.dsts))
+	for i, d := range r.dsts {
+		for w := 0; w < r.workers; w++ {
+			s, err := newSender(d)
+			if err != nil {
+				closeSenders(senders)
+				return nil, err
+			}
+
+			senders[i] = append(senders[i], s)
+		}
+	}
+
+	for i, d := range r.dsts {
+		for _, s := range senders[i] {
+			r.wg.Add(1)
+			go r.sender(d, s)
+		}
+	}
+
+	return r, nil
+}
+
+func newReplicator(cfg Config) (*Replicator, error) {
+	r := &Replicator{
+		fanOut:  cfg.FanOut,
+		workers: cfg.Workers,
+	}
+
+	switch r.fanOut {
+	case "":
+		r.fanOut = FanOutAll
+	case FanOutAll, FanOutHash:
+	default:
+		return nil, errUnknownFanOut
+	}
+
+	if len(cfg.Destinations) == 0 {
+		return nil, errNoDestination
+	}
+
+	if r.workers < 1 {
+		r.workers = 1
+	}
+
+	queueSize := cfg.QueueSize
+	if queueSize < 1 {
+		queueSize = defaultQueueSize
+	}
+
+	for _, dst := range cfg.Destinations {
+		d := &destination{
+			addr:  net.ParseIP(dst.Addr),
+			port:  dst.Port,
+			mode:  dst.Mode,
+			encap: dst.Encap,
+			ttl:   dst.TTL,
+			ch:    make(chan datagram, queueSize),
+		}
+
+		if d.addr == nil {
+			return nil, &net.ParseError{Type: "IP address", Text: dst.Addr}
+		}
+
+		if d.port < 1 || d.port > 65535 {
+			return nil, errInvalidPort
+		}
+
+		switch d.mode {
+		case "":
+			d.mode = ModeRaw
+		case ModeRaw, ModeUDP:
+		default:
+			return nil, errUnknownMode
+		}
+
+		if d.encap && d.mode != ModeUDP {
+			return nil, errEncapRawMode
+		}
+
+		switch {
+		case d.ttl == 0:
+			d.ttl = defaultTTL
+		case d.ttl < 0 || d.ttl > 255:
+			return nil, errInvalidTTL
+		}
+
+		d.ipv4 = d.addr.To4() != nil
+
+		d.maxLen = maxPayload
+		if d.encap {
+			d.maxLen -= EncapHLen + net.IPv6len
+		}
+
+		for _, cidr := range dst.Exporters {
+			_, ipNet, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return nil, err
+			}
+
+			d.exporters = append(d.exporters, ipNet)
+		}
+
+		if dst.Sample > 1 {
+			d.sample = uint64(dst.Sample)
+		}
+
+		r.dsts = append(r.dsts, d)
+	}
+
+	r.pool.New = func() interface{} {
+		return make([]byte, 0, defaultBufSize)
+	}
+
+	return r, nil
+}
+
+// Replicate queues the packet for the destinations that the exporter
+// is allowed, the packet is copied so the caller can reuse it.
+func (r *Replicator) Replicate(src *net.UDPAddr, b []byte) {
+	if r.fanOut == FanOutHash {
+		if d := r.pick(src); d != nil {
+			r.queue(d, src, b)
+		}
+		return
+	}
+
+	for _, d := range r.dsts {
+		if d.allow(src) {
+			r.queue(d, src, b)
+		}
+	}
+}
+
+// Stats returns the destinations counters
+func (r *Replicator) Stats() []Stats {
+	stats := make([]Stats, 0, len(r.dsts))
+	for _, d := range r.dsts {
+		stats = append(stats, Stats{
+			Destination:  net.JoinHostPort(d.addr.String(), strconv.Itoa(d.port)),
+			Sent:         atomic.LoadUint64(&d.sent),
+			Dropped:      atomic.LoadUint64(&d.dropped),
+			Unmirrorable: atomic.LoadUint64(&d.unmirrorable),
+		})
+	}
+
+	return stats
+}
+
+// Close stops the senders once the queued packets are sent,
+// Replicate shouldn't be called after Close
+func (r *Replicator) Close() {
+	for _, d := range r.dsts {
+		close(d.ch)
+	}
+
+	r.wg.Wait()
+}
+
+// pick chooses one of the allowed destinations by the exporter address hash
+func (r *Replicator) pick(src *net.UDPAddr) *destination {
+	var n uint32
+
+	for _, d := range r.dsts {
+		if d.allow(src) {
+			n++
+		}
+	}
+
+	if n == 0 {
+		return nil
+	}
+
+	i := hashIP(src.IP) % n
+	for _, d := range r.dsts {
+		if !d.allow(src) {
+			continue
+		}
+
+		if i == 0 {
+			return d
+		}
+		i--
+	}
+
+	return nil
+}
+
+func (r *Replicator) queue(d *destination, src *net.UDPAddr, b []byte) {
+	if d.sample > 1 && atomic.AddUint64(&d.count, 1)%d.sample != 0 {
+		return
+	}
+
+	if !d.mirrorable(src, b) {
+		atomic.AddUint64(&d.unmirrorable, 1)
+		return
+	}
+
+	body := r.pool.Get().([]byte)
+	body = append(body[:0], b...)
+
+	select {
+	case d.ch <- datagram{src: src, body: body}:
+	default:
+		atomic.AddUint64(&d.dropped, 1)
+		r.pool.Put(body)
+	}
+}
+
+func (r *Replicator) sender(d *destination, s sender) {
+	defer r.wg.Done()
+	defer s.close()
+
+	for msg := range d.ch {
+		err := s.send(msg.src, msg.body)
+		r.pool.Put(msg.body)
+
+		if err != nil {
+			atomic.AddUint64(&d.dropped, 1)
+			continue
+		}
+
+		atomic.AddUint64(&d.sent, 1)
+	}
+}
+
+// allow returns true if the exporter is allowed to the destination
+func (d *destination) allow(src *net.UDPAddr) bool {
+	if len(d.exporters) == 0 {
+		return true
+	}
+
+	for _, ipNet := range d.exporters {
+		if ipNet.Contains(src.IP) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// mirrorable returns true if the packet can be built for the destination,
+// the exporter address is the source address in the raw mode so the
+// exporter and the destination address families should be the same:
+//
+//	exporter  destination  raw           udp
+//	IPv4      IPv4         mirrored      mirrored
+//	IPv6      IPv6         mirrored      mirrored
+//	IPv4      IPv6         unmirrorable  mirrored
+//	IPv6      IPv4         unmirrorable  mirrored
+func (d *destination) mirrorable(src *net.UDPAddr, b []byte) bool {
+	if src == nil || len(src.IP) == 0 || len(b) > d.maxLen {
+		return false
+	}
+
+	if d.mode == ModeRaw && (src.IP.To4() != nil) != d.ipv4 {
+		return false
+	}
+
+	return true
+}
+
+func closeSenders(senders [][]sender) {
+	for _, ss := range senders {
+		for _, s := range ss {
+			s.close()
+		}
+	}
+}
+
+// hashIP returns FNV-1a hash of the address, the IPv4 address
+// is hashed in the IPv6 form to have the same hash for both forms
+func hashIP(ip net.IP) uint32 {
+	h := uint32(2166136261)
+	for _, b := range ip.To16() {
+		h ^= uint32(b)
+		h *= 16777619
+	}
+
+	return h
+}
@@ -0,0 +1,334 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    replicator_test.go
+//: details: TODO
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package mirror
+
+import (
+	"net"
+	"testing"
+)
+
+func queued(r *Replicator) []int {
+	n := make([]int, len(r.dsts))
+	for i, d := range r.dsts {
+		n[i] = len(d.ch)
+	}
+
+	return n
+}
+
+func TestReplicatorConfig(t *testing.T) {
+	var testCases = []struct {
+		name string
+		cfg  Config
+	}{
+		{"no destination", Config{}},
+		{"fan-out", Config{FanOut: "random", Destinations: []Destination{{Addr: "192.0.2.1", Port: 4739}}}},
+		{"address", Config{Destinations: []Destination{{Addr: "collector", Port: 4739}}}},
+		{"port", Config{Destinations: []Destination{{Addr: "192.0.2.1"}}}},
+		{"exporters", Config{Destinations: []Destination{{Addr: "192.0.2.1", Port: 4739, Exporters: []string{"10.0.0.0"}}}}},
+		{"mode", Config{Destinations: []Destination{{Addr: "192.0.2.1", Port: 4739, Mode: "tcp"}}}},
+		{"encap", Config{Destinations: []Destination{{Addr: "192.0.2.1", Port: 4739, Encap: true}}}},
+		{"ttl", Config{Destinations: []Destination{{Addr: "192.0.2.1", Port: 4739, TTL: 256}}}},
+	}
+
+	for _, tc := range testCases {
+		if _, err := newReplicator(tc.cfg); err == nil {
+			t.Errorf("%s: expect error, got nil", tc.name)
+		}
+	}
+
+	r, err := newReplicator(Config{Destinations: []Destination{{Addr: "192.0.2.1", Port: 4739}}})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if r.fanOut != FanOutAll {
+		t.Error("expect default fan-out all, got", r.fanOut)
+	}
+}
+
+func TestReplicatorFanOutAll(t *testing.T) {
+	r, err := newReplicator(Config{
+		Destinations: []Destination{
+			{Addr: "192.0.2.1", Port: 4739},
+			{Addr: "192.0.2.2", Port: 4739, Exporters: []string{"10.1.0.0/16"}},
+			{Addr: "192.0.2.3", Port: 4739, Exporters: []string{"10.2.0.0/16", "10.3.0.0/16"}},
+		},
+	})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	body := []byte("hello")
+	r.Replicate(&net.UDPAddr{IP: net.ParseIP("10.1.1.1"), Port: 2055}, body)
+	r.Replicate(&net.UDPAddr{IP: net.ParseIP("10.3.1.1"), Port: 2055}, body)
+	r.Replicate(&net.UDPAddr{IP: net.ParseIP("10.4.1.1"), Port: 2055}, body)
+
+	expected := []int{3, 1, 1}
+	for i, n := range queued(r) {
+		if n != expected[i] {
+			t.Errorf("destination %d expect %d packets, got %d", i, expected[i], n)
+		}
+	}
+
+	// the packet should be copied
+	body[0] = 'j'
+	msg := <-r.dsts[0].ch
+	if string(msg.body) != "hello" {
+		t.Error("expect hello, got", string(msg.body))
+	}
+
+	if msg.src.IP.String() != "10.1.1.1" {
+		t.Error("expect source 10.1.1.1, got", msg.src.IP.String())
+	}
+}
+
+func TestReplicatorFanOutHash(t *testing.T) {
+	r, err := newReplicator(Config{
+		FanOut: FanOutHash,
+		Destinations: []Destination{
+			{Addr: "192.0.2.1", Port: 4739},
+			{Addr: "192.0.2.2", Port: 4739},
+			{Addr: "192.0.2.3", Port: 4739, Exporters: []string{"172.16.0.0/12"}},
+		},
+	})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	for i := 0; i < 100; i++ {
+		r.Replicate(&net.UDPAddr{IP: net.IPv4(10, 0, 0, byte(i)), Port: 2055}, []byte("hello"))
+	}
+
+	n := queued(r)
+	if n[0]+n[1] != 100 {
+		t.Error("expect 100 packets, got", n[0]+n[1])
+	}
+
+	if n[0] == 0 || n[1] == 0 {
+		t.Error("expect packets on both destinations, got", n)
+	}
+
+	if n[2] != 0 {
+		t.Error("expect no packet on the filtered destination, got", n[2])
+	}
+
+	// an exporter should land on the same destination
+	for _, d := range r.dsts {
+		for len(d.ch) > 0 {
+			<-d.ch
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		r.Replicate(&net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 2055}, []byte("hello"))
+	}
+
+	n = queued(r)
+	if n[0] != 10 && n[1] != 10 {
+		t.Error("expect all the packets on one destination, got", n)
+	}
+}
+
+func TestReplicatorSample(t *testing.T) {
+	r, err := newReplicator(Config{
+		Destinations: []Destination{
+			{Addr: "192.0.2.1", Port: 4739, Sample: 5},
+			{Addr: "192.0.2.2", Port: 4739, Sample: 1},
+		},
+	})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	for i := 0; i < 20; i++ {
+		r.Replicate(&net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 2055}, []byte("hello"))
+	}
+
+	n := queued(r)
+	if n[0] != 4 {
+		t.Error("expect 4 sampled packets, got", n[0])
+	}
+
+	if n[1] != 20 {
+		t.Error("expect 20 packets, got", n[1])
+	}
+}
+
+func TestReplicatorDrop(t *testing.T) {
+	r, err := newReplicator(Config{
+		QueueSize: 2,
+		Destinations: []Destination{
+			{Addr: "192.0.2.1", Port: 4739},
+			{Addr: "2001:db8::1", Port: 4739},
+			{Addr: "2001:db8::1", Port: 4739, Mode: ModeUDP},
+		},
+	})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		r.Replicate(&net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 2055}, []byte("hello"))
+	}
+
+	stats := r.Stats()
+	if stats[0].Destination != "192.0.2.1:4739" {
+		t.Error("expect destination 192.0.2.1:4739, got", stats[0].Destination)
+	}
+
+	if stats[0].Dropped != 3 {
+		t.Error("expect 3 dropped packets, got", stats[0].Dropped)
+	}
+
+	// IPv4 exporter can't be mirrored to IPv6 destination
+	if stats[1].Unmirrorable != 5 || stats[1].Dropped != 0 {
+		t.Error("expect 5 unmirrorable packets, got", stats[1].Unmirrorable, stats[1].Dropped)
+	}
+
+	// the udp mode doesn't depend on the address family
+	if stats[2].Dropped != 3 {
+		t.Error("expect 3 dropped packets, got", stats[2].Dropped)
+	}
+}
+
+func TestReplicatorUDP(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer conn.Close()
+
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+
+	r, err := NewReplicator(Config{
+		Destinations: []Destination{
+			{Addr: "127.0.0.1", Port: port, Mode: ModeUDP},
+			{Addr: "127.0.0.1", Port: port, Mode: ModeUDP, Encap: true},
+		},
+	})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	r.Replicate(&net.UDPAddr{IP: net.ParseIP("2001:db8::10"), Port: 2055}, []byte("hello"))
+	r.Close()
+
+	var plain, encap int
+	b := make([]byte, 1500)
+	for i := 0; i < 2; i++ {
+		n, _, err := conn.ReadFrom(b)
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+
+		if string(b[:n]) == "hello" {
+			plain++
+			continue
+		}
+
+		src, body, err := DecodeEncap(b[:n])
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+
+		if src.String() != "[2001:db8::10]:2055" {
+			t.Error("expect exporter [2001:db8::10]:2055, got", src.String())
+		}
+
+		if string(body) != "hello" {
+			t.Error("expect hello, got", string(body))
+		}
+		encap++
+	}
+
+	if plain != 1 || encap != 1 {
+		t.Errorf("expect one plain and one encapsulated packet, got %d, %d", plain, encap)
+	}
+
+	for _, s := range r.Stats() {
+		if s.Sent != 1 {
+			t.Error("expect 1 sent packet, got", s.Sent)
+		}
+	}
+}
+
+func TestEncap(t *testing.T) {
+	for _, src := range []string{"192.0.2.1:9995", "[2001:db8::1]:4739"} {
+		addr, err := net.ResolveUDPAddr("udp", src)
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+
+		b := AppendEncap(nil, addr)
+		b = append(b, "hello"...)
+
+		exporter, body, err := DecodeEncap(b)
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+
+		if exporter.String() != src {
+			t.Errorf("expect exporter %s, got %s", src, exporter)
+		}
+
+		if string(body) != "hello" {
+			t.Error("expect hello, got", string(body))
+		}
+	}
+
+	if _, _, err := DecodeEncap([]byte{0x76, 0x66, 1, 4, 0, 1, 10}); err == nil {
+		t.Error("expect short header error, got nil")
+	}
+
+	if _, _, err := DecodeEncap([]byte{0x76, 0x67, 1, 4, 0, 1, 10, 0, 0, 1}); err == nil {
+		t.Error("expect invalid header error, got nil")
+	}
+}
+
+func TestReplicatorUnmirrorable(t *testing.T) {
+	r, err := newReplicator(Config{
+		Destinations: []Destination{
+			{Addr: "192.0.2.1", Port: 4739},
+			{Addr: "2001:db8::1", Port: 4739},
+			{Addr: "192.0.2.1", Port: 4739, Mode: ModeUDP},
+		},
+	})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	r.Replicate(&net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 2055}, []byte("hello"))
+	r.Replicate(&net.UDPAddr{IP: net.ParseIP("2001:db8::10"), Port: 2055}, []byte("hello"))
+	r.Replicate(&net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 2055}, make([]byte, 0x10000))
+	r.Replicate(nil, []byte("hello"))
+
+	expected := []int{1, 1, 2}
+	for i, s := range r.Stats() {
+		if s.Unmirrorable != uint64(4-expected[i]) {
+			t.Errorf("destination %d expect %d unmirrorable packets, got %d", i, 4-expected[i], s.Unmirrorable)
+		}
+
+		if len(r.dsts[i].ch) != expected[i] {
+			t.Errorf("destination %d expect %d packets, got %d", i, expected[i], len(r.dsts[i].ch))
+		}
+	}
+}
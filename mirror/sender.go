@@ -0,0 +1,158 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    sender.go
+//: details: raw and UDP senders
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package mirror
+
+import (
+	"net"
+	"sync/atomic"
+)
+
+const (
+	// ModeRaw sends the packets through the raw socket with the exporter
+	// address as the source address, it needs the CAP_NET_RAW capability
+	ModeRaw = "raw"
+
+	// ModeUDP sends the packets through the UDP socket, the exporter
+	// is known by the encapsulation header or the packet exporter ID
+	ModeUDP = "udp"
+)
+
+// sender sends the packets to a destination, each destination
+// worker has its own sender as it reuses the packet buffer
+type sender interface {
+	send(src *net.UDPAddr, b []byte) error
+	close() error
+}
+
+type rawSender struct {
+	conn   Conn
+	dst    net.IP
+	ipv4   bool
+	ipID   *uint32
+	ip     IP
+	v4     IPv4
+	ipHdr  []byte
+	udp    UDP
+	udpHdr []byte
+	packet []byte
+}
+
+type udpSender struct {
+	conn   *net.UDPConn
+	encap  bool
+	packet []byte
+}
+
+func newSender(d *destination) (sender, error) {
+	if d.mode == ModeUDP {
+		return newUDPSender(d.addr, d.port, d.encap)
+	}
+
+	return newRawSender(d.addr, d.port, d.ttl, &d.ipID)
+}
+
+// newRawSender constructs the raw sender, the IPv4 identification
+// is shared by the destination senders so it doesn't repeat soon
+func newRawSender(dst net.IP, port, ttl int, ipID *uint32) (*rawSender, error) {
+	conn, err := NewRawConn(dst)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &rawSender{
+		conn: conn,
+		dst:  dst.To16(),
+		ipv4: dst.To4() != nil,
+		ipID: ipID,
+		udp:  UDP{SrcPort: 0, DstPort: port, Length: 0, Checksum: 0},
+	}
+
+	if s.ipv4 {
+		s.v4 = NewIPv4HeaderTpl(UDPProto)
+		s.v4.TTL = uint8(ttl)
+		s.ip = s.v4
+	} else {
+		ip := NewIPv6HeaderTpl(UDPProto)
+		ip.HopLimit = uint8(ttl)
+		s.ip = ip
+	}
+
+	s.ipHdr = s.ip.Marshal()
+	s.udpHdr = s.udp.Marshal()
+
+	return s, nil
+}
+
+// send builds the packet with the exporter address and port as the source,
+// the replicator makes sure that the address families are the same
+func (s *rawSender) send(src *net.UDPAddr, b []byte) error {
+	var (
+		pLen  = len(b)
+		srcIP = src.IP.To16()
+	)
+
+	s.ip.SetAddrs(s.ipHdr, srcIP, s.dst)
+	s.ip.SetLen(s.ipHdr, pLen+UDPHLen)
+
+	if s.ipv4 {
+		s.v4.SetID(s.ipHdr, uint16(atomic.AddUint32(s.ipID, 1)))
+		s.v4.SetChecksum(s.ipHdr)
+	}
+
+	s.udp.SetSrcPort(s.udpHdr, src.Port)
+	s.udp.SetLen(s.udpHdr, pLen)
+	s.udp.SetChecksum(s.udpHdr, srcIP, s.dst, b)
+
+	s.packet = append(s.packet[:0], s.ipHdr...)
+	s.packet = append(s.packet, s.udpHdr...)
+	s.packet = append(s.packet, b...)
+
+	return s.conn.Send(s.packet)
+}
+
+func (s *rawSender) close() error {
+	return s.conn.Close(nil)
+}
+
+func newUDPSender(dst net.IP, port int, encap bool) (*udpSender, error) {
+	conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: dst, Port: port})
+	if err != nil {
+		return nil, err
+	}
+
+	return &udpSender{conn: conn, encap: encap}, nil
+}
+
+func (s *udpSender) send(src *net.UDPAddr, b []byte) error {
+	if s.encap {
+		s.packet = AppendEncap(s.packet[:0], src)
+		s.packet = append(s.packet, b...)
+		b = s.packet
+	}
+
+	_, err := s.conn.Write(b)
+
+	return err
+}
+
+func (s *udpSender) close() error {
+	return s.conn.Close()
+}
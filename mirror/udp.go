@@ -22,7 +22,10 @@
 
 package mirror
 
-import "encoding/binary"
+import (
+	"encoding/binary"
+	"net"
+)
 
 // UDP represents UDP header
 type UDP struct {
@@ -49,7 +52,55 @@ func (u *UDP) SetLen(b []byte, n int) {
 	binary.BigEndian.PutUint16(b[4:], uint16(UDPHLen+n))
 }
 
-// SetChecksum calculates and sets IPv6 checksum
-func (u *UDP) SetChecksum() {
-	// TODO
+// SetSrcPort sets the source port
+func (u *UDP) SetSrcPort(b []byte, port int) {
+	binary.BigEndian.PutUint16(b[0:], uint16(port))
+}
+
+// SetChecksum calculates and sets the checksum over the IPv4/IPv6
+// pseudo header, the UDP header and the payload, the length and
+// the ports should be set before. It's mandatory for IPv6.
+func (u *UDP) SetChecksum(b []byte, src, dst net.IP, payload []byte) {
+	if src4 := src.To4(); src4 != nil {
+		src, dst = src4, dst.To4()
+	}
+
+	b[6], b[7] = 0, 0
+
+	sum := checksum(0, src)
+	sum = checksum(sum, dst)
+	sum += UDPProto + uint32(binary.BigEndian.Uint16(b[4:]))
+	sum = checksum(sum, b[:UDPHLen])
+	sum = checksum(sum, payload)
+
+	// the zero checksum means no checksum
+	csum := ^fold(sum)
+	if csum == 0 {
+		csum = 0xffff
+	}
+
+	binary.BigEndian.PutUint16(b[6:], csum)
+}
+
+// checksum adds the 16-bit words to the one's complement sum
+func checksum(sum uint32, b []byte) uint32 {
+	n := len(b) &^ 1
+	for i := 0; i < n; i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+
+	if len(b) > n {
+		sum += uint32(b[n]) << 8
+	}
+
+	return sum
+}
+
+// fold folds the sum to 16 bits
+func fold(sum uint32) uint16 {
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+
+	return uint16(sum)
 }
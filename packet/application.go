@@ -0,0 +1,329 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    application.go
+//: details: decodes DNS, TLS client hello and HTTP request from payload
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package packet
+
+import "bytes"
+
+// DNS represents the DNS message header and the first question
+type DNS struct {
+	ID       int    // query identifier
+	Response bool   // query (false) or response (true)
+	Opcode   int    // kind of query
+	RCode    int    // response code
+	QName    string // question domain name
+	QType    int    // question type
+}
+
+// TLS represents the TLS client hello
+type TLS struct {
+	Version int      // client version
+	SNI     string   `json:",omitempty"` // server name indication
+	ALPN    []string `json:",omitempty"` // application layer protocols
+}
+
+// HTTP represents the HTTP request line and the host header
+type HTTP struct {
+	Method string
+	Host   string `json:",omitempty"`
+	Path   string
+}
+
+const (
+	// PortDNS is IANA DNS port number
+	PortDNS = 53
+
+	// DNSHLen is DNS header length size
+	DNSHLen = 12
+
+	tlsContentHandshake = 0x16
+	tlsClientHello      = 0x01
+	tlsExtServerName    = 0
+	tlsExtALPN          = 16
+
+	// maxDNSNameLen is maximum length of domain name
+	maxDNSNameLen = 255
+)
+
+var httpMethods = [][]byte{
+	[]byte("GET "),
+	[]byte("POST "),
+	[]byte("PUT "),
+	[]byte("HEAD "),
+	[]byte("DELETE "),
+	[]byte("OPTIONS "),
+	[]byte("PATCH "),
+	[]byte("CONNECT "),
+}
+
+// decodeApplication decodes the known application layer protocols
+// from the transport payload, the sampled payload is usually truncated
+// so it keeps the fields which are available and doesn't return error.
+// The names and the request fields are copied to strings, they're the
+// only allocations of a reused packet decoding.
+func (p *Packet) decodeApplication() {
+	var (
+		srcPort, dstPort int
+		tcp              bool
+	)
+
+	switch h := p.L4.(type) {
+	case *TCPHeader:
+		srcPort, dstPort, tcp = h.SrcPort, h.DstPort, true
+	case *UDPHeader:
+		srcPort, dstPort = h.SrcPort, h.DstPort
+	default:
+		return
+	}
+
+	b := p.data
+	if len(b) == 0 {
+		return
+	}
+
+	if srcPort == PortDNS || dstPort == PortDNS {
+		// DNS over TCP has two bytes message length
+		if tcp {
+			if len(b) < 2 {
+				return
+			}
+			b = b[2:]
+		}
+
+		if dns, ok := decodeDNS(b, p.layers.dnsName[:0]); ok {
+			p.layers.dns = dns
+			p.L7 = &p.layers.dns
+		}
+
+		return
+	}
+
+	if !tcp {
+		return
+	}
+
+	if tls, ok := decodeTLSClientHello(b); ok {
+		p.layers.tls = tls
+		p.L7 = &p.layers.tls
+		return
+	}
+
+	if http, ok := decodeHTTPRequest(b); ok {
+		p.layers.http = http
+		p.L7 = &p.layers.http
+	}
+}
+
+// decodeDNS decodes the header and the first question, the
+// question name is built in the name buffer of the packet
+func decodeDNS(b []byte, name []byte) (DNS, bool) {
+	if len(b) < DNSHLen {
+		return DNS{}, false
+	}
+
+	dns := DNS{
+		ID:       int(b[0])<<8 | int(b[1]),
+		Response: b[2]&0x80 != 0,
+		Opcode:   int(b[2]>>3) & 0x0f,
+		RCode:    int(b[3] & 0x0f),
+	}
+
+	// question count
+	if b[4] == 0 && b[5] == 0 {
+		return dns, true
+	}
+
+	i := DNSHLen
+
+	for i < len(b) {
+		l := int(b[i])
+		if l == 0 {
+			i++
+			break
+		}
+
+		// the question name isn't compressed
+		if l&0xc0 != 0 || i+1+l > len(b) || len(name)+l+1 > maxDNSNameLen {
+			return dns, true
+		}
+
+		if len(name) > 0 {
+			name = append(name, '.')
+		}
+		name = append(name, b[i+1:i+1+l]...)
+		i += 1 + l
+	}
+
+	dns.QName = string(name)
+
+	if i+2 <= len(b) {
+		dns.QType = int(b[i])<<8 | int(b[i+1])
+	}
+
+	return dns, true
+}
+
+// decodeTLSClientHello decodes the client hello from the first TLS record
+func decodeTLSClientHello(b []byte) (TLS, bool) {
+	var tls TLS
+
+	// record header and handshake header
+	if len(b) < 11 || b[0] != tlsContentHandshake || b[1] != 0x03 || b[5] != tlsClientHello {
+		return tls, false
+	}
+
+	tls.Version = int(b[9])<<8 | int(b[10])
+
+	// random
+	b = b[11:]
+	if len(b) < 32 {
+		return tls, true
+	}
+	b = b[32:]
+
+	// session id, cipher suites and compression methods
+	for _, size := range []int{1, 2, 1} {
+		var n int
+		b, n = readVector(b, size)
+		if n < 0 {
+			return tls, true
+		}
+	}
+
+	if len(b) < 2 {
+		return tls, true
+	}
+	b = b[2:]
+
+	for len(b) >= 4 {
+		var (
+			extType = int(b[0])<<8 | int(b[1])
+			extLen  = int(b[2])<<8 | int(b[3])
+		)
+
+		b = b[4:]
+		if extLen > len(b) {
+			// truncated extension
+			extLen = len(b)
+		}
+
+		ext := b[:extLen]
+		b = b[extLen:]
+
+		switch extType {
+		case tlsExtServerName:
+			// server name list length, name type and name length
+			if len(ext) < 5 || ext[2] != 0 {
+				continue
+			}
+			n := int(ext[3])<<8 | int(ext[4])
+			if n <= len(ext)-5 {
+				tls.SNI = string(ext[5 : 5+n])
+			}
+		case tlsExtALPN:
+			if len(ext) < 2 {
+				continue
+			}
+			for ext = ext[2:]; len(ext) > 0; {
+				n := int(ext[0])
+				if n+1 > len(ext) {
+					break
+				}
+				tls.ALPN = append(tls.ALPN, string(ext[1:1+n]))
+				ext = ext[1+n:]
+			}
+		}
+	}
+
+	return tls, true
+}
+
+// readVector skips a TLS variable length vector with the length
+// size, it returns -1 if the vector is truncated.
+func readVector(b []byte, size int) ([]byte, int) {
+	if len(b) < size {
+		return b, -1
+	}
+
+	var n int
+	for i := 0; i < size; i++ {
+		n = n<<8 | int(b[i])
+	}
+
+	if len(b) < size+n {
+		return b, -1
+	}
+
+	return b[size+n:], n
+}
+
+// decodeHTTPRequest decodes the request line and the host header
+func decodeHTTPRequest(b []byte) (HTTP, bool) {
+	var (
+		http HTTP
+		ok   bool
+	)
+
+	for _, m := range httpMethods {
+		if bytes.HasPrefix(b, m) {
+			http.Method = string(m[:len(m)-1])
+			b = b[len(m):]
+			ok = true
+			break
+		}
+	}
+
+	if !ok {
+		return http, false
+	}
+
+	line, b, _ := cutLine(b)
+	if i := bytes.IndexByte(line, ' '); i >= 0 {
+		line = line[:i]
+	}
+	http.Path = string(line)
+
+	for len(b) > 0 {
+		// the truncated header line is ignored
+		var found bool
+		line, b, found = cutLine(b)
+		if !found || len(line) == 0 {
+			break
+		}
+
+		if len(line) > 5 && bytes.EqualFold(line[:5], []byte("host:")) {
+			http.Host = string(bytes.TrimSpace(line[5:]))
+			break
+		}
+	}
+
+	return http, true
+}
+
+// cutLine returns the line before CRLF and the rest of data,
+// it returns the whole data and false if there isn't CRLF.
+func cutLine(b []byte) ([]byte, []byte, bool) {
+	i := bytes.Index(b, []byte("\r\n"))
+	if i < 0 {
+		return b, nil, false
+	}
+
+	return b[:i], b[i+2:], true
+}
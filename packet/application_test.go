@@ -0,0 +1,132 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    application_test.go
+//: details: TODO
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package packet
+
+import "testing"
+
+func tcpHeader(dstPort int) []byte {
+	return []byte{
+		0xa5, 0x8e, byte(dstPort >> 8), byte(dstPort), 0x54, 0x01, 0x4f, 0x1c,
+		0x52, 0x7f, 0x00, 0xf9, 0x50, 0x18, 0x01, 0x2a, 0xbb, 0xde, 0x00, 0x00,
+	}
+}
+
+func decodeL7(t *testing.T, b []byte) interface{} {
+	p := NewPacketWithOptions(Options{L7: true})
+	_, err := p.Decoder(b, headerProtocolIPv4)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	return p.L7
+}
+
+func TestDecodeDNS(t *testing.T) {
+	b := join(outerIPv4(17), []byte{0xd4, 0x31, 0x00, 0x35, 0x00, 0x29, 0x00, 0x00},
+		[]byte{0x12, 0x34, 0x01, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+		[]byte("\x03www\x07example\x03com\x00"), []byte{0x00, 0x1c, 0x00, 0x01})
+
+	dns, ok := decodeL7(t, b).(*DNS)
+	if !ok {
+		t.Fatal("expected DNS")
+	}
+
+	expected := DNS{ID: 0x1234, QName: "www.example.com", QType: 28}
+	if *dns != expected {
+		t.Errorf("expected %#v, got %#v", expected, *dns)
+	}
+
+	// the question name is the only allocation of a reused packet
+	p := NewPacketWithOptions(Options{L7: true})
+	allocs := testing.AllocsPerRun(100, func() {
+		p.Decoder(b, headerProtocolIPv4)
+	})
+	if allocs > 1 {
+		t.Error("expected at most one allocation, got", allocs)
+	}
+
+	// truncated response
+	b[30], b[31] = 0x81, 0x83
+	dns, _ = decodeL7(t, b[:len(b)-8]).(*DNS)
+	if !dns.Response || dns.RCode != 3 || dns.QName != "" {
+		t.Errorf("unexpected DNS, got %#v", dns)
+	}
+}
+
+func TestDecodeTLSClientHello(t *testing.T) {
+	sni := []byte{
+		0x00, 0x00, 0x00, 0x10, 0x00, 0x0e, 0x00, 0x00, 0x0b,
+		'e', 'x', 'a', 'm', 'p', 'l', 'e', '.', 'c', 'o', 'm',
+	}
+	alpn := []byte{
+		0x00, 0x10, 0x00, 0x0e, 0x00, 0x0c,
+		0x02, 'h', '2', 0x08, 'h', 't', 't', 'p', '/', '1', '.', '1',
+	}
+	hello := join(
+		[]byte{0x16, 0x03, 0x01, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x03, 0x03},
+		make([]byte, 32),
+		[]byte{0x00},                             // session id
+		[]byte{0x00, 0x02, 0x13, 0x01},           // cipher suites
+		[]byte{0x01, 0x00},                       // compression methods
+		[]byte{0x00, byte(len(sni) + len(alpn))}, // extensions length
+		sni, alpn,
+	)
+
+	tls, ok := decodeL7(t, join(outerIPv4(6), tcpHeader(443), hello)).(*TLS)
+	if !ok {
+		t.Fatal("expected TLS")
+	}
+
+	if tls.Version != 0x0303 || tls.SNI != "example.com" {
+		t.Errorf("unexpected TLS, got %#v", tls)
+	}
+
+	if len(tls.ALPN) != 2 || tls.ALPN[0] != "h2" || tls.ALPN[1] != "http/1.1" {
+		t.Error("unexpected ALPN, got", tls.ALPN)
+	}
+}
+
+func TestDecodeHTTPRequest(t *testing.T) {
+	req := []byte("GET /index.html?q=1 HTTP/1.1\r\nUser-Agent: test\r\nHOST: example.com\r\nAccept: */*\r\n")
+
+	http, ok := decodeL7(t, join(outerIPv4(6), tcpHeader(8080), req)).(*HTTP)
+	if !ok {
+		t.Fatal("expected HTTP")
+	}
+
+	expected := HTTP{Method: "GET", Host: "example.com", Path: "/index.html?q=1"}
+	if *http != expected {
+		t.Errorf("expected %#v, got %#v", expected, *http)
+	}
+
+	// truncated host header
+	http, _ = decodeL7(t, join(outerIPv4(6), tcpHeader(8080), req[:56])).(*HTTP)
+	if http.Host != "" || http.Path != "/index.html?q=1" {
+		t.Errorf("unexpected HTTP, got %#v", http)
+	}
+
+	// disabled
+	p := NewPacket()
+	p.Decoder(join(outerIPv4(6), tcpHeader(8080), req), headerProtocolIPv4)
+	if p.L7 != nil {
+		t.Error("expected no application layer, got", p.L7)
+	}
+}
@@ -0,0 +1,75 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    arp.go
+//: details: decodes address resolution protocol
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package packet
+
+import (
+	"errors"
+	"net"
+)
+
+// ARPHeader represents an address resolution protocol packet
+type ARPHeader struct {
+	HType     int    // hardware type
+	PType     int    // protocol type
+	Operation int    // request (1) or reply (2)
+	SenderMAC string // sender hardware address
+	SenderIP  string // sender protocol address
+	TargetMAC string // target hardware address
+	TargetIP  string // target protocol address
+}
+
+// ARPHLen is ARP fixed header length size
+const ARPHLen = 8
+
+var (
+	errShortARPHeaderLength = errors.New("short arp header length")
+)
+
+func (p *Packet) decodeARP() error {
+	if len(p.data) < ARPHLen {
+		return errShortARPHeaderLength
+	}
+
+	var (
+		hLen = int(p.data[4])
+		pLen = int(p.data[5])
+		b    = p.data[ARPHLen:]
+	)
+
+	if len(b) < 2*(hLen+pLen) {
+		return errShortARPHeaderLength
+	}
+
+	p.layers.arp = ARPHeader{
+		HType:     int(p.data[0])<<8 | int(p.data[1]),
+		PType:     int(p.data[2])<<8 | int(p.data[3]),
+		Operation: int(p.data[6])<<8 | int(p.data[7]),
+		SenderMAC: net.HardwareAddr(b[:hLen]).String(),
+		SenderIP:  net.IP(b[hLen : hLen+pLen]).String(),
+		TargetMAC: net.HardwareAddr(b[hLen+pLen : 2*hLen+pLen]).String(),
+		TargetIP:  net.IP(b[2*hLen+pLen : 2*(hLen+pLen)]).String(),
+	}
+	p.L3 = &p.layers.arp
+
+	p.data = b[2*(hLen+pLen):]
+
+	return nil
+}
@@ -0,0 +1,64 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    arp_test.go
+//: details: TODO
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package packet
+
+import "testing"
+
+func TestDecodeARP(t *testing.T) {
+	b := []byte{
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+		0x30, 0x7c, 0x5e, 0xe5, 0x59, 0xef,
+		0x08, 0x06,
+		0x00, 0x01, 0x08, 0x00, 0x06, 0x04, 0x00, 0x01,
+		0x30, 0x7c, 0x5e, 0xe5, 0x59, 0xef, 0xc0, 0xa8, 0x01, 0x01,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xc0, 0xa8, 0x01, 0x02,
+	}
+
+	p := NewPacket()
+	_, err := p.Decoder(b, headerProtocolEthernet)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	arp, ok := p.L3.(*ARPHeader)
+	if !ok {
+		t.Fatal("expected ARPHeader, got", p.L3)
+	}
+
+	expected := ARPHeader{
+		HType:     1,
+		PType:     EtherTypeIPv4,
+		Operation: 1,
+		SenderMAC: "30:7c:5e:e5:59:ef",
+		SenderIP:  "192.168.1.1",
+		TargetMAC: "00:00:00:00:00:00",
+		TargetIP:  "192.168.1.2",
+	}
+	if *arp != expected {
+		t.Errorf("expected %#v, got %#v", expected, *arp)
+	}
+
+	p = NewPacket()
+	_, err = p.Decoder(b[:30], headerProtocolEthernet)
+	if err != errShortARPHeaderLength {
+		t.Error("expected short arp error, got", err)
+	}
+}
@@ -22,24 +22,70 @@
 
 package packet
 
-import (
-	"errors"
-	"fmt"
-)
+import "errors"
 
 // Datalink represents layer two IEEE 802.11
 type Datalink struct {
 	// SrcMAC represents source MAC address
-	SrcMAC string
+	SrcMAC MAC
 
 	// DstMAC represents destination MAC address
-	DstMAC string
+	DstMAC MAC
 
-	// Vlan represents VLAN value
+	// Vlan represents VLAN value, the outer VLAN for stacked VLANs
 	Vlan int
 
 	// EtherType represents upper layer type value
 	EtherType uint16
+
+	// Tags represents the VLAN tags from the outer to the inner tag
+	Tags []VlanTag `json:",omitempty"`
+}
+
+// MAC represents a hardware address, it's formatted when it's marshaled
+// and the zero value is formatted as empty string as there isn't address.
+type MAC [6]byte
+
+const hexDigits = "0123456789abcdef"
+
+// String returns the MAC address in the colon separated form
+func (m MAC) String() string {
+	return string(m.AppendTo(make([]byte, 0, 17)))
+}
+
+// AppendTo appends the MAC address text form to b
+func (m MAC) AppendTo(b []byte) []byte {
+	if m == (MAC{}) {
+		return b
+	}
+
+	for i, v := range m {
+		if i > 0 {
+			b = append(b, ':')
+		}
+		b = append(b, hexDigits[v>>4], hexDigits[v&0x0f])
+	}
+
+	return b
+}
+
+// MarshalText implements the encoding.TextMarshaler interface
+func (m MAC) MarshalText() ([]byte, error) {
+	return m.AppendTo(make([]byte, 0, 17)), nil
+}
+
+func newMAC(b []byte) MAC {
+	var m MAC
+	copy(m[:], b)
+	return m
+}
+
+// VlanTag represents IEEE 802.1Q or IEEE 802.1ad VLAN tag
+type VlanTag struct {
+	TPID uint16 // tag protocol identifier
+	PCP  int    // priority code point
+	DEI  int    // drop eligible indicator
+	ID   int    // VLAN identifier
 }
 
 const (
@@ -57,12 +103,26 @@ const (
 
 	// EtherTypeIEEE8021Q is VLAN-tagged frame (IEEE 802.1Q) EtherType value
 	EtherTypeIEEE8021Q = 0x8100
+
+	// EtherTypeIEEE8021AD is service VLAN-tagged frame (IEEE 802.1ad) EtherType value
+	EtherTypeIEEE8021AD = 0x88A8
+
+	// EtherTypeQinQ is the pre-standard stacked VLAN EtherType value
+	EtherTypeQinQ = 0x9100
+
+	// EtherTypeMPLSUnicast is MPLS unicast EtherType value
+	EtherTypeMPLSUnicast = 0x8847
+
+	// EtherTypeMPLSMulticast is MPLS multicast EtherType value
+	EtherTypeMPLSMulticast = 0x8848
 )
 
 var (
 	errShortEthernetHeaderLength = errors.New("the ethernet header is too small")
 )
 
+// decodeEthernet decodes the ethernet header and the VLAN tags,
+// the tags are skipped by slicing so the data isn't modified.
 func (p *Packet) decodeEthernet() error {
 	var (
 		d   Datalink
@@ -78,24 +138,46 @@ func (p *Packet) decodeEthernet() error {
 		return err
 	}
 
-	if d.EtherType == EtherTypeIEEE8021Q {
-		vlan := int(p.data[14])<<8 | int(p.data[15])
-		p.data[12], p.data[13] = p.data[16], p.data[17]
-		p.data = append(p.data[:14], p.data[18:]...)
+	// the tags slice is reused by the decoder
+	d.Tags = p.L2.Tags[:0]
 
-		d, err = decodeIEEE802(p.data)
-		if err != nil {
-			return err
+	offset := 12
+	for isVlanTag(d.EtherType) {
+		if len(p.data) < offset+6 {
+			return errShortEthernetHeaderLength
 		}
-		d.Vlan = vlan
+
+		tci := int(p.data[offset+2])<<8 | int(p.data[offset+3])
+		d.Tags = append(d.Tags, VlanTag{
+			TPID: d.EtherType,
+			PCP:  tci >> 13,
+			DEI:  tci >> 12 & 0x01,
+			ID:   tci & 0x0fff,
+		})
+
+		offset += 4
+		d.EtherType = uint16(p.data[offset])<<8 | uint16(p.data[offset+1])
+	}
+
+	if len(d.Tags) > 0 {
+		d.Vlan = d.Tags[0].ID
 	}
 
 	p.L2 = d
-	p.data = p.data[14:]
+	p.data = p.data[offset+2:]
 
 	return nil
 }
 
+func isVlanTag(etherType uint16) bool {
+	switch etherType {
+	case EtherTypeIEEE8021Q, EtherTypeIEEE8021AD, EtherTypeQinQ:
+		return true
+	}
+
+	return false
+}
+
 func decodeIEEE802(b []byte) (Datalink, error) {
 	var d Datalink
 
@@ -105,12 +187,8 @@ func decodeIEEE802(b []byte) (Datalink, error) {
 
 	d.EtherType = uint16(b[13]) | uint16(b[12])<<8
 
-	hwAddrFmt := "%0.2x:%0.2x:%0.2x:%0.2x:%0.2x:%0.2x"
-
-	if d.EtherType != EtherTypeIEEE8021Q {
-		d.DstMAC = fmt.Sprintf(hwAddrFmt, b[0], b[1], b[2], b[3], b[4], b[5])
-		d.SrcMAC = fmt.Sprintf(hwAddrFmt, b[6], b[7], b[8], b[9], b[10], b[11])
-	}
+	d.DstMAC = newMAC(b[0:6])
+	d.SrcMAC = newMAC(b[6:12])
 
 	return d, nil
 }
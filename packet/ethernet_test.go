@@ -37,11 +37,11 @@ func TestDecodeIEEE802(t *testing.T) {
 		t.Error("unexpected error", err)
 	}
 
-	if d.DstMAC != "d4:04:ff:01:1d:9e" {
+	if d.DstMAC.String() != "d4:04:ff:01:1d:9e" {
 		t.Error("expected d4:04:ff:01:1d:9e, got", d.SrcMAC)
 	}
 
-	if d.SrcMAC != "30:7c:5e:e5:59:ef" {
+	if d.SrcMAC.String() != "30:7c:5e:e5:59:ef" {
 		t.Error("expected 30:7c:5e:e5:59:ef, got", d.DstMAC)
 	}
 
@@ -53,3 +53,57 @@ func TestDecodeIEEE802(t *testing.T) {
 		t.Error("expected 0x800, got", d.EtherType)
 	}
 }
+
+func TestDecodeEthernetStackedVlans(t *testing.T) {
+	b := []byte{
+		0xd4, 0x04, 0xff, 0x01, 0x1d, 0x9e,
+		0x30, 0x7c, 0x5e, 0xe5, 0x59, 0xef,
+		0x88, 0xa8, 0xa0, 0x64, // S-tag: pcp 5, vlan 100
+		0x81, 0x00, 0x30, 0x07, // C-tag: pcp 1, dei 1, vlan 7
+		0x88, 0x47, 0x00, 0x01, 0x41, 0x40, // MPLS label 20
+	}
+	b = append(b, ipv4UDP...)
+	orig := append([]byte{}, b...)
+
+	p := NewPacket()
+	_, err := p.Decoder(b, headerProtocolEthernet)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if string(b) != string(orig) {
+		t.Error("the data has been modified")
+	}
+
+	if p.L2.SrcMAC.String() != "30:7c:5e:e5:59:ef" || p.L2.DstMAC.String() != "d4:04:ff:01:1d:9e" {
+		t.Error("unexpected addresses, got", p.L2.SrcMAC, p.L2.DstMAC)
+	}
+
+	if p.L2.Vlan != 100 {
+		t.Error("expected 100, got", p.L2.Vlan)
+	}
+
+	if p.L2.EtherType != EtherTypeMPLSUnicast {
+		t.Error("expected MPLS ether type, got", p.L2.EtherType)
+	}
+
+	expected := []VlanTag{
+		{TPID: EtherTypeIEEE8021AD, PCP: 5, DEI: 0, ID: 100},
+		{TPID: EtherTypeIEEE8021Q, PCP: 1, DEI: 1, ID: 7},
+	}
+	if len(p.L2.Tags) != 2 || p.L2.Tags[0] != expected[0] || p.L2.Tags[1] != expected[1] {
+		t.Error("unexpected tags, got", p.L2.Tags)
+	}
+
+	if len(p.MPLS) != 1 || p.MPLS[0].Label != 20 {
+		t.Error("unexpected label stack, got", p.MPLS)
+	}
+
+	checkIPv4UDP(t, &p)
+
+	p = NewPacket()
+	_, err = p.Decoder(b[:18], headerProtocolEthernet)
+	if err != errShortEthernetHeaderLength {
+		t.Error("expected short ethernet error, got", err)
+	}
+}
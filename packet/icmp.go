@@ -41,18 +41,155 @@ type ICMP struct {
 
 	// Rest of Header
 	RestHeader []byte
+
+	// ID is echo or timestamp identifier
+	ID int `json:",omitempty"`
+
+	// Seq is echo or timestamp sequence number
+	Seq int `json:",omitempty"`
+
+	// MTU is next-hop MTU of fragmentation needed or packet too big
+	MTU int `json:",omitempty"`
+
+	// Original is the packet that caused the error message,
+	// it has the network layer and the transport ports
+	Original *Packet `json:",omitempty"`
 }
 
+// ICMPHLen is ICMP header length size
+const ICMPHLen = 8
+
+const (
+	icmpEchoReply       = 0
+	icmpDestUnreachable = 3
+	icmpSourceQuench    = 4
+	icmpRedirect        = 5
+	icmpEcho            = 8
+	icmpTimeExceeded    = 11
+	icmpParamProblem    = 12
+	icmpTimestamp       = 13
+	icmpTimestampReply  = 14
+	icmpFragNeeded      = 4
+	icmpv6DestUnreach   = 1
+	icmpv6PacketTooBig  = 2
+	icmpv6TimeExceeded  = 3
+	icmpv6ParamProblem  = 4
+	icmpv6EchoRequest   = 128
+	icmpv6EchoReply     = 129
+)
+
 var errICMPHLenTooSHort = errors.New("ICMP header length is too short")
 
-func decodeICMP(b []byte) (ICMP, error) {
+func (p *Packet) decodeICMP(v6 bool) (ICMP, error) {
+	b := p.data
 	if len(b) < 5 {
 		return ICMP{}, errICMPHLenTooSHort
 	}
 
-	return ICMP{
+	icmp := ICMP{
 		Type:       int(b[0]),
 		Code:       int(b[1]),
 		RestHeader: b[4:],
-	}, nil
+	}
+
+	if len(b) < ICMPHLen {
+		return icmp, nil
+	}
+
+	var (
+		idSeq  bool
+		errMsg bool
+	)
+
+	if v6 {
+		switch icmp.Type {
+		case icmpv6EchoRequest, icmpv6EchoReply:
+			idSeq = true
+		case icmpv6PacketTooBig:
+			icmp.MTU = int(be32(b[4:8]))
+			errMsg = true
+		case icmpv6DestUnreach, icmpv6TimeExceeded, icmpv6ParamProblem:
+			errMsg = true
+		}
+	} else {
+		switch icmp.Type {
+		case icmpEchoReply, icmpEcho, icmpTimestamp, icmpTimestampReply:
+			idSeq = true
+		case icmpDestUnreachable:
+			if icmp.Code == icmpFragNeeded {
+				icmp.MTU = int(b[6])<<8 | int(b[7])
+			}
+			errMsg = true
+		case icmpSourceQuench, icmpRedirect, icmpTimeExceeded, icmpParamProblem:
+			errMsg = true
+		}
+	}
+
+	if idSeq {
+		icmp.ID = int(b[4])<<8 | int(b[5])
+		icmp.Seq = int(b[6])<<8 | int(b[7])
+	}
+
+	if errMsg {
+		icmp.Original = p.decodeOriginal(b[ICMPHLen:], v6)
+	}
+
+	return icmp, nil
+}
+
+// decodeOriginal decodes the original packet in the ICMP error message
+// which is the IP header and at least eight bytes of the payload.
+func (p *Packet) decodeOriginal(b []byte, v6 bool) *Packet {
+	if p.depth >= maxTunnelDepth {
+		return nil
+	}
+
+	// the original packet is reused by the decoder
+	if p.layers.original == nil {
+		p.layers.original = new(Packet)
+	}
+
+	o := p.layers.original
+	o.reset()
+	o.data = b
+	o.depth = p.depth + 1
+
+	var err error
+	if v6 {
+		err = o.decodeIPv6Header()
+	} else {
+		err = o.decodeIPv4Header()
+	}
+
+	if err != nil {
+		return nil
+	}
+
+	// the original transport header is truncated so only
+	// the ports are decoded if the full header isn't there
+	if o.decodeNextLayer() != nil && len(o.data) >= 4 {
+		var proto int
+		switch h := o.L3.(type) {
+		case *IPv4Header:
+			proto = h.Protocol
+		case *IPv6Header:
+			proto = h.Protocol
+		}
+
+		var (
+			srcPort = int(o.data[0])<<8 | int(o.data[1])
+			dstPort = int(o.data[2])<<8 | int(o.data[3])
+		)
+
+		switch proto {
+		case IANAProtoTCP:
+			o.layers.tcp = TCPHeader{SrcPort: srcPort, DstPort: dstPort}
+			o.L4 = &o.layers.tcp
+		case IANAProtoUDP:
+			o.layers.udp = UDPHeader{SrcPort: srcPort, DstPort: dstPort}
+			o.L4 = &o.layers.udp
+		}
+	}
+
+	return o
 }
@@ -0,0 +1,82 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    icmp_test.go
+//: details: TODO
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package packet
+
+import "testing"
+
+func TestDecodeICMPEcho(t *testing.T) {
+	b := append(outerIPv4(1), 0x08, 0x0, 0xf7, 0xfe, 0x0, 0x2a, 0x0, 0x01, 0xde, 0xad)
+
+	p := NewPacket()
+	_, err := p.Decoder(b, headerProtocolIPv4)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	icmp := p.L4.(*ICMP)
+	if icmp.Type != 8 || icmp.ID != 42 || icmp.Seq != 1 || icmp.Original != nil {
+		t.Errorf("unexpected icmp, got %#v", icmp)
+	}
+}
+
+func TestDecodeICMPError(t *testing.T) {
+	// fragmentation needed for the original DNS query
+	b := append(outerIPv4(1), 0x03, 0x04, 0x0, 0x0, 0x0, 0x0, 0x05, 0xdc)
+	b = append(b, ipv4UDP...)
+
+	p := NewPacket()
+	_, err := p.Decoder(b, headerProtocolIPv4)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	icmp := p.L4.(*ICMP)
+	if icmp.Type != 3 || icmp.Code != 4 || icmp.MTU != 1500 {
+		t.Errorf("unexpected icmp, got %#v", icmp)
+	}
+
+	if icmp.Original == nil {
+		t.Fatal("expected original packet")
+	}
+
+	checkIPv4UDP(t, icmp.Original)
+
+	// time exceeded with the first eight bytes of TCP
+	b = append(outerIPv4(1), 0x0b, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0)
+	b = append(b, outerIPv4(6)...)
+	b = append(b, 0xa5, 0x8e, 0x01, 0xbb, 0x54, 0x01, 0x4f, 0x1c)
+
+	p = NewPacket()
+	_, err = p.Decoder(b, headerProtocolIPv4)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	icmp = p.L4.(*ICMP)
+	if icmp.Original == nil {
+		t.Fatal("expected original packet")
+	}
+
+	tcp, ok := icmp.Original.L4.(*TCPHeader)
+	if !ok || tcp.SrcPort != 42382 || tcp.DstPort != 443 {
+		t.Error("unexpected original transport layer, got", icmp.Original.L4)
+	}
+}
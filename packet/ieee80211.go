@@ -0,0 +1,142 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    ieee80211.go
+//: details: decodes IEEE 802.11 and FDDI frames
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package packet
+
+import "errors"
+
+const (
+	// IEEE80211HLen is IEEE 802.11 MAC header length size without the fourth address
+	IEEE80211HLen = 24
+
+	// FDDIHLen is FDDI MAC header length size
+	FDDIHLen = 13
+
+	// LLCSNAPHLen is LLC/SNAP header length size
+	LLCSNAPHLen = 8
+
+	ieee80211TypeData = 2
+)
+
+var (
+	errShortIEEE80211HeaderLength = errors.New("short ieee 802.11 header length")
+	errShortFDDIHeaderLength      = errors.New("short fddi header length")
+	errUnknownLLCHeader           = errors.New("unknown llc header")
+)
+
+// decodeIEEE80211Header decodes IEEE 802.11 MAC header, the upper layers
+// are decoded only for the unprotected data frames as the management,
+// control and the protected frames don't carry a decodable payload.
+func (p *Packet) decodeIEEE80211Header() error {
+	if len(p.data) < IEEE80211HLen {
+		return errShortIEEE80211HeaderLength
+	}
+
+	var (
+		frameType = int(p.data[0]>>2) & 0x03
+		subType   = int(p.data[0] >> 4)
+		toDS      = p.data[1]&0x01 != 0
+		fromDS    = p.data[1]&0x02 != 0
+		protected = p.data[1]&0x40 != 0
+		order     = p.data[1]&0x80 != 0
+		hLen      = IEEE80211HLen
+
+		addr1 = newMAC(p.data[4:10])
+		addr2 = newMAC(p.data[10:16])
+		addr3 = newMAC(p.data[16:22])
+		addr4 MAC
+	)
+
+	if toDS && fromDS {
+		if len(p.data) < hLen+6 {
+			return errShortIEEE80211HeaderLength
+		}
+		addr4 = newMAC(p.data[hLen : hLen+6])
+		hLen += 6
+	}
+
+	switch {
+	case toDS && fromDS:
+		p.L2.DstMAC, p.L2.SrcMAC = addr3, addr4
+	case toDS:
+		p.L2.DstMAC, p.L2.SrcMAC = addr3, addr2
+	case fromDS:
+		p.L2.DstMAC, p.L2.SrcMAC = addr1, addr3
+	default:
+		p.L2.DstMAC, p.L2.SrcMAC = addr1, addr2
+	}
+
+	if frameType != ieee80211TypeData || protected {
+		return nil
+	}
+
+	// QoS data frames have QoS control and optionally HT control
+	if subType&0x08 != 0 {
+		hLen += 2
+		if order {
+			hLen += 4
+		}
+	}
+
+	// null data frames don't have payload
+	if subType&0x04 != 0 {
+		return nil
+	}
+
+	if len(p.data) < hLen {
+		return errShortIEEE80211HeaderLength
+	}
+
+	p.data = p.data[hLen:]
+
+	return p.decodeLLCSNAP()
+}
+
+// decodeFDDIHeader decodes FDDI MAC header which is
+// frame control, destination and source addresses
+func (p *Packet) decodeFDDIHeader() error {
+	if len(p.data) < FDDIHLen {
+		return errShortFDDIHeaderLength
+	}
+
+	p.L2.DstMAC = newMAC(p.data[1:7])
+	p.L2.SrcMAC = newMAC(p.data[7:13])
+
+	p.data = p.data[FDDIHLen:]
+
+	return p.decodeLLCSNAP()
+}
+
+// decodeLLCSNAP decodes IEEE 802.2 LLC header with SNAP extension
+// which carries the payload ether type
+func (p *Packet) decodeLLCSNAP() error {
+	if len(p.data) < LLCSNAPHLen {
+		return errUnknownLLCHeader
+	}
+
+	if p.data[0] != 0xaa || p.data[1] != 0xaa || p.data[2] != 0x03 {
+		return errUnknownLLCHeader
+	}
+
+	p.L2.EtherType = uint16(p.data[6])<<8 | uint16(p.data[7])
+	p.data = p.data[LLCSNAPHLen:]
+
+	return p.decodeUpperLayer(p.L2.EtherType)
+}
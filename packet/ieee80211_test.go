@@ -0,0 +1,93 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    ieee80211_test.go
+//: details: TODO
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package packet
+
+import "testing"
+
+var llcSNAPIPv4 = []byte{0xaa, 0xaa, 0x03, 0x00, 0x00, 0x00, 0x08, 0x00}
+
+func TestDecodeIEEE80211Header(t *testing.T) {
+	b := []byte{
+		0x88, 0x01, // QoS data, to DS
+		0x2c, 0x00, // duration
+		0x00, 0x11, 0x22, 0x33, 0x44, 0x55, // BSSID
+		0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb, // SA
+		0xd4, 0x04, 0xff, 0x01, 0x1d, 0x9e, // DA
+		0x10, 0x00, // sequence control
+		0x00, 0x00, // QoS control
+	}
+	b = append(b, llcSNAPIPv4...)
+	b = append(b, ipv4UDP...)
+
+	p := NewPacket()
+	_, err := p.Decoder(b, headerProtocolIEEE80211)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if p.L2.SrcMAC.String() != "66:77:88:99:aa:bb" {
+		t.Error("expected 66:77:88:99:aa:bb, got", p.L2.SrcMAC)
+	}
+
+	if p.L2.DstMAC.String() != "d4:04:ff:01:1d:9e" {
+		t.Error("expected d4:04:ff:01:1d:9e, got", p.L2.DstMAC)
+	}
+
+	if p.L2.EtherType != EtherTypeIPv4 {
+		t.Error("expected IPv4 ether type, got", p.L2.EtherType)
+	}
+
+	checkIPv4UDP(t, &p)
+
+	// beacon frame
+	b[0], b[1] = 0x80, 0x00
+	p = NewPacket()
+	_, err = p.Decoder(b, headerProtocolIEEE80211)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if p.L3 != nil {
+		t.Error("expected no network layer, got", p.L3)
+	}
+}
+
+func TestDecodeFDDIHeader(t *testing.T) {
+	b := []byte{
+		0x50,
+		0xd4, 0x04, 0xff, 0x01, 0x1d, 0x9e,
+		0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb,
+	}
+	b = append(b, llcSNAPIPv4...)
+	b = append(b, ipv4UDP...)
+
+	p := NewPacket()
+	_, err := p.Decoder(b, headerProtocolFDDI)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if p.L2.SrcMAC.String() != "66:77:88:99:aa:bb" || p.L2.DstMAC.String() != "d4:04:ff:01:1d:9e" {
+		t.Error("unexpected addresses, got", p.L2.SrcMAC, p.L2.DstMAC)
+	}
+
+	checkIPv4UDP(t, &p)
+}
@@ -0,0 +1,91 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    lacp.go
+//: details: decodes link aggregation control protocol
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package packet
+
+import (
+	"errors"
+	"net"
+)
+
+// LACPHeader represents a link aggregation control protocol data unit
+type LACPHeader struct {
+	Subtype int      // slow protocols subtype
+	Version int      // LACP version
+	Actor   LACPInfo // actor information
+	Partner LACPInfo // partner information
+}
+
+// LACPInfo represents the actor or the partner information of LACPDU
+type LACPInfo struct {
+	SystemPriority int    // system priority
+	System         string // system MAC address
+	Key            int    // operational key
+	PortPriority   int    // port priority
+	Port           int    // port number
+	State          int    // port state flags
+}
+
+const (
+	// LACPHLen is LACPDU length size up to the partner information
+	LACPHLen = 42
+
+	slowProtocolLACP = 1
+	lacpInfoLen      = 20
+)
+
+var (
+	errShortLACPHeaderLength = errors.New("short lacp header length")
+	errUnknownSlowProtocol   = errors.New("unknown slow protocol subtype")
+)
+
+func (p *Packet) decodeLACP() error {
+	if len(p.data) < LACPHLen {
+		return errShortLACPHeaderLength
+	}
+
+	if p.data[0] != slowProtocolLACP {
+		return errUnknownSlowProtocol
+	}
+
+	p.layers.lacp = LACPHeader{
+		Subtype: int(p.data[0]),
+		Version: int(p.data[1]),
+		Actor:   decodeLACPInfo(p.data[2:]),
+		Partner: decodeLACPInfo(p.data[2+lacpInfoLen:]),
+	}
+	p.L3 = &p.layers.lacp
+
+	p.data = p.data[LACPHLen:]
+
+	return nil
+}
+
+// decodeLACPInfo decodes the actor or the partner TLV
+func decodeLACPInfo(b []byte) LACPInfo {
+	return LACPInfo{
+		SystemPriority: int(b[2])<<8 | int(b[3]),
+		System:         net.HardwareAddr(b[4:10]).String(),
+		Key:            int(b[10])<<8 | int(b[11]),
+		PortPriority:   int(b[12])<<8 | int(b[13]),
+		Port:           int(b[14])<<8 | int(b[15]),
+		State:          int(b[16]),
+	}
+}
@@ -0,0 +1,79 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    lacp_test.go
+//: details: TODO
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package packet
+
+import "testing"
+
+func TestDecodeLACP(t *testing.T) {
+	b := []byte{
+		0x01, 0x80, 0xc2, 0x00, 0x00, 0x02,
+		0x30, 0x7c, 0x5e, 0xe5, 0x59, 0xef,
+		0x88, 0x09,
+		0x01, 0x01,
+		0x01, 0x14, 0x80, 0x00, 0x30, 0x7c, 0x5e, 0xe5, 0x59, 0x00,
+		0x00, 0x0d, 0x00, 0xff, 0x00, 0x03, 0x3d, 0x00, 0x00, 0x00,
+		0x02, 0x14, 0xff, 0xff, 0xd4, 0x04, 0xff, 0x01, 0x1d, 0x00,
+		0x00, 0x01, 0x00, 0xff, 0x00, 0x11, 0x3f, 0x00, 0x00, 0x00,
+	}
+
+	p := NewPacket()
+	_, err := p.Decoder(b, headerProtocolEthernet)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	lacp, ok := p.L3.(*LACPHeader)
+	if !ok {
+		t.Fatal("expected LACPHeader, got", p.L3)
+	}
+
+	expected := LACPHeader{
+		Subtype: 1,
+		Version: 1,
+		Actor: LACPInfo{
+			SystemPriority: 32768,
+			System:         "30:7c:5e:e5:59:00",
+			Key:            13,
+			PortPriority:   255,
+			Port:           3,
+			State:          0x3d,
+		},
+		Partner: LACPInfo{
+			SystemPriority: 65535,
+			System:         "d4:04:ff:01:1d:00",
+			Key:            1,
+			PortPriority:   255,
+			Port:           17,
+			State:          0x3f,
+		},
+	}
+	if *lacp != expected {
+		t.Errorf("expected %#v, got %#v", expected, *lacp)
+	}
+
+	// marker protocol
+	b[14] = 0x02
+	p = NewPacket()
+	_, err = p.Decoder(b, headerProtocolEthernet)
+	if err != errUnknownSlowProtocol {
+		t.Error("expected unknown slow protocol error, got", err)
+	}
+}
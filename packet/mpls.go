@@ -0,0 +1,84 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    mpls.go
+//: details: decodes MPLS label stack
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package packet
+
+import "errors"
+
+// MPLSLabel represents an MPLS label stack entry
+type MPLSLabel struct {
+	Label int // label value
+	TC    int // traffic class
+	TTL   int // time-to-live
+}
+
+const (
+	// MPLSLabelLen is MPLS label stack entry size
+	MPLSLabelLen = 4
+
+	// mplsControlWordLen is the pseudowire control word size
+	mplsControlWordLen = 4
+)
+
+var errShortMPLSLabelLength = errors.New("short mpls label stack entry length")
+
+// decodeMPLS decodes the label stack up to the bottom of the stack.
+// MPLS doesn't carry the payload type so it's guessed from the first
+// nibble after the label stack, it's the IP version or zero for the
+// ethernet pseudowire control word. The label stack is kept for
+// the other payloads or the truncated data.
+func (p *Packet) decodeMPLS() error {
+	for {
+		if len(p.data) < MPLSLabelLen {
+			return errShortMPLSLabelLength
+		}
+
+		p.MPLS = append(p.MPLS, MPLSLabel{
+			Label: int(p.data[0])<<12 | int(p.data[1])<<4 | int(p.data[2])>>4,
+			TC:    int(p.data[2]>>1) & 0x07,
+			TTL:   int(p.data[3]),
+		})
+
+		bottom := p.data[2]&0x01 == 1
+		p.data = p.data[MPLSLabelLen:]
+
+		if bottom {
+			break
+		}
+	}
+
+	if len(p.data) < 1 {
+		return nil
+	}
+
+	switch p.data[0] >> 4 {
+	case 4:
+		return p.decodeUpperLayer(EtherTypeIPv4)
+	case 6:
+		return p.decodeUpperLayer(EtherTypeIPv6)
+	case 0:
+		if p.opts.Decap && len(p.data) > mplsControlWordLen {
+			p.data = p.data[mplsControlWordLen:]
+			p.decodeInner(Tunnel{Type: "mpls-pw"}, EtherTypeTEB)
+		}
+	}
+
+	return nil
+}
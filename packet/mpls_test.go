@@ -0,0 +1,122 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    mpls_test.go
+//: details: TODO
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package packet
+
+import "testing"
+
+// ipv4UDP is an IPv4 DNS query header from 192.229.216.143 to 192.229.150.190
+var ipv4UDP = []byte{
+	0x45, 0x0, 0x0, 0x4b, 0x8,
+	0xf8, 0x0, 0x0, 0x3e, 0x11,
+	0x82, 0x91, 0xc0, 0xe5, 0xd8,
+	0x8f, 0xc0, 0xe5, 0x96, 0xbe,
+	0x64, 0x9b, 0x0, 0x35, 0x0,
+	0x37, 0x0, 0x0,
+}
+
+func checkIPv4UDP(t *testing.T, p *Packet) {
+	ipv4, ok := p.L3.(*IPv4Header)
+	if !ok {
+		t.Fatal("expected IPv4Header, got", p.L3)
+	}
+
+	if ipv4.Src.String() != "192.229.216.143" || ipv4.Dst.String() != "192.229.150.190" {
+		t.Error("unexpected addresses, got", ipv4.Src, ipv4.Dst)
+	}
+
+	udp, ok := p.L4.(*UDPHeader)
+	if !ok {
+		t.Fatal("expected UDPHeader, got", p.L4)
+	}
+
+	if udp.SrcPort != 25755 || udp.DstPort != 53 {
+		t.Error("unexpected ports, got", udp.SrcPort, udp.DstPort)
+	}
+}
+
+func TestDecodeMPLS(t *testing.T) {
+	b := append([]byte{
+		0x00, 0x3e, 0x80, 0xff, // label 1000, tc 0
+		0x00, 0x01, 0x4b, 0x40, // label 20, tc 5, bottom of stack
+	}, ipv4UDP...)
+
+	p := NewPacket()
+	_, err := p.Decoder(b, headerProtocolMPLS)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if len(p.MPLS) != 2 {
+		t.Fatal("expected 2 labels, got", len(p.MPLS))
+	}
+
+	if p.MPLS[0] != (MPLSLabel{Label: 1000, TC: 0, TTL: 255}) {
+		t.Error("unexpected label, got", p.MPLS[0])
+	}
+
+	if p.MPLS[1] != (MPLSLabel{Label: 20, TC: 5, TTL: 64}) {
+		t.Error("unexpected label, got", p.MPLS[1])
+	}
+
+	checkIPv4UDP(t, &p)
+
+	p = NewPacket()
+	_, err = p.Decoder(b[:6], headerProtocolMPLS)
+	if err != errShortMPLSLabelLength {
+		t.Error("expected short label error, got", err)
+	}
+}
+
+func TestDecodeMPLSPseudowire(t *testing.T) {
+	b := join([]byte{
+		0x00, 0x01, 0x41, 0x40, // label 20, bottom of stack
+		0x00, 0x00, 0x00, 0x01, // control word
+	}, innerEthernet, ipv4UDP)
+
+	p := NewPacketWithOptions(Options{Decap: true})
+	_, err := p.Decoder(b, headerProtocolMPLS)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if len(p.MPLS) != 1 || p.Tunnel == nil || p.Tunnel.Type != "mpls-pw" || p.Inner == nil {
+		t.Fatal("expected mpls-pw inner packet, got", p.MPLS, p.Tunnel)
+	}
+
+	if p.Inner.L2.SrcMAC.String() != "30:7c:5e:e5:59:ef" {
+		t.Error("unexpected inner data link, got", p.Inner.L2)
+	}
+
+	checkIPv4UDP(t, p.Inner)
+
+	// the label stack is kept for the other or the truncated payloads
+	for _, data := range [][]byte{b, b[:4], join(b[:4], []byte{0x12, 0x34})} {
+		p = NewPacket()
+		_, err = p.Decoder(data, headerProtocolMPLS)
+		if err != nil {
+			t.Error("unexpected error", err)
+		}
+
+		if len(p.MPLS) != 1 || p.L3 != nil || p.Inner != nil {
+			t.Error("expected the label stack only, got", p.MPLS, p.L3, p.Inner)
+		}
+	}
+}
@@ -24,34 +24,45 @@ package packet
 
 import (
 	"errors"
-	"net"
+	"net/netip"
 )
 
 // IPv4Header represents an IPv4 header
 type IPv4Header struct {
-	Version  int    // protocol version
-	TOS      int    // type-of-service
-	TotalLen int    // packet total length
-	ID       int    // identification
-	Flags    int    // flags
-	FragOff  int    // fragment offset
-	TTL      int    // time-to-live
-	Protocol int    // next protocol
-	Checksum int    // checksum
-	Src      string // source address
-	Dst      string // destination address
+	Version  int        // protocol version
+	TOS      int        // type-of-service
+	TotalLen int        // packet total length
+	ID       int        // identification
+	Flags    int        // flags
+	FragOff  int        // fragment offset
+	TTL      int        // time-to-live
+	Protocol int        // next protocol
+	Checksum int        // checksum
+	Src      netip.Addr // source address
+	Dst      netip.Addr // destination address
 }
 
 // IPv6Header represents an IPv6 header
 type IPv6Header struct {
-	Version      int    // protocol version
-	TrafficClass int    // traffic class
-	FlowLabel    int    // flow label
-	PayloadLen   int    // payload length
-	NextHeader   int    // next header
-	HopLimit     int    // hop limit
-	Src          string // source address
-	Dst          string // destination address
+	Version      int        // protocol version
+	TrafficClass int        // traffic class
+	FlowLabel    int        // flow label
+	PayloadLen   int        // payload length
+	NextHeader   int        // next header
+	HopLimit     int        // hop limit
+	Src          netip.Addr // source address
+	Dst          netip.Addr // destination address
+
+	ExtHeaders []int         `json:",omitempty"` // extension headers in order
+	Protocol   int           // upper layer protocol after the extension headers
+	Fragment   *IPv6Fragment `json:",omitempty"` // fragment header
+}
+
+// IPv6Fragment represents an IPv6 fragment extension header
+type IPv6Fragment struct {
+	Offset int // fragment offset in 8-octet units
+	More   int // more fragments flag
+	ID     int // identification
 }
 
 const (
@@ -72,11 +83,51 @@ const (
 
 	// IANAProtoIPv6ICMP is IANA Internet Control Message number for IPv6
 	IANAProtoIPv6ICMP = 58
+
+	// IANAProtoIPIP is IANA IPv4 encapsulation number
+	IANAProtoIPIP = 4
+
+	// IANAProtoIPv6 is IANA IPv6 encapsulation number
+	IANAProtoIPv6 = 41
+
+	// IANAProtoGRE is IANA Generic Routing Encapsulation number
+	IANAProtoGRE = 47
+
+	// IANAProtoHopByHop is IANA IPv6 Hop-by-Hop Option number
+	IANAProtoHopByHop = 0
+
+	// IANAProtoIPv6Route is IANA Routing Header for IPv6 number
+	IANAProtoIPv6Route = 43
+
+	// IANAProtoIPv6Frag is IANA Fragment Header for IPv6 number
+	IANAProtoIPv6Frag = 44
+
+	// IANAProtoESP is IANA Encapsulating Security Payload number
+	IANAProtoESP = 50
+
+	// IANAProtoAH is IANA Authentication Header number
+	IANAProtoAH = 51
+
+	// IANAProtoIPv6NoNxt is IANA No Next Header for IPv6 number
+	IANAProtoIPv6NoNxt = 59
+
+	// IANAProtoIPv6Opts is IANA Destination Options for IPv6 number
+	IANAProtoIPv6Opts = 60
+
+	// IANAProtoMobility is IANA Mobility Header number
+	IANAProtoMobility = 135
+
+	// IANAProtoHIP is IANA Host Identity Protocol number
+	IANAProtoHIP = 139
+
+	// IANAProtoShim6 is IANA Shim6 Protocol number
+	IANAProtoShim6 = 140
 )
 
 var (
 	errShortIPv4HeaderLength = errors.New("short ipv4 header length")
 	errShortIPv6HeaderLength = errors.New("short ipv6 header length")
+	errShortIPv6ExtHdrLength = errors.New("short ipv6 extension header length")
 	errShortEthernetLength   = errors.New("short ethernet header length")
 	errUnknownTransportLayer = errors.New("unknown transport layer")
 	errUnknownL3Protocol     = errors.New("unknown network layer protocol")
@@ -85,49 +136,74 @@ var (
 func (p *Packet) decodeNextLayer() error {
 
 	var (
-		proto int
-		len   int
+		proto  int
+		length int
 	)
 
-	switch p.L3.(type) {
-	case IPv4Header:
-		proto = p.L3.(IPv4Header).Protocol
-	case IPv6Header:
-		proto = p.L3.(IPv6Header).NextHeader
+	switch h := p.L3.(type) {
+	case *IPv4Header:
+		// only the first fragment has the upper layer header
+		if h.FragOff != 0 {
+			return nil
+		}
+		proto = h.Protocol
+	case *IPv6Header:
+		// only the first fragment has the upper layer header
+		if h.Fragment != nil && h.Fragment.Offset != 0 {
+			return nil
+		}
+		proto = h.Protocol
 	default:
 		return errUnknownL3Protocol
 	}
 
 	switch proto {
+	case IANAProtoESP, IANAProtoIPv6NoNxt:
+		// the payload is encrypted or there isn't any payload
+		return nil
 	case IANAProtoICMP, IANAProtoIPv6ICMP:
-		icmp, err := decodeICMP(p.data)
+		icmp, err := p.decodeICMP(proto == IANAProtoIPv6ICMP)
 		if err != nil {
 			return err
 		}
 
-		p.L4 = icmp
-		len = 4
+		p.layers.icmp = icmp
+		p.L4 = &p.layers.icmp
+		length = ICMPHLen
 	case IANAProtoTCP:
-		tcp, err := decodeTCP(p.data)
+		tcp, err := decodeTCP(p.data, &p.layers.tcpOptions)
 		if err != nil {
 			return err
 		}
 
-		p.L4 = tcp
-		len = 20
+		p.layers.tcp = tcp
+		p.L4 = &p.layers.tcp
+		length = tcp.DataOffset * 4
+		if length < TCPHLen {
+			length = TCPHLen
+		}
 	case IANAProtoUDP:
 		udp, err := decodeUDP(p.data)
 		if err != nil {
 			return err
 		}
 
-		p.L4 = udp
-		len = 8
+		p.layers.udp = udp
+		p.L4 = &p.layers.udp
+		length = 8
 	default:
+		if p.opts.Decap && isIPTunnel(proto) {
+			return p.decodeIPTunnel(proto)
+		}
 		return errUnknownTransportLayer
 	}
 
-	p.data = p.data[len:]
+	// the sampled header could be truncated in the transport layer
+	if length > len(p.data) {
+		length = len(p.data)
+	}
+
+	p.data = p.data[length:]
 
 	return nil
 }
@@ -137,51 +213,113 @@ func (p *Packet) decodeIPv6Header() error {
 		return errShortIPv6HeaderLength
 	}
 
-	var (
-		src net.IP = p.data[8:24]
-		dst net.IP = p.data[24:40]
-	)
-
-	p.L3 = IPv6Header{
+	// the extension headers slice is reused by the decoder
+	h := &p.layers.ipv6
+	*h = IPv6Header{
 		Version:      int(p.data[0]) >> 4,
 		TrafficClass: int(p.data[0]&0x0f)<<4 | int(p.data[1])>>4,
 		FlowLabel:    int(p.data[1]&0x0f)<<16 | int(p.data[2])<<8 | int(p.data[3]),
 		PayloadLen:   int(uint16(p.data[4])<<8 | uint16(p.data[5])),
 		NextHeader:   int(p.data[6]),
 		HopLimit:     int(p.data[7]),
-		Src:          src.String(),
-		Dst:          dst.String(),
+		Src:          netip.AddrFrom16([16]byte(p.data[8:24])).Unmap(),
+		Dst:          netip.AddrFrom16([16]byte(p.data[24:40])).Unmap(),
+		ExtHeaders:   h.ExtHeaders[:0],
 	}
 
 	p.data = p.data[IPv6HLen:]
 
+	err := p.decodeIPv6ExtHeaders(h)
+	if err != nil {
+		return err
+	}
+
+	p.L3 = h
+
 	return nil
 }
 
+// decodeIPv6ExtHeaders walks the extension headers chain
+// and sets the upper layer protocol after the chain.
+func (p *Packet) decodeIPv6ExtHeaders(h *IPv6Header) error {
+	var (
+		next   = h.NextHeader
+		length int
+	)
+
+	for {
+		switch next {
+		case IANAProtoHopByHop, IANAProtoIPv6Route, IANAProtoIPv6Opts,
+			IANAProtoMobility, IANAProtoHIP, IANAProtoShim6:
+			if len(p.data) < 2 {
+				return errShortIPv6ExtHdrLength
+			}
+			length = (int(p.data[1]) + 1) * 8
+		case IANAProtoIPv6Frag:
+			if len(p.data) < 8 {
+				return errShortIPv6ExtHdrLength
+			}
+			h.Fragment = &p.layers.fragment
+			*h.Fragment = IPv6Fragment{
+				Offset: (int(p.data[2])<<8 | int(p.data[3])) >> 3,
+				More:   int(p.data[3] & 0x01),
+				ID: int(p.data[4])<<24 | int(p.data[5])<<16 |
+					int(p.data[6])<<8 | int(p.data[7]),
+			}
+			length = 8
+		case IANAProtoAH:
+			if len(p.data) < 2 {
+				return errShortIPv6ExtHdrLength
+			}
+			length = (int(p.data[1]) + 2) * 4
+		default:
+			h.Protocol = next
+			return nil
+		}
+
+		if len(p.data) < length {
+			return errShortIPv6ExtHdrLength
+		}
+
+		h.ExtHeaders = append(h.ExtHeaders, next)
+		next = int(p.data[0])
+		p.data = p.data[length:]
+
+		// a non-first fragment payload isn't an extension header
+		if h.Fragment != nil && h.Fragment.Offset != 0 {
+			h.Protocol = next
+			return nil
+		}
+	}
+}
+
 func (p *Packet) decodeIPv4Header() error {
 	if len(p.data) < IPv4HLen {
 		return errShortIPv4HeaderLength
 	}
 
-	var (
-		src net.IP = p.data[12:16]
-		dst net.IP = p.data[16:20]
-	)
+	// the header length includes the options
+	hLen := int(p.data[0]&0x0f) * 4
+	if hLen < IPv4HLen || len(p.data) < hLen {
+		return errShortIPv4HeaderLength
+	}
 
-	p.L3 = IPv4Header{
+	p.layers.ipv4 = IPv4Header{
 		Version:  int(p.data[0] & 0xf0 >> 4),
 		TOS:      int(p.data[1]),
 		TotalLen: int(p.data[2])<<8 | int(p.data[3]),
 		ID:       int(p.data[4])<<8 | int(p.data[5]),
-		Flags:    int(p.data[6] & 0x07),
+		Flags:    int(p.data[6] >> 5),
+		FragOff:  int(p.data[6]&0x1f)<<8 | int(p.data[7]),
 		TTL:      int(p.data[8]),
 		Protocol: int(p.data[9]),
 		Checksum: int(p.data[10])<<8 | int(p.data[11]),
-		Src:      src.String(),
-		Dst:      dst.String(),
+		Src:      netip.AddrFrom4([4]byte(p.data[12:16])),
+		Dst:      netip.AddrFrom4([4]byte(p.data[16:20])),
 	}
+	p.L3 = &p.layers.ipv4
 
-	p.data = p.data[IPv4HLen:]
+	p.data = p.data[hLen:]
 
 	return nil
 }
@@ -39,7 +39,7 @@ func TestDecodeIPv4Header(t *testing.T) {
 		t.Error("unexpected error", err)
 	}
 
-	ipv4 := p.L3.(IPv4Header)
+	ipv4 := p.L3.(*IPv4Header)
 
 	if ipv4.Version != 4 {
 		t.Error("unexpected version, got", ipv4.Version)
@@ -70,11 +70,151 @@ func TestDecodeIPv4Header(t *testing.T) {
 	if ipv4.Checksum != 33425 {
 		t.Error("unexpected checksum, got", ipv4.Checksum)
 	}
-	if ipv4.Src != "192.229.216.143" {
+	if ipv4.Src.String() != "192.229.216.143" {
 		t.Error("unexpected src addr, got", ipv4.Src)
 	}
 
-	if ipv4.Dst != "192.229.150.190" {
+	if ipv4.Dst.String() != "192.229.150.190" {
 		t.Error("unexpected dst addr, got", ipv4.Dst)
 	}
 }
+
+func TestDecodeIPv6ExtHeaders(t *testing.T) {
+	ipv6 := []byte{
+		0x60, 0x0, 0x0, 0x0, 0x0, 0x30, 0x0, 0x40,
+		0x20, 0x01, 0x0d, 0xb8, 0x0, 0x0, 0x0, 0x0,
+		0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x01,
+		0x20, 0x01, 0x0d, 0xb8, 0x0, 0x0, 0x0, 0x0,
+		0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x02,
+	}
+	exts := []byte{
+		// hop-by-hop: router alert and padding
+		0x3c, 0x0, 0x05, 0x02, 0x0, 0x0, 0x01, 0x0,
+		// destination options: 16 bytes
+		0x2c, 0x01, 0x01, 0x0c, 0x0, 0x0, 0x0, 0x0,
+		0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0,
+		// fragment: offset 0, more fragments, id 0x12345678
+		0x11, 0x0, 0x0, 0x01, 0x12, 0x34, 0x56, 0x78,
+	}
+	udp := []byte{0x64, 0x9b, 0x0, 0x35, 0x0, 0x10, 0x0, 0x0}
+
+	b := append(append(append([]byte{}, ipv6...), exts...), udp...)
+
+	p := NewPacket()
+	_, err := p.Decoder(b, headerProtocolIPv6)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	h := p.L3.(*IPv6Header)
+
+	if h.NextHeader != IANAProtoHopByHop {
+		t.Error("expected hop-by-hop next header, got", h.NextHeader)
+	}
+
+	if h.Protocol != IANAProtoUDP {
+		t.Error("expected UDP protocol, got", h.Protocol)
+	}
+
+	expected := []int{IANAProtoHopByHop, IANAProtoIPv6Opts, IANAProtoIPv6Frag}
+	if len(h.ExtHeaders) != len(expected) {
+		t.Fatal("unexpected extension headers, got", h.ExtHeaders)
+	}
+	for i := range expected {
+		if h.ExtHeaders[i] != expected[i] {
+			t.Error("unexpected extension headers, got", h.ExtHeaders)
+		}
+	}
+
+	if h.Fragment == nil || *h.Fragment != (IPv6Fragment{Offset: 0, More: 1, ID: 0x12345678}) {
+		t.Error("unexpected fragment, got", h.Fragment)
+	}
+
+	udpHeader, ok := p.L4.(*UDPHeader)
+	if !ok || udpHeader.DstPort != 53 {
+		t.Error("unexpected transport layer, got", p.L4)
+	}
+
+	// non-first fragment doesn't have the transport header
+	b[len(ipv6)+24+3] = 0xb9
+	p = NewPacket()
+	_, err = p.Decoder(b, headerProtocolIPv6)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if h = p.L3.(*IPv6Header); h.Fragment.Offset != 23 {
+		t.Error("expected fragment offset 23, got", h.Fragment.Offset)
+	}
+
+	if p.L4 != nil {
+		t.Error("expected no transport layer, got", p.L4)
+	}
+
+	// non-first fragment payload isn't walked as extension headers
+	b[len(ipv6)+24] = IANAProtoIPv6Route
+	p = NewPacket()
+	_, err = p.Decoder(b, headerProtocolIPv6)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	h = p.L3.(*IPv6Header)
+	if len(h.ExtHeaders) != len(expected) || h.Protocol != IANAProtoIPv6Route {
+		t.Error("unexpected extension headers after fragment, got", h.ExtHeaders, h.Protocol)
+	}
+
+	// truncated extension header
+	p = NewPacket()
+	_, err = p.Decoder(b[:len(ipv6)+12], headerProtocolIPv6)
+	if err != errShortIPv6ExtHdrLength {
+		t.Error("expected short extension header error, got", err)
+	}
+}
+
+func TestDecodeIPv4Fragments(t *testing.T) {
+	b := []byte{
+		0x46, 0x0, 0x0, 0x4b, 0x8, 0xf8, 0x20, 0x0, 0x3e, 0x11,
+		0x82, 0x91, 0xc0, 0xe5, 0xd8, 0x8f, 0xc0, 0xe5, 0x96, 0xbe,
+		0x94, 0x04, 0x0, 0x0, // router alert option
+		0x64, 0x9b, 0x0, 0x35, 0x0, 0x37, 0x0, 0x0,
+	}
+
+	p := NewPacket()
+	_, err := p.Decoder(b, headerProtocolIPv4)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	ipv4 := p.L3.(*IPv4Header)
+	if ipv4.Flags != 1 || ipv4.FragOff != 0 {
+		t.Error("unexpected flags or fragment offset, got", ipv4.Flags, ipv4.FragOff)
+	}
+
+	if udp, ok := p.L4.(*UDPHeader); !ok || udp.DstPort != 53 {
+		t.Error("unexpected transport layer, got", p.L4)
+	}
+
+	// non-first fragment
+	b[6], b[7] = 0x00, 0xb9
+	p = NewPacket()
+	_, err = p.Decoder(b, headerProtocolIPv4)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if ipv4 = p.L3.(*IPv4Header); ipv4.Flags != 0 || ipv4.FragOff != 185 {
+		t.Error("unexpected flags or fragment offset, got", ipv4.Flags, ipv4.FragOff)
+	}
+
+	if p.L4 != nil {
+		t.Error("expected no transport layer, got", p.L4)
+	}
+
+	// the header length is more than the data
+	p = NewPacket()
+	_, err = p.Decoder(b[:22], headerProtocolIPv4)
+	if err != errShortIPv4HeaderLength {
+		t.Error("expected short ipv4 header error, got", err)
+	}
+}
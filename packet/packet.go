@@ -26,17 +26,61 @@ import "errors"
 
 // The header protocol describes the format of the sampled header
 const (
-	headerProtocolEthernet uint32 = 1
-	headerProtocolIPv4     uint32 = 11
-	headerProtocolIPv6     uint32 = 12
+	headerProtocolEthernet  uint32 = 1
+	headerProtocolFDDI      uint32 = 4
+	headerProtocolPPP       uint32 = 7
+	headerProtocolIPv4      uint32 = 11
+	headerProtocolIPv6      uint32 = 12
+	headerProtocolMPLS      uint32 = 13
+	headerProtocolPOS       uint32 = 14
+	headerProtocolIEEE80211 uint32 = 15
 )
 
-// Packet represents layer 2,3,4 available info
+// Packet represents layer 2,3,4 available info, the tunnel
+// and the inner packet are decoded if decapsulation is enabled
 type Packet struct {
-	L2   Datalink
-	L3   interface{}
-	L4   interface{}
-	data []byte
+	L2     Datalink
+	MPLS   []MPLSLabel `json:",omitempty"`
+	L3     interface{}
+	L4     interface{}
+	L7     interface{} `json:",omitempty"`
+	Tunnel *Tunnel     `json:",omitempty"`
+	Inner  *Packet     `json:",omitempty"`
+	data   []byte
+	opts   Options
+	depth  int
+
+	// the layers which the interfaces point to, they're
+	// reused by the decoder to avoid allocation
+	layers layers
+}
+
+type layers struct {
+	ipv4       IPv4Header
+	ipv6       IPv6Header
+	fragment   IPv6Fragment
+	arp        ARPHeader
+	lacp       LACPHeader
+	tcp        TCPHeader
+	tcpOptions TCPOptions
+	udp        UDPHeader
+	icmp       ICMP
+	dns        DNS
+	dnsName    [maxDNSNameLen]byte
+	tls        TLS
+	http       HTTP
+	tunnel     Tunnel
+	inner      *Packet
+	original   *Packet
+}
+
+// Options represents the packet decoding options
+type Options struct {
+	// Decap decodes the inner packet of the tunnels
+	Decap bool
+
+	// L7 decodes DNS, TLS client hello and HTTP request from the payload
+	L7 bool
 }
 
 var (
@@ -49,38 +93,57 @@ func NewPacket() Packet {
 	return Packet{}
 }
 
-// Decoder decodes packet's layers
+// NewPacketWithOptions constructs a packet object with the decoding options
+func NewPacketWithOptions(opts Options) Packet {
+	return Packet{opts: opts}
+}
+
+// Decoder decodes packet's layers, the packet could be reused to decode
+// another data and the layers refer to the packet so it shouldn't be copied.
 func (p *Packet) Decoder(data []byte, protocol uint32) (*Packet, error) {
 	var (
 		err error
 	)
 
+	p.reset()
 	p.data = data
 
 	switch protocol {
 	case headerProtocolEthernet:
 		err = p.decodeEthernetHeader()
-		return p, err
 	case headerProtocolIPv4:
-		err = p.decodeIPv4Header()
-		if err != nil {
-			return p, err
-		}
+		err = p.decodeUpperLayer(EtherTypeIPv4)
 	case headerProtocolIPv6:
-		err = p.decodeIPv6Header()
-		if err != nil {
-			return p, err
-		}
+		err = p.decodeUpperLayer(EtherTypeIPv6)
+	case headerProtocolMPLS:
+		err = p.decodeUpperLayer(EtherTypeMPLSUnicast)
+	case headerProtocolPPP, headerProtocolPOS:
+		err = p.decodePPPHeader()
+	case headerProtocolIEEE80211:
+		err = p.decodeIEEE80211Header()
+	case headerProtocolFDDI:
+		err = p.decodeFDDIHeader()
 	default:
 		return p, errUnknownHeaderProtocol
 	}
 
-	err = p.decodeNextLayer()
-	if err != nil {
-		return p, err
-	}
+	return p, err
+}
+
+// SetOptions sets the decoding options
+func (p *Packet) SetOptions(opts Options) {
+	p.opts = opts
+}
 
-	return p, nil
+// reset clears the layers and keeps the allocated slices
+func (p *Packet) reset() {
+	p.L2 = Datalink{Tags: p.L2.Tags[:0]}
+	p.MPLS = p.MPLS[:0]
+	p.L3 = nil
+	p.L4 = nil
+	p.L7 = nil
+	p.Tunnel = nil
+	p.Inner = nil
 }
 
 func (p *Packet) decodeEthernetHeader() error {
@@ -93,34 +156,47 @@ func (p *Packet) decodeEthernetHeader() error {
 		return err
 	}
 
-	switch p.L2.EtherType {
-	case EtherTypeIPv4:
-
-		err = p.decodeIPv4Header()
-		if err != nil {
-			return err
-		}
+	return p.decodeUpperLayer(p.L2.EtherType)
+}
 
-		err = p.decodeNextLayer()
-		if err != nil {
-			return err
-		}
+// decodeUpperLayer decodes the layers after the data link
+// based on the ether type of the data link payload
+func (p *Packet) decodeUpperLayer(etherType uint16) error {
+	var (
+		err error
+	)
 
+	switch etherType {
+	case EtherTypeIPv4:
+		err = p.decodeIPv4Header()
 	case EtherTypeIPv6:
-
 		err = p.decodeIPv6Header()
-		if err != nil {
-			return err
-		}
-
-		err = p.decodeNextLayer()
-		if err != nil {
-			return err
-		}
-
+	case EtherTypeMPLSUnicast, EtherTypeMPLSMulticast:
+		return p.decodeMPLS()
+	case EtherTypeARP:
+		return p.decodeARP()
+	case EtherTypeLACP:
+		return p.decodeLACP()
 	default:
 		return errUnknownEtherType
 	}
 
+	if err != nil {
+		return err
+	}
+
+	err = p.decodeNextLayer()
+	if err != nil {
+		return err
+	}
+
+	if p.opts.Decap {
+		p.decodeUDPTunnel()
+	}
+
+	if p.opts.L7 && p.Inner == nil {
+		p.decodeApplication()
+	}
+
 	return nil
 }
@@ -64,3 +64,90 @@ func BenchmarkDecodeEthernetIPv4TCP(b *testing.B) {
 		p.Decoder(data, headerProtocolEthernet)
 	}
 }
+
+func BenchmarkDecodeEthernetIPv4TCPReuse(b *testing.B) {
+	data := []byte{
+		0xde, 0xad, 0x7a, 0x48, 0xcc, 0x37, 0xd4, 0x4, 0xff, 0x1, 0x18, 0x1e,
+		0x81, 0x0, 0x0, 0x7, 0x8, 0x0, 0x45, 0x0, 0x2, 0x6b, 0x95, 0x54, 0x40,
+		0x0, 0x3c, 0x6, 0xab, 0x3b, 0x6c, 0xa1, 0xf8, 0x5e, 0xc0, 0xe5, 0xd6,
+		0x17, 0x1f, 0xf7, 0xc5, 0xe5, 0xf, 0xf5, 0x1c, 0x14, 0x68, 0xa4, 0x11,
+		0x89, 0x80, 0x18, 0x1, 0x7, 0x35, 0xdc, 0x0, 0x0, 0x1, 0x1, 0x8, 0xa,
+		0x17, 0x32, 0x75, 0x97, 0xf8, 0x73, 0x54, 0x15, 0x17, 0x3, 0x3, 0x0,
+	}
+
+	b.ReportAllocs()
+	p := NewPacket()
+	for i := 0; i < b.N; i++ {
+		p.Decoder(data, headerProtocolEthernet)
+	}
+}
+
+func BenchmarkDecodeVXLANReuse(b *testing.B) {
+	data := join(outerIPv4(17), []byte{0xc3, 0x50, 0x12, 0xb5, 0x0, 0x50, 0x0, 0x0},
+		[]byte{0x08, 0x0, 0x0, 0x0, 0x0, 0x13, 0x88, 0x0}, innerEthernet, ipv4UDP)
+
+	b.ReportAllocs()
+	p := NewPacketWithOptions(Options{Decap: true})
+	for i := 0; i < b.N; i++ {
+		p.Decoder(data, headerProtocolIPv4)
+	}
+}
+
+func TestDecoderReuse(t *testing.T) {
+	qinq := append([]byte{
+		0xd4, 0x04, 0xff, 0x01, 0x1d, 0x9e, 0x30, 0x7c, 0x5e, 0xe5, 0x59, 0xef,
+		0x88, 0xa8, 0xa0, 0x64, 0x81, 0x00, 0x30, 0x07, 0x08, 0x00,
+	}, ipv4UDP...)
+	gre := join(outerIPv4(47), []byte{0x20, 0x0, 0x08, 0x0, 0x0, 0x0, 0x0, 0x2a}, ipv4UDP)
+
+	p := NewPacketWithOptions(Options{Decap: true})
+
+	_, err := p.Decoder(qinq, headerProtocolEthernet)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if len(p.L2.Tags) != 2 || p.Tunnel != nil {
+		t.Error("unexpected layers, got", p.L2, p.Tunnel)
+	}
+
+	_, err = p.Decoder(gre, headerProtocolIPv4)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if len(p.L2.Tags) != 0 || p.L2.SrcMAC != (MAC{}) || p.L4 != nil {
+		t.Error("unexpected layers, got", p.L2, p.L4)
+	}
+
+	if p.Tunnel == nil || p.Inner == nil {
+		t.Fatal("expected tunnel and inner packet")
+	}
+
+	checkIPv4UDP(t, p.Inner)
+
+	_, err = p.Decoder(qinq, headerProtocolEthernet)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if p.Tunnel != nil || p.Inner != nil || len(p.L2.Tags) != 2 {
+		t.Error("unexpected layers, got", p.Tunnel, p.Inner, p.L2)
+	}
+
+	checkIPv4UDP(t, &p)
+}
+
+func TestMACMarshalText(t *testing.T) {
+	m := MAC{0xd4, 0x04, 0xff, 0x01, 0x1d, 0x9e}
+
+	b, _ := m.MarshalText()
+	if string(b) != "d4:04:ff:01:1d:9e" {
+		t.Error("expected d4:04:ff:01:1d:9e, got", string(b))
+	}
+
+	b, _ = MAC{}.MarshalText()
+	if len(b) != 0 {
+		t.Error("expected empty text, got", string(b))
+	}
+}
@@ -0,0 +1,94 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    ppp.go
+//: details: decodes PPP and Cisco HDLC
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package packet
+
+import "errors"
+
+// PPP protocol field values
+const (
+	pppProtocolIPv4          = 0x0021
+	pppProtocolIPv6          = 0x0057
+	pppProtocolMPLSUnicast   = 0x0281
+	pppProtocolMPLSMulticast = 0x0283
+)
+
+var (
+	errShortPPPHeaderLength = errors.New("short ppp header length")
+	errUnknownPPPProtocol   = errors.New("unknown ppp protocol")
+)
+
+// decodePPPHeader decodes PPP with or without the HDLC-like framing
+// (RFC 1662) and Cisco HDLC which are used by PPP and packet over SONET.
+// The data link ether type is set based on the PPP protocol.
+func (p *Packet) decodePPPHeader() error {
+	if len(p.data) < 2 {
+		return errShortPPPHeaderLength
+	}
+
+	// Cisco HDLC: address, control and ether type
+	if (p.data[0] == 0x0f || p.data[0] == 0x8f) && p.data[1] == 0x00 {
+		if len(p.data) < 4 {
+			return errShortPPPHeaderLength
+		}
+
+		p.L2.EtherType = uint16(p.data[2])<<8 | uint16(p.data[3])
+		p.data = p.data[4:]
+
+		return p.decodeUpperLayer(p.L2.EtherType)
+	}
+
+	// HDLC-like framing: all-stations address and unnumbered information control
+	if p.data[0] == 0xff && p.data[1] == 0x03 {
+		p.data = p.data[2:]
+	}
+
+	if len(p.data) < 1 {
+		return errShortPPPHeaderLength
+	}
+
+	// the protocol field is one byte if it's compressed
+	var protocol int
+	if p.data[0]&0x01 == 1 {
+		protocol = int(p.data[0])
+		p.data = p.data[1:]
+	} else {
+		if len(p.data) < 2 {
+			return errShortPPPHeaderLength
+		}
+		protocol = int(p.data[0])<<8 | int(p.data[1])
+		p.data = p.data[2:]
+	}
+
+	switch protocol {
+	case pppProtocolIPv4:
+		p.L2.EtherType = EtherTypeIPv4
+	case pppProtocolIPv6:
+		p.L2.EtherType = EtherTypeIPv6
+	case pppProtocolMPLSUnicast:
+		p.L2.EtherType = EtherTypeMPLSUnicast
+	case pppProtocolMPLSMulticast:
+		p.L2.EtherType = EtherTypeMPLSMulticast
+	default:
+		return errUnknownPPPProtocol
+	}
+
+	return p.decodeUpperLayer(p.L2.EtherType)
+}
@@ -0,0 +1,66 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    ppp_test.go
+//: details: TODO
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package packet
+
+import "testing"
+
+func TestDecodePPPHeader(t *testing.T) {
+	headers := map[string][]byte{
+		"ppp":            {0x00, 0x21},
+		"compressed ppp": {0x21},
+		"hdlc framing":   {0xff, 0x03, 0x00, 0x21},
+		"cisco hdlc":     {0x0f, 0x00, 0x08, 0x00},
+	}
+
+	for name, h := range headers {
+		p := NewPacket()
+		_, err := p.Decoder(append(h, ipv4UDP...), headerProtocolPOS)
+		if err != nil {
+			t.Fatal(name, "unexpected error", err)
+		}
+
+		if p.L2.EtherType != EtherTypeIPv4 {
+			t.Error(name, "expected IPv4 ether type, got", p.L2.EtherType)
+		}
+
+		checkIPv4UDP(t, &p)
+	}
+
+	// PPP over MPLS
+	b := append([]byte{0xff, 0x03, 0x02, 0x81, 0x00, 0x01, 0x41, 0x40}, ipv4UDP...)
+	p := NewPacket()
+	_, err := p.Decoder(b, headerProtocolPPP)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if len(p.MPLS) != 1 || p.MPLS[0].Label != 20 {
+		t.Error("unexpected label stack, got", p.MPLS)
+	}
+
+	checkIPv4UDP(t, &p)
+
+	p = NewPacket()
+	_, err = p.Decoder([]byte{0xc0, 0x21, 0x01}, headerProtocolPPP)
+	if err != errUnknownPPPProtocol {
+		t.Error("expected unknown protocol error, got", err)
+	}
+}
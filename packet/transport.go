@@ -31,6 +31,26 @@ type TCPHeader struct {
 	DataOffset int
 	Reserved   int
 	Flags      int
+	Seq        int
+	Ack        int
+	Window     int
+	Options    *TCPOptions `json:",omitempty"`
+}
+
+// TCPOptions represents the known TCP options
+type TCPOptions struct {
+	MSS           int            `json:",omitempty"` // maximum segment size
+	WScale        int            `json:",omitempty"` // window scale shift count
+	SACKPermitted bool           `json:",omitempty"` // selective acknowledgment permitted
+	SACK          []TCPSACKBlock `json:",omitempty"` // selective acknowledgment blocks
+	TSVal         int            `json:",omitempty"` // timestamp value
+	TSEcr         int            `json:",omitempty"` // timestamp echo reply
+}
+
+// TCPSACKBlock represents a selective acknowledgment block
+type TCPSACKBlock struct {
+	Left  int
+	Right int
 }
 
 // UDPHeader represents UDP header
@@ -39,23 +59,110 @@ type UDPHeader struct {
 	DstPort int
 }
 
+// TCP option kinds
+const (
+	tcpOptionEnd           = 0
+	tcpOptionNOP           = 1
+	tcpOptionMSS           = 2
+	tcpOptionWScale        = 3
+	tcpOptionSACKPermitted = 4
+	tcpOptionSACK          = 5
+	tcpOptionTimestamp     = 8
+)
+
+// TCPHLen is TCP header length size without the options
+const TCPHLen = 20
+
 var (
 	errShortTCPHeaderLength = errors.New("short TCP header length")
 	errShortUDPHeaderLength = errors.New("short UDP header length")
 )
 
-func decodeTCP(b []byte) (TCPHeader, error) {
-	if len(b) < 20 {
+// decodeTCP decodes the TCP header, the known options are decoded to o
+func decodeTCP(b []byte, o *TCPOptions) (TCPHeader, error) {
+	if len(b) < TCPHLen {
 		return TCPHeader{}, errShortTCPHeaderLength
 	}
 
-	return TCPHeader{
+	h := TCPHeader{
 		SrcPort:    int(b[0])<<8 | int(b[1]),
 		DstPort:    int(b[2])<<8 | int(b[3]),
 		DataOffset: int(b[12]) >> 4,
 		Reserved:   0,
 		Flags:      ((int(b[12])<<8 | int(b[13])) & 0x01ff),
-	}, nil
+		Seq:        int(be32(b[4:8])),
+		Ack:        int(be32(b[8:12])),
+		Window:     int(b[14])<<8 | int(b[15]),
+	}
+
+	// the options could be truncated by the sampling
+	hLen := h.DataOffset * 4
+	if hLen > len(b) {
+		hLen = len(b)
+	}
+
+	if hLen > TCPHLen && decodeTCPOptions(b[TCPHLen:hLen], o) {
+		h.Options = o
+	}
+
+	return h, nil
+}
+
+// decodeTCPOptions decodes the known options to o, it
+// returns false if there isn't any known option
+func decodeTCPOptions(b []byte, o *TCPOptions) bool {
+	var found bool
+
+	// the sack slice is reused by the decoder
+	*o = TCPOptions{SACK: o.SACK[:0]}
+
+	for len(b) > 0 {
+		kind := b[0]
+		if kind == tcpOptionEnd {
+			break
+		}
+
+		if kind == tcpOptionNOP {
+			b = b[1:]
+			continue
+		}
+
+		if len(b) < 2 || int(b[1]) < 2 || int(b[1]) > len(b) {
+			break
+		}
+
+		v := b[2:b[1]]
+		b = b[b[1]:]
+
+		switch {
+		case kind == tcpOptionMSS && len(v) == 2:
+			o.MSS = int(v[0])<<8 | int(v[1])
+		case kind == tcpOptionWScale && len(v) == 1:
+			o.WScale = int(v[0])
+		case kind == tcpOptionSACKPermitted:
+			o.SACKPermitted = true
+		case kind == tcpOptionSACK && len(v)%8 == 0:
+			for ; len(v) > 0; v = v[8:] {
+				o.SACK = append(o.SACK, TCPSACKBlock{
+					Left:  int(be32(v[0:4])),
+					Right: int(be32(v[4:8])),
+				})
+			}
+		case kind == tcpOptionTimestamp && len(v) == 8:
+			o.TSVal = int(be32(v[0:4]))
+			o.TSEcr = int(be32(v[4:8]))
+		default:
+			continue
+		}
+
+		found = true
+	}
+
+	return found
+}
+
+func be32(b []byte) uint32 {
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
 }
 
 func decodeUDP(b []byte) (UDPHeader, error) {
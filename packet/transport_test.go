@@ -52,7 +52,7 @@ func TestDecodeTCP(t *testing.T) {
 		0x2a, 0xbb, 0xde, 0x0, 0x0,
 	}
 
-	tcp, err := decodeTCP(b)
+	tcp, err := decodeTCP(b, new(TCPOptions))
 	if err != nil {
 		t.Error("unexpected error", err)
 	}
@@ -78,7 +78,7 @@ func TestDecodeTCP2(t *testing.T) {
 		0x2a, 0xbb, 0xde, 0x0, 0x0,
 	}
 
-	tcp, err := decodeTCP(b)
+	tcp, err := decodeTCP(b, new(TCPOptions))
 	if err != nil {
 		t.Error("unexpected error", err)
 	}
@@ -93,3 +93,51 @@ func TestDecodeTCP2(t *testing.T) {
 		t.Error("expected dataoffset:5, got", tcp.DataOffset)
 	}
 }
+
+func TestDecodeTCPOptions(t *testing.T) {
+	b := []byte{
+		0xa5, 0x8e, 0x01, 0xbb, 0x54, 0x01, 0x4f, 0x1c,
+		0x52, 0x7f, 0x00, 0xf9, 0xa0, 0x12, 0xfa, 0xf0,
+		0xbb, 0xde, 0x00, 0x00,
+		0x02, 0x04, 0x05, 0xb4, // mss 1460
+		0x04, 0x02, // sack permitted
+		0x08, 0x0a, 0x00, 0x00, 0x00, 0x64, 0x00, 0x00, 0x00, 0x00, // timestamp
+		0x01,             // nop
+		0x03, 0x03, 0x07, // window scale 7
+	}
+
+	tcp, err := decodeTCP(b, new(TCPOptions))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if tcp.Seq != 0x54014f1c || tcp.Ack != 0x527f00f9 || tcp.Window != 64240 {
+		t.Error("unexpected seq, ack or window, got", tcp.Seq, tcp.Ack, tcp.Window)
+	}
+
+	if tcp.DataOffset != 10 || tcp.Flags != 0x12 {
+		t.Error("unexpected data offset or flags, got", tcp.DataOffset, tcp.Flags)
+	}
+
+	expected := TCPOptions{MSS: 1460, WScale: 7, SACKPermitted: true, TSVal: 100}
+	if tcp.Options == nil || tcp.Options.MSS != expected.MSS || tcp.Options.WScale != expected.WScale ||
+		tcp.Options.SACKPermitted != expected.SACKPermitted || tcp.Options.TSVal != expected.TSVal ||
+		tcp.Options.TSEcr != expected.TSEcr {
+		t.Errorf("expected %#v, got %#v", expected, tcp.Options)
+	}
+
+	// sack blocks and truncated options
+	b = append(b[:20:20], 0x01, 0x01, 0x05, 0x0a, 0x00, 0x00, 0x00, 0x10,
+		0x00, 0x00, 0x00, 0x20, 0x08, 0x0a, 0x00)
+	b[12] = 0x80
+
+	tcp, err = decodeTCP(b, new(TCPOptions))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if tcp.Options == nil || len(tcp.Options.SACK) != 1 ||
+		tcp.Options.SACK[0] != (TCPSACKBlock{Left: 16, Right: 32}) {
+		t.Errorf("unexpected options, got %#v", tcp.Options)
+	}
+}
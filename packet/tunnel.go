@@ -0,0 +1,233 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    tunnel.go
+//: details: decapsulates GRE, ERSPAN, VXLAN, GENEVE and IP tunnels
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package packet
+
+import "errors"
+
+// Tunnel represents the encapsulation between the outer and the inner packet
+type Tunnel struct {
+	Type      string // gre, erspan, vxlan, geneve, mpls-udp, mpls-pw or ipip
+	VNI       int    `json:",omitempty"` // VXLAN or GENEVE network identifier
+	Key       int    `json:",omitempty"` // GRE key
+	Protocol  int    `json:",omitempty"` // GRE or GENEVE protocol type
+	SessionID int    `json:",omitempty"` // ERSPAN session id
+}
+
+const (
+	// UDPPortVXLAN is IANA VXLAN UDP port number
+	UDPPortVXLAN = 4789
+
+	// UDPPortGENEVE is IANA GENEVE UDP port number
+	UDPPortGENEVE = 6081
+
+	// UDPPortMPLS is IANA MPLS-in-UDP port number
+	UDPPortMPLS = 6635
+
+	// EtherTypeTEB is transparent ethernet bridging EtherType value
+	EtherTypeTEB = 0x6558
+
+	// EtherTypeERSPAN2 is ERSPAN type II EtherType value
+	EtherTypeERSPAN2 = 0x88BE
+
+	// EtherTypeERSPAN3 is ERSPAN type III EtherType value
+	EtherTypeERSPAN3 = 0x22EB
+
+	// maxTunnelDepth is the maximum number of the nested tunnels
+	maxTunnelDepth = 4
+)
+
+var (
+	errShortTunnelHeaderLength = errors.New("short tunnel header length")
+	errUnknownTunnelProtocol   = errors.New("unknown tunnel protocol")
+)
+
+func isIPTunnel(proto int) bool {
+	switch proto {
+	case IANAProtoIPIP, IANAProtoIPv6, IANAProtoGRE:
+		return true
+	}
+
+	return false
+}
+
+// decodeIPTunnel decodes IP-in-IP, 6in4 and GRE tunnels
+// which are carried by IP without transport layer
+func (p *Packet) decodeIPTunnel(proto int) error {
+	switch proto {
+	case IANAProtoIPIP:
+		p.decodeInner(Tunnel{Type: "ipip"}, EtherTypeIPv4)
+	case IANAProtoIPv6:
+		p.decodeInner(Tunnel{Type: "ipip"}, EtherTypeIPv6)
+	case IANAProtoGRE:
+		return p.decodeGRE()
+	}
+
+	return nil
+}
+
+// decodeUDPTunnel decodes the UDP tunnels by the well known destination ports
+func (p *Packet) decodeUDPTunnel() {
+	udp, ok := p.L4.(*UDPHeader)
+	if !ok {
+		return
+	}
+
+	switch udp.DstPort {
+	case UDPPortVXLAN:
+		if len(p.data) < 8 || p.data[0]&0x08 == 0 {
+			return
+		}
+
+		vni := int(p.data[4])<<16 | int(p.data[5])<<8 | int(p.data[6])
+		p.data = p.data[8:]
+		p.decodeInner(Tunnel{Type: "vxlan", VNI: vni}, EtherTypeTEB)
+	case UDPPortGENEVE:
+		if len(p.data) < 8 || p.data[0]>>6 != 0 {
+			return
+		}
+
+		hLen := 8 + int(p.data[0]&0x3f)*4
+		if len(p.data) < hLen {
+			return
+		}
+
+		t := Tunnel{
+			Type:     "geneve",
+			Protocol: int(p.data[2])<<8 | int(p.data[3]),
+			VNI:      int(p.data[4])<<16 | int(p.data[5])<<8 | int(p.data[6]),
+		}
+		p.data = p.data[hLen:]
+		p.decodeInner(t, uint16(t.Protocol))
+	case UDPPortMPLS:
+		p.decodeInner(Tunnel{Type: "mpls-udp"}, EtherTypeMPLSUnicast)
+	}
+}
+
+// decodeGRE decodes GRE version 0 header and ERSPAN type II and III
+func (p *Packet) decodeGRE() error {
+	if len(p.data) < 4 {
+		return errShortTunnelHeaderLength
+	}
+
+	var (
+		flags = int(p.data[0])<<8 | int(p.data[1])
+		hLen  = 4
+		t     = &Tunnel{
+			Type:     "gre",
+			Protocol: int(p.data[2])<<8 | int(p.data[3]),
+		}
+	)
+
+	if flags&0x07 != 0 {
+		return errUnknownTunnelProtocol
+	}
+
+	// checksum and reserved
+	if flags&0x8000 != 0 {
+		hLen += 4
+	}
+
+	if flags&0x2000 != 0 {
+		if len(p.data) < hLen+4 {
+			return errShortTunnelHeaderLength
+		}
+		t.Key = int(p.data[hLen])<<24 | int(p.data[hLen+1])<<16 |
+			int(p.data[hLen+2])<<8 | int(p.data[hLen+3])
+		hLen += 4
+	}
+
+	// sequence number
+	if flags&0x1000 != 0 {
+		hLen += 4
+	}
+
+	if len(p.data) < hLen {
+		return errShortTunnelHeaderLength
+	}
+
+	p.data = p.data[hLen:]
+
+	switch t.Protocol {
+	case EtherTypeERSPAN2, EtherTypeERSPAN3:
+		return p.decodeERSPAN(t)
+	}
+
+	p.decodeInner(*t, uint16(t.Protocol))
+
+	return nil
+}
+
+// decodeERSPAN decodes ERSPAN type II and III headers, the
+// mirrored frame follows the header
+func (p *Packet) decodeERSPAN(t *Tunnel) error {
+	hLen := 8
+	if t.Protocol == EtherTypeERSPAN3 {
+		hLen = 12
+		// platform specific subheader
+		if len(p.data) >= hLen && p.data[11]&0x01 != 0 {
+			hLen += 8
+		}
+	}
+
+	if len(p.data) < hLen {
+		return errShortTunnelHeaderLength
+	}
+
+	t.Type = "erspan"
+	t.SessionID = (int(p.data[2])<<8 | int(p.data[3])) & 0x03ff
+	p.data = p.data[hLen:]
+
+	p.decodeInner(*t, EtherTypeTEB)
+
+	return nil
+}
+
+// decodeInner decodes the tunnel payload as the inner packet, the
+// inner packet keeps the layers which have been decoded before an
+// error since the sampled header is usually truncated in the inner
+// packet. the ether type could be transparent ethernet bridging.
+func (p *Packet) decodeInner(t Tunnel, etherType uint16) {
+	p.layers.tunnel = t
+	p.Tunnel = &p.layers.tunnel
+
+	if p.depth >= maxTunnelDepth {
+		return
+	}
+
+	// the inner packet is reused by the decoder
+	if p.layers.inner == nil {
+		p.layers.inner = new(Packet)
+	}
+
+	p.Inner = p.layers.inner
+	p.Inner.reset()
+	p.Inner.data = p.data
+	p.Inner.opts = p.opts
+	p.Inner.depth = p.depth + 1
+
+	if etherType == EtherTypeTEB {
+		p.Inner.decodeEthernetHeader()
+	} else {
+		p.Inner.decodeUpperLayer(etherType)
+	}
+
+	p.data = p.Inner.data
+}
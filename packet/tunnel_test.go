@@ -0,0 +1,140 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    tunnel_test.go
+//: details: TODO
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package packet
+
+import "testing"
+
+// outerIPv4 returns IPv4 header from 10.0.0.1 to 10.0.0.2 with the protocol
+func outerIPv4(proto byte) []byte {
+	return []byte{
+		0x45, 0x0, 0x0, 0x64, 0x0, 0x01, 0x0, 0x0, 0x40, proto,
+		0x0, 0x0, 0x0a, 0x0, 0x0, 0x01, 0x0a, 0x0, 0x0, 0x02,
+	}
+}
+
+var innerEthernet = []byte{
+	0xd4, 0x04, 0xff, 0x01, 0x1d, 0x9e,
+	0x30, 0x7c, 0x5e, 0xe5, 0x59, 0xef,
+	0x08, 0x00,
+}
+
+func join(b ...[]byte) []byte {
+	var r []byte
+	for _, v := range b {
+		r = append(r, v...)
+	}
+	return r
+}
+
+func TestDecodeTunnels(t *testing.T) {
+	testCases := []struct {
+		name   string
+		data   []byte
+		tunnel Tunnel
+		l2     bool
+	}{
+		{
+			name: "vxlan",
+			data: join(outerIPv4(17), []byte{0xc3, 0x50, 0x12, 0xb5, 0x0, 0x50, 0x0, 0x0},
+				[]byte{0x08, 0x0, 0x0, 0x0, 0x0, 0x13, 0x88, 0x0}, innerEthernet, ipv4UDP),
+			tunnel: Tunnel{Type: "vxlan", VNI: 5000},
+			l2:     true,
+		},
+		{
+			name: "geneve",
+			data: join(outerIPv4(17), []byte{0xc3, 0x50, 0x17, 0xc1, 0x0, 0x50, 0x0, 0x0},
+				[]byte{0x01, 0x0, 0x65, 0x58, 0x0, 0x0, 0x64, 0x0, 0x01, 0x02, 0x03, 0x01},
+				innerEthernet, ipv4UDP),
+			tunnel: Tunnel{Type: "geneve", VNI: 100, Protocol: EtherTypeTEB},
+			l2:     true,
+		},
+		{
+			name:   "gre",
+			data:   join(outerIPv4(47), []byte{0x20, 0x0, 0x08, 0x0, 0x0, 0x0, 0x0, 0x2a}, ipv4UDP),
+			tunnel: Tunnel{Type: "gre", Key: 42, Protocol: EtherTypeIPv4},
+		},
+		{
+			name: "erspan",
+			data: join(outerIPv4(47), []byte{0x10, 0x0, 0x88, 0xbe, 0x0, 0x0, 0x0, 0x01},
+				[]byte{0x10, 0x0, 0x0, 0x07, 0x0, 0x0, 0x0, 0x0}, innerEthernet, ipv4UDP),
+			tunnel: Tunnel{Type: "erspan", Protocol: EtherTypeERSPAN2, SessionID: 7},
+			l2:     true,
+		},
+		{
+			name:   "ipip",
+			data:   join(outerIPv4(4), ipv4UDP),
+			tunnel: Tunnel{Type: "ipip"},
+		},
+		{
+			name: "mpls-udp",
+			data: join(outerIPv4(17), []byte{0xc3, 0x50, 0x19, 0xeb, 0x0, 0x50, 0x0, 0x0},
+				[]byte{0x0, 0x01, 0x41, 0x40}, ipv4UDP),
+			tunnel: Tunnel{Type: "mpls-udp"},
+		},
+	}
+
+	for _, tc := range testCases {
+		p := NewPacketWithOptions(Options{Decap: true})
+		_, err := p.Decoder(tc.data, headerProtocolIPv4)
+		if err != nil {
+			t.Fatal(tc.name, "unexpected error", err)
+		}
+
+		if p.L3.(*IPv4Header).Src.String() != "10.0.0.1" {
+			t.Error(tc.name, "unexpected outer network layer, got", p.L3)
+		}
+
+		if p.Tunnel == nil || *p.Tunnel != tc.tunnel {
+			t.Errorf("%s expected %#v, got %#v", tc.name, tc.tunnel, p.Tunnel)
+		}
+
+		if p.Inner == nil {
+			t.Fatal(tc.name, "expected inner packet")
+		}
+
+		if tc.l2 && p.Inner.L2.SrcMAC.String() != "30:7c:5e:e5:59:ef" {
+			t.Error(tc.name, "unexpected inner data link, got", p.Inner.L2)
+		}
+
+		checkIPv4UDP(t, p.Inner)
+	}
+}
+
+func TestDecodeTunnelsDisabled(t *testing.T) {
+	b := join(outerIPv4(47), []byte{0x0, 0x0, 0x08, 0x0}, ipv4UDP)
+
+	p := NewPacket()
+	_, err := p.Decoder(b, headerProtocolIPv4)
+	if err != errUnknownTransportLayer {
+		t.Error("expected unknown transport layer error, got", err)
+	}
+
+	// truncated inner packet keeps the outer layers
+	p = NewPacketWithOptions(Options{Decap: true})
+	_, err = p.Decoder(b[:30], headerProtocolIPv4)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if p.Tunnel == nil || p.Inner == nil || p.Inner.L3 != nil {
+		t.Error("unexpected inner packet, got", p.Inner)
+	}
+}
@@ -0,0 +1,159 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    batch.go
+//: details: message batching and framing
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package producer
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// FramingNDJSON terminates each message by newline
+	FramingNDJSON = "ndjson"
+
+	// FramingLength prefixes each message by its length
+	// as 4 bytes unsigned integer in network byte order
+	FramingLength = "length"
+)
+
+// BatchConfig represents the message batching configuration, the
+// messages are combined by the framing into a message queue message
+// once there are batch-size messages or batch-interval milliseconds
+// passed. The messages are sent as is if the batch size is less than
+// two and the framing isn't set.
+type BatchConfig struct {
+	Size     int    `yaml:"batch-size"`
+	Interval int    `yaml:"batch-interval"`
+	Framing  string `yaml:"framing"`
+}
+
+var errUnknownFraming = errors.New("unknown framing")
+
+// batcher combines the messages for the message
+// queues which don't have native batching
+type batcher struct {
+	size     int
+	interval time.Duration
+	frame    func(b, msg []byte) []byte
+	buf      []byte
+	n        int
+}
+
+func newBatcher(cfg BatchConfig) (*batcher, error) {
+	b := &batcher{
+		size:     cfg.Size,
+		interval: time.Duration(cfg.Interval) * time.Millisecond,
+	}
+
+	if b.size < 1 {
+		b.size = 1
+	}
+
+	switch cfg.Framing {
+	case "":
+		if b.size > 1 {
+			b.frame = frameNDJSON
+		}
+	case FramingNDJSON:
+		b.frame = frameNDJSON
+	case FramingLength:
+		b.frame = frameLength
+	default:
+		return nil, errUnknownFraming
+	}
+
+	return b, nil
+}
+
+// run sends the batches until the channel is closed or the context is
+// canceled, the messages of a batch which couldn't be sent and the pending
+// messages once the context is canceled are counted by the error counter.
+// The batch is reused once the send returned.
+func (b *batcher) run(ctx context.Context, mCh chan Message, ec *uint64, send func([]byte) error) error {
+	var tick <-chan time.Time
+
+	if b.size > 1 && b.interval > 0 {
+		t := time.NewTicker(b.interval)
+		defer t.Stop()
+		tick = t.C
+	}
+
+	for {
+		select {
+		case msg, ok := <-mCh:
+			if !ok {
+				b.flush(ec, send)
+				return nil
+			}
+
+			b.add(msg.Value)
+			if b.n >= b.size {
+				b.flush(ec, send)
+			}
+		case <-tick:
+			b.flush(ec, send)
+		case <-ctx.Done():
+			atomic.AddUint64(ec, uint64(b.n))
+			b.reset()
+			return ctx.Err()
+		}
+	}
+}
+
+func (b *batcher) add(msg []byte) {
+	if b.frame == nil {
+		b.buf = msg
+	} else {
+		b.buf = b.frame(b.buf, msg)
+	}
+
+	b.n++
+}
+
+func (b *batcher) flush(ec *uint64, send func([]byte) error) {
+	if b.n == 0 {
+		return
+	}
+
+	if err := send(b.buf); err != nil {
+		atomic.AddUint64(ec, uint64(b.n))
+	}
+
+	b.reset()
+}
+
+func (b *batcher) reset() {
+	b.buf = b.buf[:0]
+	b.n = 0
+}
+
+func frameNDJSON(b, msg []byte) []byte {
+	b = append(b, msg...)
+	return append(b, '\n')
+}
+
+func frameLength(b, msg []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(msg)))
+	return append(b, msg...)
+}
@@ -0,0 +1,213 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    batch_test.go
+//: details: TODO
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package producer
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"log"
+	"net"
+	"path"
+	"testing"
+	"time"
+)
+
+func runBatcher(t *testing.T, cfg BatchConfig, msgs []string) ([]string, uint64) {
+	var (
+		ec    uint64
+		sends []string
+		ch    = make(chan Message, len(msgs))
+	)
+
+	b, err := newBatcher(cfg)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	for _, msg := range msgs {
+		ch <- Message{Value: []byte(msg)}
+	}
+	close(ch)
+
+	err = b.run(context.Background(), ch, &ec, func(b []byte) error {
+		sends = append(sends, string(b))
+		return nil
+	})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	return sends, ec
+}
+
+func TestBatchSize(t *testing.T) {
+	sends, _ := runBatcher(t, BatchConfig{Size: 3}, []string{"a", "b", "c", "d", "e", "f", "g"})
+
+	expected := []string{"a\nb\nc\n", "d\ne\nf\n", "g\n"}
+	if len(sends) != len(expected) {
+		t.Fatalf("expect %q, got %q", expected, sends)
+	}
+
+	for i := range expected {
+		if sends[i] != expected[i] {
+			t.Errorf("expect %q, got %q", expected[i], sends[i])
+		}
+	}
+}
+
+func TestBatchFraming(t *testing.T) {
+	sends, _ := runBatcher(t, BatchConfig{}, []string{"a%d", "b"})
+	if len(sends) != 2 || sends[0] != "a%d" || sends[1] != "b" {
+		t.Errorf("expect the messages as is, got %q", sends)
+	}
+
+	sends, _ = runBatcher(t, BatchConfig{Size: 2, Framing: FramingLength}, []string{"ab", "c"})
+	if len(sends) != 1 || sends[0] != "\x00\x00\x00\x02ab\x00\x00\x00\x01c" {
+		t.Errorf("unexpected length framing %q", sends)
+	}
+
+	if _, err := newBatcher(BatchConfig{Framing: "xml"}); err != errUnknownFraming {
+		t.Error("expect unknown framing error, got", err)
+	}
+}
+
+func TestBatchInterval(t *testing.T) {
+	var (
+		ec   uint64
+		ch   = make(chan Message, 2)
+		sent = make(chan string, 1)
+		done = make(chan error)
+	)
+
+	b, _ := newBatcher(BatchConfig{Size: 100, Interval: 10})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		done <- b.run(ctx, ch, &ec, func(b []byte) error {
+			sent <- string(b)
+			return net.ErrClosed
+		})
+	}()
+
+	ch <- Message{Value: []byte("a")}
+	ch <- Message{Value: []byte("b")}
+
+	select {
+	case s := <-sent:
+		if s != "a\nb\n" {
+			t.Errorf("expect a\\nb\\n, got %q", s)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expect the batch after the interval")
+	}
+
+	cancel()
+
+	if err := <-done; err != context.Canceled {
+		t.Error("expect context canceled error, got", err)
+	}
+
+	if ec != 2 {
+		t.Error("expect 2 errors, got", ec)
+	}
+}
+
+func TestBatchCancel(t *testing.T) {
+	var (
+		ec   uint64
+		ch   = make(chan Message, 3)
+		done = make(chan error)
+	)
+
+	b, _ := newBatcher(BatchConfig{Size: 100})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		done <- b.run(ctx, ch, &ec, func(b []byte) error {
+			t.Errorf("unexpected batch %q", b)
+			return nil
+		})
+	}()
+
+	for _, msg := range []string{"a", "b", "c"} {
+		ch <- Message{Value: []byte(msg)}
+	}
+
+	for len(ch) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	<-done
+
+	// the pending messages are counted as failed
+	if ec != 3 {
+		t.Error("expect 3 errors, got", ec)
+	}
+}
+
+func TestRawSocket(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer ln.Close()
+
+	conf := path.Join(t.TempDir(), "rawsocket.conf")
+	ioutil.WriteFile(conf, []byte("url: "+ln.Addr().String()+"\nbatch-size: 2\n"), 0644)
+
+	ch := make(chan Message, 3)
+	ch <- Message{Value: []byte(`{"a":"100%s"}`)}
+	ch <- Message{Value: []byte(`{"b":1}`)}
+	ch <- Message{Value: []byte(`{"c":2}`)}
+	close(ch)
+
+	p := Producer{MQ: new(RawSocket), MQConfigFile: conf, Topic: "vflow", Chan: ch,
+		Logger: log.New(ioutil.Discard, "", 0), MQErrorCount: new(uint64)}
+
+	go func() {
+		if err := p.Run(context.Background()); err != nil {
+			t.Error("unexpected error", err)
+		}
+	}()
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer conn.Close()
+
+	r := bufio.NewScanner(conn)
+	for _, expected := range []string{`{"a":"100%s"}`, `{"b":1}`, `{"c":2}`} {
+		if !r.Scan() {
+			t.Fatal("expect a line, got", r.Err())
+		}
+
+		if r.Text() != expected {
+			t.Errorf("expect %s, got %s", expected, r.Text())
+		}
+	}
+}
@@ -0,0 +1,118 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    file.go
+//: details: vflow file producer plugin
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package producer
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+
+	"gopkg.in/yaml.v2"
+)
+
+// File represents file producer, it appends the messages to
+// the topic file as newline delimited JSON by default, the
+// messages are written by batch-size or every batch-interval
+type File struct {
+	file    *os.File
+	config  FileConfig
+	batcher *batcher
+	logger  *log.Logger
+}
+
+// FileConfig represents file producer configuration
+type FileConfig struct {
+	Dir   string      `yaml:"dir"`
+	Batch BatchConfig `yaml:",inline"`
+}
+
+// Setup configures the file producer
+func (f *File) Setup(configFile string, logger *log.Logger) error {
+	var err error
+
+	f.config = FileConfig{
+		Dir: "/var/lib/vflow",
+		Batch: BatchConfig{
+			Size:     1000,
+			Interval: 1000,
+			Framing:  FramingNDJSON,
+		},
+	}
+
+	f.logger = logger
+
+	if err = f.load(configFile); err != nil {
+		logger.Println(err)
+		return err
+	}
+
+	f.batcher, err = newBatcher(f.config.Batch)
+	if err != nil {
+		logger.Println(err)
+		return err
+	}
+
+	return os.MkdirAll(f.config.Dir, 0755)
+}
+
+// Input appends the messages to the topic file
+func (f *File) Input(ctx context.Context, topic string, mCh chan Message, ec *uint64) error {
+	var err error
+
+	name := path.Join(f.config.Dir, topic+".json")
+	f.file, err = os.OpenFile(name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		f.logger.Println(err)
+		return err
+	}
+
+	f.logger.Printf("start producer: File, file: %s\n", name)
+
+	return f.batcher.run(ctx, mCh, ec, func(b []byte) error {
+		_, err := f.file.Write(b)
+		if err != nil {
+			f.logger.Println(err)
+		}
+
+		return err
+	})
+}
+
+// Close closes the file, the batcher has written
+// the pending batch once the channel was closed
+func (f *File) Close(ctx context.Context) error {
+	if f.file == nil {
+		return nil
+	}
+
+	return f.file.Close()
+}
+
+func (f *File) load(file string) error {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	return yaml.Unmarshal(b, &f.config)
+}
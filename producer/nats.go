@@ -23,6 +23,7 @@
 package producer
 
 import (
+	"context"
 	"io/ioutil"
 	"log"
 
@@ -34,15 +35,18 @@ import (
 type NATS struct {
 	connection *nats.Conn
 	config     NATSConfig
+	batcher    *batcher
 	logger     *log.Logger
 }
 
 // NATSConfig is the struct that holds all configuation for NATS connections
 type NATSConfig struct {
-	URL string `yaml:"url"`
+	URL   string      `yaml:"url"`
+	Batch BatchConfig `yaml:",inline"`
 }
 
-func (n *NATS) setup(configFile string, logger *log.Logger) error {
+// Setup configures the nats connection
+func (n *NATS) Setup(configFile string, logger *log.Logger) error {
 	var err error
 	n.config = NATSConfig{
 		URL: nats.DefaultURL,
@@ -53,6 +57,12 @@ func (n *NATS) setup(configFile string, logger *log.Logger) error {
 		return err
 	}
 
+	n.batcher, err = newBatcher(n.config.Batch)
+	if err != nil {
+		logger.Println(err)
+		return err
+	}
+
 	n.connection, err = nats.Connect(n.config.URL)
 	if err != nil {
 		logger.Println(err)
@@ -64,28 +74,31 @@ func (n *NATS) setup(configFile string, logger *log.Logger) error {
 	return nil
 }
 
-func (n *NATS) inputMsg(topic string, mCh chan []byte, ec *uint64) {
-	var (
-		msg []byte
-		err error
-		ok  bool
-	)
-
+// Input publishes the messages or the batches to the nats subject
+func (n *NATS) Input(ctx context.Context, topic string, mCh chan Message, ec *uint64) error {
 	n.logger.Printf("start producer: NATS, server: %+v, topic: %s\n",
 		n.config.URL, topic)
 
-	for {
-		msg, ok = <-mCh
-		if !ok {
-			break
-		}
-
-		err = n.connection.Publish(topic, msg)
+	return n.batcher.run(ctx, mCh, ec, func(b []byte) error {
+		err := n.connection.Publish(topic, b)
 		if err != nil {
 			n.logger.Println(err)
-			*ec++
 		}
+
+		return err
+	})
+}
+
+// Close flushes the buffered messages and closes the nats connection
+func (n *NATS) Close(ctx context.Context) error {
+	if n.connection == nil {
+		return nil
 	}
+
+	err := n.connection.Flush()
+	n.connection.Close()
+
+	return err
 }
 
 func (n *NATS) load(f string) error {
@@ -23,6 +23,7 @@
 package producer
 
 import (
+	"context"
 	"io/ioutil"
 	"log"
 
@@ -34,15 +35,18 @@ import (
 type NSQ struct {
 	producer *nsq.Producer
 	config   NSQConfig
+	batcher  *batcher
 	logger   *log.Logger
 }
 
 // NSQConfig represents NSQ configuration
 type NSQConfig struct {
-	Server string `yaml:"server"`
+	Server string      `yaml:"server"`
+	Batch  BatchConfig `yaml:",inline"`
 }
 
-func (n *NSQ) setup(configFile string, logger *log.Logger) error {
+// Setup configures the nsq producer
+func (n *NSQ) Setup(configFile string, logger *log.Logger) error {
 	var (
 		err error
 		cfg = nsq.NewConfig()
@@ -58,6 +62,12 @@ func (n *NSQ) setup(configFile string, logger *log.Logger) error {
 		logger.Println(err)
 	}
 
+	n.batcher, err = newBatcher(n.config.Batch)
+	if err != nil {
+		logger.Println(err)
+		return err
+	}
+
 	cfg.ClientID = "vflow.nsq"
 
 	n.producer, err = nsq.NewProducer(n.config.Server, cfg)
@@ -71,28 +81,29 @@ func (n *NSQ) setup(configFile string, logger *log.Logger) error {
 	return nil
 }
 
-func (n *NSQ) inputMsg(topic string, mCh chan []byte, ec *uint64) {
-	var (
-		msg []byte
-		err error
-		ok  bool
-	)
-
+// Input publishes the messages or the batches to the nsq topic
+func (n *NSQ) Input(ctx context.Context, topic string, mCh chan Message, ec *uint64) error {
 	n.logger.Printf("start producer: NSQ, server: %+v, topic: %s\n",
 		n.config.Server, topic)
 
-	for {
-		msg, ok = <-mCh
-		if !ok {
-			break
-		}
-
-		err = n.producer.Publish(topic, msg)
+	return n.batcher.run(ctx, mCh, ec, func(b []byte) error {
+		err := n.producer.Publish(topic, b)
 		if err != nil {
 			n.logger.Println(err)
-			*ec++
 		}
+
+		return err
+	})
+}
+
+// Close stops the nsq producer, the publish is synchronous
+// so there isn't any buffered message
+func (n *NSQ) Close(ctx context.Context) error {
+	if n.producer != nil {
+		n.producer.Stop()
 	}
+
+	return nil
 }
 
 func (n *NSQ) load(f string) error {
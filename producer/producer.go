@@ -23,7 +23,10 @@
 package producer
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"sort"
 	"sync"
 )
 
@@ -34,55 +37,138 @@ type Producer struct {
 	MQErrorCount *uint64
 
 	Topic string
-	Chan  chan []byte
+	Chan  chan Message
+	Info  Info
 
 	Logger *log.Logger
 }
 
-// MQueue represents messaging queue methods
+// Message represents a decoded message and the exporter's domain which
+// the message has been decoded from, the domain is the observation
+// domain, source id, sub agent id or engine type and id by the protocol
+// as the sequence tracker domain. The value is JSON and it's shared by
+// the sinks so the message queues shouldn't change it.
+type Message struct {
+	Value    []byte
+	Exporter string
+	Domain   uint64
+}
+
+// Info represents the producer information which is
+// available to the message queues, e.g. as kafka headers
+type Info struct {
+	Protocol string
+	Version  string
+}
+
+// InfoSetter is implemented by the message queues which use the
+// producer information, it's called before the message queue setup.
+type InfoSetter interface {
+	SetInfo(info Info)
+}
+
+// MQueue represents messaging queue methods, a message queue backend
+// implements it and registers its constructor by Register.
+//
+// The producer calls Setup once, then Input to produce the messages
+// and finally Close once Input returned, the context of Close is
+// canceled if the buffered messages can't be flushed before the deadline.
 type MQueue interface {
-	setup(string, *log.Logger) error
-	inputMsg(string, chan []byte, *uint64)
+	// Setup configures the message queue by the configuration file
+	Setup(configFile string, logger *log.Logger) error
+
+	// Input produces the channel messages to the topic until the channel
+	// is closed or the context is canceled, the failed messages are
+	// counted by the error counter atomically
+	Input(ctx context.Context, topic string, mCh chan Message, ec *uint64) error
+
+	// Close flushes the buffered messages until the context
+	// is canceled and releases the connection
+	Close(ctx context.Context) error
+}
+
+var (
+	mqMu         sync.RWMutex
+	mqRegistered = map[string]func() MQueue{}
+)
+
+func init() {
+	Register("kafka", func() MQueue { return new(KafkaSarama) })
+	Register("kafka.sarama", func() MQueue { return new(KafkaSarama) })
+	Register("kafka.segmentio", func() MQueue { return new(KafkaSegmentio) })
+	Register("nsq", func() MQueue { return new(NSQ) })
+	Register("nats", func() MQueue { return new(NATS) })
+	Register("rawSocket", func() MQueue { return new(RawSocket) })
+	Register("file", func() MQueue { return new(File) })
+}
+
+// Register makes a message queue available by the name, the constructor
+// is called per producer. It panics if the name is already registered.
+func Register(name string, fn func() MQueue) {
+	mqMu.Lock()
+	defer mqMu.Unlock()
+
+	if fn == nil {
+		panic("producer: register nil message queue " + name)
+	}
+
+	if _, ok := mqRegistered[name]; ok {
+		panic("producer: register message queue twice " + name)
+	}
+
+	mqRegistered[name] = fn
+}
+
+// MQueues returns the sorted list of the registered message queues
+func MQueues() []string {
+	mqMu.RLock()
+	defer mqMu.RUnlock()
+
+	names := make([]string, 0, len(mqRegistered))
+	for name := range mqRegistered {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
 }
 
 // NewProducer constructs new Messaging Queue
-func NewProducer(mqName string) *Producer {
-	var mqRegistered = map[string]MQueue{
-		"kafka":           new(KafkaSarama),
-		"kafka.sarama":    new(KafkaSarama),
-		"kafka.segmentio": new(KafkaSegmentio),
-		"nsq":             new(NSQ),
-		"nats":            new(NATS),
-		"rawSocket":       new(RawSocket),
+func NewProducer(mqName string) (*Producer, error) {
+	mqMu.RLock()
+	fn, ok := mqRegistered[mqName]
+	mqMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown message queue: %q (available: %v)", mqName, MQueues())
 	}
 
 	return &Producer{
-		MQ: mqRegistered[mqName],
-	}
+		MQ: fn(),
+	}, nil
 }
 
-// Run configs and tries to be ready to produce
-func (p *Producer) Run() error {
-	var (
-		wg  sync.WaitGroup
-		err error
-	)
+// Run configs the message queue and produces the messages until
+// the channel is closed or the context is canceled, then it closes
+// the message queue to flush the buffered messages.
+func (p *Producer) Run(ctx context.Context) error {
+	if s, ok := p.MQ.(InfoSetter); ok {
+		s.SetInfo(p.Info)
+	}
 
-	err = p.MQ.setup(p.MQConfigFile, p.Logger)
+	err := p.MQ.Setup(p.MQConfigFile, p.Logger)
 	if err != nil {
 		return err
 	}
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		topic := p.Topic
-		p.MQ.inputMsg(topic, p.Chan, p.MQErrorCount)
-	}()
+	err = p.MQ.Input(ctx, p.Topic, p.Chan, p.MQErrorCount)
 
-	wg.Wait()
+	if cErr := p.MQ.Close(ctx); err == nil {
+		err = cErr
+	}
 
-	return nil
+	return err
 }
 
 // Shutdown stops the producer
@@ -23,30 +23,46 @@
 package producer
 
 import (
+	"context"
+	"io/ioutil"
 	"log"
+	"path"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 )
 
-type MQMock struct{}
+type MQMock struct {
+	closed bool
+}
 
-func (k *MQMock) setup(configFile string, logger *log.Logger) error {
+func (k *MQMock) Setup(configFile string, logger *log.Logger) error {
 	return nil
 }
 
-func (k *MQMock) inputMsg(topic string, mCh chan []byte, ec *uint64) {
+func (k *MQMock) Input(ctx context.Context, topic string, mCh chan Message, ec *uint64) error {
 	for {
-		msg, ok := <-mCh
-		if !ok {
-			break
+		select {
+		case msg, ok := <-mCh:
+			if !ok {
+				return nil
+			}
+			mCh <- msg
+		case <-ctx.Done():
+			return ctx.Err()
 		}
-		mCh <- msg
 	}
 }
 
+func (k *MQMock) Close(ctx context.Context) error {
+	k.closed = true
+	return nil
+}
+
 func TestProducerChan(t *testing.T) {
 	var (
-		ch = make(chan []byte, 1)
+		ch = make(chan Message, 1)
 		wg sync.WaitGroup
 	)
 
@@ -56,18 +72,145 @@ func TestProducerChan(t *testing.T) {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		if err := p.Run(); err != nil {
+		if err := p.Run(context.Background()); err != nil {
 			t.Error("unexpected error", err)
 		}
 	}()
 
-	ch <- []byte("test")
+	ch <- Message{Value: []byte("test")}
 	m := <-ch
-	if string(m) != "test" {
-		t.Error("expect to get test, got", string(m))
+	if string(m.Value) != "test" {
+		t.Error("expect to get test, got", string(m.Value))
 	}
 
 	close(ch)
 
 	wg.Wait()
 }
+
+func TestProducerContext(t *testing.T) {
+	var (
+		mq          = new(MQMock)
+		ctx, cancel = context.WithCancel(context.Background())
+		done        = make(chan error)
+	)
+
+	p := Producer{MQ: mq, Chan: make(chan Message)}
+
+	go func() {
+		done <- p.Run(ctx)
+	}()
+
+	cancel()
+
+	if err := <-done; err != context.Canceled {
+		t.Error("expect context canceled error, got", err)
+	}
+
+	if !mq.closed {
+		t.Error("expect the message queue is closed")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Register("mock", func() MQueue { return new(MQMock) })
+
+	p, err := NewProducer("mock")
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if _, ok := p.MQ.(*MQMock); !ok {
+		t.Errorf("expect MQMock, got %T", p.MQ)
+	}
+
+	_, err = NewProducer("kafak")
+	if err == nil || !strings.Contains(err.Error(), "kafak") {
+		t.Error("expect unknown message queue error, got", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expect panic on the duplicate registration")
+		}
+	}()
+
+	Register("mock", func() MQueue { return new(MQMock) })
+}
+
+func TestFile(t *testing.T) {
+	var (
+		dir    = t.TempDir()
+		conf   = path.Join(dir, "file.conf")
+		ch     = make(chan Message, 2)
+		logger = log.New(ioutil.Discard, "", 0)
+	)
+
+	ioutil.WriteFile(conf, []byte("dir: "+dir+"\n"), 0644)
+
+	p, err := NewProducer("file")
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	p.MQConfigFile = conf
+	p.Logger = logger
+	p.Topic = "vflow.ipfix"
+	p.Chan = ch
+
+	ch <- Message{Value: []byte(`{"a":1}`)}
+	ch <- Message{Value: []byte(`{"a":2}`)}
+	close(ch)
+
+	if err := p.Run(context.Background()); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	b, err := ioutil.ReadFile(path.Join(dir, "vflow.ipfix.json"))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if string(b) != "{\"a\":1}\n{\"a\":2}\n" {
+		t.Errorf("unexpected file content %q", b)
+	}
+}
+
+func TestFileInterval(t *testing.T) {
+	var (
+		dir    = t.TempDir()
+		conf   = path.Join(dir, "file.conf")
+		ch     = make(chan Message, 1)
+		ec     uint64
+		logger = log.New(ioutil.Discard, "", 0)
+		f      = new(File)
+	)
+
+	ioutil.WriteFile(conf, []byte("dir: "+dir+"\nbatch-interval: 10\n"), 0644)
+
+	if err := f.Setup(conf, logger); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- f.Input(ctx, "vflow.sflow", ch, &ec)
+	}()
+
+	ch <- Message{Value: []byte(`{"a":1}`)}
+
+	var b []byte
+	for i := 0; i < 100 && len(b) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		b, _ = ioutil.ReadFile(path.Join(dir, "vflow.sflow.json"))
+	}
+
+	cancel()
+	<-done
+	f.Close(ctx)
+
+	if string(b) != "{\"a\":1}\n" || ec != 0 {
+		t.Errorf("unexpected file content %q, errors %d", b, ec)
+	}
+}
@@ -23,35 +23,41 @@
 package producer
 
 import (
+	"context"
 	"io/ioutil"
 	"log"
+	"net"
 	"strings"
 
-	"fmt"
 	"gopkg.in/yaml.v2"
-	"net"
 )
 
 // RawSocket represents RawSocket producer
 type RawSocket struct {
 	connection net.Conn
 	config     RawSocketConfig
+	batcher    *batcher
 	logger     *log.Logger
 }
 
 // RawSocketConfig is the struct that holds all configuation for RawSocketConfig connections
 type RawSocketConfig struct {
-	URL      string `yaml:"url"`
-	Protocol string `yaml:"protocol"`
-	MaxRetry int    `yaml:"retry-max"`
+	URL      string      `yaml:"url"`
+	Protocol string      `yaml:"protocol"`
+	MaxRetry int         `yaml:"retry-max"`
+	Batch    BatchConfig `yaml:",inline"`
 }
 
-func (rs *RawSocket) setup(configFile string, logger *log.Logger) error {
+// Setup configures and connects the raw socket
+func (rs *RawSocket) Setup(configFile string, logger *log.Logger) error {
 	var err error
 	rs.config = RawSocketConfig{
 		URL:      "localhost:9555",
 		Protocol: "tcp",
 		MaxRetry: 2,
+		Batch: BatchConfig{
+			Framing: FramingNDJSON,
+		},
 	}
 
 	if err = rs.load(configFile); err != nil {
@@ -59,6 +65,12 @@ func (rs *RawSocket) setup(configFile string, logger *log.Logger) error {
 		return err
 	}
 
+	rs.batcher, err = newBatcher(rs.config.Batch)
+	if err != nil {
+		logger.Println(err)
+		return err
+	}
+
 	rs.connection, err = net.Dial(rs.config.Protocol, rs.config.URL)
 	if err != nil {
 		logger.Println(err)
@@ -70,50 +82,54 @@ func (rs *RawSocket) setup(configFile string, logger *log.Logger) error {
 	return nil
 }
 
-func (rs *RawSocket) inputMsg(topic string, mCh chan []byte, ec *uint64) {
-	var (
-		msg []byte
-		err error
-		ok  bool
-	)
-
+// Input writes the framed messages or the batches to the raw socket
+func (rs *RawSocket) Input(ctx context.Context, topic string, mCh chan Message, ec *uint64) error {
 	rs.logger.Printf("start producer: RawSocket, server: %+v, Protocol: %s\n",
 		rs.config.URL, rs.config.Protocol)
 
-	for {
-		msg, ok = <-mCh
-		if !ok {
-			break
-		}
-
-		for i := 0; ; i++ {
-			_, err = fmt.Fprintf(rs.connection, string(msg)+"\n")
-			if err == nil {
-				break
-			}
+	return rs.batcher.run(ctx, mCh, ec, rs.write)
+}
 
-			*ec++
+// write writes the data to the connection, it reconnects
+// on the broken pipe and retries up to the retry limit
+func (rs *RawSocket) write(b []byte) error {
+	var err error
 
-			if strings.HasSuffix(err.Error(), "broken pipe") {
-				var newConnection, err = net.Dial(rs.config.Protocol, rs.config.URL)
-				if err != nil {
-					rs.logger.Println("Error when attempting to fix the broken pipe", err)
-				} else {
-					rs.logger.Println("Successfully reconnected")
-					rs.connection = newConnection
-				}
-			}
+	for i := 0; ; i++ {
+		_, err = rs.connection.Write(b)
+		if err == nil {
+			return nil
+		}
 
-			if i >= (rs.config.MaxRetry) {
-				rs.logger.Println("message failed after the configured retry limit:", err)
-				break
+		if strings.HasSuffix(err.Error(), "broken pipe") {
+			conn, dErr := net.Dial(rs.config.Protocol, rs.config.URL)
+			if dErr != nil {
+				rs.logger.Println("Error when attempting to fix the broken pipe", dErr)
 			} else {
-				rs.logger.Println("retrying after error:", err)
+				rs.logger.Println("Successfully reconnected")
+				rs.connection.Close()
+				rs.connection = conn
 			}
 		}
+
+		if i >= rs.config.MaxRetry {
+			rs.logger.Println("message failed after the configured retry limit:", err)
+			return err
+		}
+
+		rs.logger.Println("retrying after error:", err)
 	}
 }
 
+// Close closes the raw socket connection
+func (rs *RawSocket) Close(ctx context.Context) error {
+	if rs.connection == nil {
+		return nil
+	}
+
+	return rs.connection.Close()
+}
+
 func (rs *RawSocket) load(f string) error {
 	b, err := ioutil.ReadFile(f)
 	if err != nil {
@@ -0,0 +1,194 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    record.go
+//: details: kafka record key and headers
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package producer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const (
+	// KeyExporter keys the records by the exporter address
+	KeyExporter = "exporter"
+
+	// KeyDomain keys the records by the exporter address and the
+	// observation domain, source id, sub agent id or engine type and id
+	KeyDomain = "domain"
+
+	// KeyField keys the records by the value of the message field path,
+	// the path elements are separated by dot and an array element is
+	// selected by its index or by a field value, e.g. DataSets.0.I=8.V
+	KeyField = "field:"
+)
+
+var errUnknownKey = errors.New("unknown record key")
+
+// record builds the record key and headers of the messages, the exporter
+// and the domain come with the message from the worker and the message
+// is only decoded to find the field key.
+type record struct {
+	key     string
+	path    []string
+	headers bool
+
+	protocol []byte
+	version  []byte
+}
+
+// recordHeader represents a record header, it's
+// converted to the kafka driver record header
+type recordHeader struct {
+	key   string
+	value []byte
+}
+
+func newRecord(key string, headers bool, info Info) (*record, error) {
+	r := &record{
+		key:      key,
+		headers:  headers,
+		protocol: []byte(info.Protocol),
+		version:  []byte(info.Version),
+	}
+
+	switch {
+	case key == "", key == KeyExporter, key == KeyDomain:
+	case strings.HasPrefix(key, KeyField) && len(key) > len(KeyField):
+		r.key = KeyField
+		r.path = strings.Split(key[len(KeyField):], ".")
+	default:
+		return nil, errUnknownKey
+	}
+
+	return r, nil
+}
+
+// build returns the record key and headers of the message, the key
+// is nil if it's not configured or the message doesn't have the key
+func (r *record) build(msg Message) ([]byte, []recordHeader) {
+	var key, exporter []byte
+
+	if msg.Exporter != "" && (r.headers || r.key == KeyExporter || r.key == KeyDomain) {
+		exporter = make([]byte, len(msg.Exporter), len(msg.Exporter)+21)
+		copy(exporter, msg.Exporter)
+	}
+
+	switch r.key {
+	case KeyExporter:
+		key = exporter
+	case KeyDomain:
+		if exporter != nil {
+			key = append(exporter, '/')
+			key = strconv.AppendUint(key, msg.Domain, 10)
+			exporter = key[:len(msg.Exporter)]
+		}
+	case KeyField:
+		key = lookup(msg.Value, r.path)
+	}
+
+	if !r.headers {
+		return key, nil
+	}
+
+	headers := make([]recordHeader, 2, 3)
+	headers[0] = recordHeader{"protocol", r.protocol}
+	headers[1] = recordHeader{"vflow-version", r.version}
+
+	if exporter != nil {
+		headers = append(headers, recordHeader{"exporter", exporter})
+	}
+
+	return key, headers
+}
+
+// lookup returns the value of the path in the JSON message, the
+// objects and the arrays are returned as JSON
+func lookup(msg []byte, path []string) []byte {
+	var v interface{}
+
+	d := json.NewDecoder(bytes.NewReader(msg))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return nil
+	}
+
+	for _, p := range path {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			v = t[p]
+		case []interface{}:
+			v = element(t, p)
+		default:
+			return nil
+		}
+	}
+
+	switch t := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return []byte(t)
+	case json.Number:
+		return []byte(t)
+	default:
+		b, _ := json.Marshal(t)
+		return b
+	}
+}
+
+// element returns the array element by its index or the first
+// object element which its field has the value, e.g. I=8
+func element(a []interface{}, p string) interface{} {
+	if i, err := strconv.Atoi(p); err == nil {
+		if i < 0 || i >= len(a) {
+			return nil
+		}
+		return a[i]
+	}
+
+	field, fv, ok := strings.Cut(p, "=")
+	if !ok {
+		return nil
+	}
+
+	for _, e := range a {
+		if o, ok := e.(map[string]interface{}); ok && scalar(o[field]) == fv {
+			return e
+		}
+	}
+
+	return nil
+}
+
+func scalar(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case json.Number:
+		return string(t)
+	case bool:
+		return strconv.FormatBool(t)
+	}
+
+	return ""
+}
@@ -0,0 +1,150 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    record_test.go
+//: details: TODO
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package producer
+
+import (
+	"testing"
+)
+
+var (
+	ipfixMsg = Message{
+		Value: []byte(`{"AgentID":"192.168.1.1","Header":{"Version":10,"DomainID":33792},` +
+			`"DataSets":[[{"I":8,"V":"10.0.0.1"},{"I":12,"V":"10.0.0.2"}]]}`),
+		Exporter: "192.168.1.1",
+		Domain:   33792,
+	}
+	sflowMsg = Message{
+		Value:    []byte(`{"Version":5,"AgentSubID":5,"Samples":[{"Name":"a}\\\"]"}],"IPAddress":"192.168.1.2"}`),
+		Exporter: "192.168.1.2",
+		Domain:   5,
+	}
+)
+
+func TestRecordKey(t *testing.T) {
+	cases := []struct {
+		key      string
+		msg      Message
+		expected string
+	}{
+		{"", ipfixMsg, ""},
+		{KeyExporter, ipfixMsg, "192.168.1.1"},
+		{KeyExporter, sflowMsg, "192.168.1.2"},
+		{KeyDomain, ipfixMsg, "192.168.1.1/33792"},
+		{KeyDomain, sflowMsg, "192.168.1.2/5"},
+		{KeyDomain, Message{Value: ipfixMsg.Value, Domain: 1}, ""},
+		{"field:Samples.0.Name", sflowMsg, `a}\"]`},
+		{"field:DataSets.0.I=8.V", ipfixMsg, "10.0.0.1"},
+		{"field:DataSets.0.1.V", ipfixMsg, "10.0.0.2"},
+		{"field:Header.Version", ipfixMsg, "10"},
+		{"field:Header", ipfixMsg, `{"DomainID":33792,"Version":10}`},
+		{"field:DataSets.0.I=7.V", ipfixMsg, ""},
+		{"field:DataSets.0.5.V", ipfixMsg, ""},
+		{"field:Header.Version", Message{Value: []byte("not json")}, ""},
+	}
+
+	for _, c := range cases {
+		r, err := newRecord(c.key, false, Info{})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.key, err)
+		}
+
+		if key, _ := r.build(c.msg); string(key) != c.expected {
+			t.Errorf("%s: expect key %q, got %q", c.key, c.expected, key)
+		}
+	}
+
+	// the truncated messages don't have the key
+	r, _ := newRecord("field:DataSets.0.I=12.V", true, Info{})
+	for i := 0; i < len(ipfixMsg.Value)-2; i++ {
+		if key, _ := r.build(Message{Value: ipfixMsg.Value[:i]}); key != nil {
+			t.Errorf("expect no key, got %q", key)
+		}
+	}
+
+	for _, key := range []string{"agent", "field:"} {
+		if _, err := newRecord(key, false, Info{}); err != errUnknownKey {
+			t.Errorf("%s: expect unknown key error, got %v", key, err)
+		}
+	}
+}
+
+func TestRecordHeaders(t *testing.T) {
+	r, _ := newRecord("", false, Info{})
+	if _, headers := r.build(ipfixMsg); headers != nil {
+		t.Error("expect no headers, got", headers)
+	}
+
+	r, _ = newRecord(KeyDomain, true, Info{Protocol: "ipfix", Version: "0.9.0"})
+	key, headers := r.build(ipfixMsg)
+	expected := map[string]string{
+		"protocol":      "ipfix",
+		"vflow-version": "0.9.0",
+		"exporter":      "192.168.1.1",
+	}
+
+	if string(key) != "192.168.1.1/33792" {
+		t.Error("unexpected key", string(key))
+	}
+
+	if len(headers) != len(expected) {
+		t.Fatalf("expect %d headers, got %d", len(expected), len(headers))
+	}
+
+	for _, h := range headers {
+		if string(h.value) != expected[h.key] {
+			t.Errorf("header %s: expect %q, got %q", h.key, expected[h.key], h.value)
+		}
+	}
+}
+
+func TestRecordAllocs(t *testing.T) {
+	r, _ := newRecord(KeyDomain, true, Info{Protocol: "ipfix", Version: "0.9.0"})
+
+	// the domain key which the exporter header refers to and the headers slice
+	allocs := testing.AllocsPerRun(100, func() {
+		r.build(ipfixMsg)
+	})
+	if allocs > 2 {
+		t.Error("expect at most 2 allocations, got", allocs)
+	}
+}
+
+func TestPartitioner(t *testing.T) {
+	for _, name := range []string{"", "hash", "crc32", "random", "roundrobin"} {
+		if _, err := saramaPartitioner(name); err != nil {
+			t.Errorf("sarama %s: unexpected error: %v", name, err)
+		}
+	}
+
+	for _, name := range []string{"", "hash", "crc32", "murmur2", "random", "roundrobin"} {
+		if _, err := segmentioBalancer(name); err != nil {
+			t.Errorf("segmentio %s: unexpected error: %v", name, err)
+		}
+	}
+
+	if _, err := saramaPartitioner("sticky"); err == nil {
+		t.Error("expect sarama unknown partitioner error")
+	}
+
+	if _, err := segmentioBalancer("sticky"); err == nil {
+		t.Error("expect segmentio unknown partitioner error")
+	}
+}
@@ -23,14 +23,19 @@
 package producer
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"fmt"
+	"hash"
+	"hash/crc32"
 	"io/ioutil"
 	"log"
 	"os"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/Shopify/sarama"
@@ -40,7 +45,11 @@ import (
 // KafkaSarama represents kafka producer
 type KafkaSarama struct {
 	producer sarama.AsyncProducer
+	inflight uint64
+	ec       *uint64
 	config   KafkaSaramaConfig
+	record   *record
+	info     Info
 	logger   *log.Logger
 }
 
@@ -58,9 +67,13 @@ type KafkaSaramaConfig struct {
 	TLSSkipVerify  bool     `yaml:"tls-skip-verify" env:"TLS_SKIP_VERIFY"`
 	SASLUsername   string   `yaml:"sasl-username" env:"SASL_USERNAME"`
 	SASLPassword   string   `yaml:"sasl-password" env:"SASL_PASSWORD"`
+	Key            string   `yaml:"key" env:"KEY"`
+	Headers        bool     `yaml:"headers" env:"HEADERS"`
+	Partitioner    string   `yaml:"partitioner" env:"PARTITIONER"`
 }
 
-func (k *KafkaSarama) setup(configFile string, logger *log.Logger) error {
+// Setup configures the kafka producer
+func (k *KafkaSarama) Setup(configFile string, logger *log.Logger) error {
 	var (
 		config = sarama.NewConfig()
 		err    error
@@ -87,6 +100,7 @@ func (k *KafkaSarama) setup(configFile string, logger *log.Logger) error {
 	config.ClientID = "vFlow.Kafka"
 	config.Producer.Retry.Max = k.config.RetryMax
 	config.Producer.Retry.Backoff = time.Duration(k.config.RetryBackoff) * time.Millisecond
+	config.Producer.Return.Successes = true
 
 	sarama.MaxRequestSize = k.config.RequestSizeMax
 
@@ -121,6 +135,16 @@ func (k *KafkaSarama) setup(configFile string, logger *log.Logger) error {
 	// get env config
 	k.loadEnv("VFLOW_KAFKA")
 
+	config.Producer.Partitioner, err = saramaPartitioner(k.config.Partitioner)
+	if err != nil {
+		return err
+	}
+
+	k.record, err = newRecord(k.config.Key, k.config.Headers, k.info)
+	if err != nil {
+		return err
+	}
+
 	if err = config.Validate(); err != nil {
 		logger.Fatal(err)
 	}
@@ -133,33 +157,115 @@ func (k *KafkaSarama) setup(configFile string, logger *log.Logger) error {
 	return nil
 }
 
-func (k *KafkaSarama) inputMsg(topic string, mCh chan []byte, ec *uint64) {
+// Input produces the messages to the kafka topic
+func (k *KafkaSarama) Input(ctx context.Context, topic string, mCh chan Message, ec *uint64) error {
 	var (
-		msg []byte
+		msg Message
 		ok  bool
 	)
 
 	k.logger.Printf("start producer: Kafka, brokers: %+v, topic: %s\n",
 		k.config.Brokers, topic)
 
+	k.ec = ec
+
 	for {
-		msg, ok = <-mCh
-		if !ok {
-			break
+		select {
+		case msg, ok = <-mCh:
+			if !ok {
+				return nil
+			}
+		case <-k.producer.Successes():
+			k.inflight--
+			continue
+		case err := <-k.producer.Errors():
+			k.fail(err)
+			continue
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		m := k.message(topic, msg)
+		for sent := false; !sent; {
+			select {
+			case k.producer.Input() <- m:
+				k.inflight++
+				sent = true
+			case <-k.producer.Successes():
+				k.inflight--
+			case err := <-k.producer.Errors():
+				k.fail(err)
+			case <-ctx.Done():
+				atomic.AddUint64(ec, 1)
+				return ctx.Err()
+			}
 		}
+	}
+}
+
+func (k *KafkaSarama) fail(err *sarama.ProducerError) {
+	k.logger.Println(err)
+	k.inflight--
+	atomic.AddUint64(k.ec, 1)
+}
+
+// SetInfo sets the producer information for the record headers
+func (k *KafkaSarama) SetInfo(info Info) {
+	k.info = info
+}
+
+func (k *KafkaSarama) message(topic string, msg Message) *sarama.ProducerMessage {
+	m := &sarama.ProducerMessage{
+		Topic: topic,
+		Value: sarama.ByteEncoder(msg.Value),
+	}
+
+	key, headers := k.record.build(msg)
+	if key != nil {
+		m.Key = sarama.ByteEncoder(key)
+	}
+
+	for _, h := range headers {
+		m.Headers = append(m.Headers, sarama.RecordHeader{Key: []byte(h.key), Value: h.value})
+	}
+
+	return m
+}
+
+// Close flushes the buffered messages and closes the kafka producer,
+// the messages which haven't been acknowledged before the context
+// is done are counted as failed.
+func (k *KafkaSarama) Close(ctx context.Context) error {
+	if k.producer == nil {
+		return nil
+	}
+
+	k.producer.AsyncClose()
 
+	successes, errors := k.producer.Successes(), k.producer.Errors()
+	for successes != nil || errors != nil {
 		select {
-		case k.producer.Input() <- &sarama.ProducerMessage{
-			Topic: topic,
-			Value: sarama.ByteEncoder(msg),
-		}:
-		case err := <-k.producer.Errors():
-			k.logger.Println(err)
-			*ec++
+		case _, ok := <-successes:
+			if !ok {
+				successes = nil
+				continue
+			}
+			k.inflight--
+		case err, ok := <-errors:
+			if !ok {
+				errors = nil
+				continue
+			}
+			k.fail(err)
+		case <-ctx.Done():
+			if k.ec != nil {
+				atomic.AddUint64(k.ec, k.inflight)
+			}
+			return ctx.Err()
 		}
 	}
 
-	k.producer.Close()
+	return nil
 }
 
 func (k *KafkaSarama) load(f string) error {
@@ -242,3 +348,20 @@ func (k *KafkaSarama) loadEnv(prefix string) {
 		}
 	}
 }
+
+func saramaPartitioner(name string) (sarama.PartitionerConstructor, error) {
+	switch name {
+	case "", "hash":
+		return sarama.NewHashPartitioner, nil
+	case "reference-hash":
+		return sarama.NewReferenceHashPartitioner, nil
+	case "crc32":
+		return sarama.NewCustomHashPartitioner(func() hash.Hash32 { return crc32.NewIEEE() }), nil
+	case "random":
+		return sarama.NewRandomPartitioner, nil
+	case "roundrobin":
+		return sarama.NewRoundRobinPartitioner, nil
+	}
+
+	return nil, fmt.Errorf("unknown kafka.sarama partitioner: %s", name)
+}
@@ -26,13 +26,16 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"fmt"
 	"io/ioutil"
 	"log"
+	"math/rand"
 	"net"
 	"os"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/segmentio/kafka-go"
@@ -46,7 +49,11 @@ import (
 type KafkaSegmentio struct {
 	producer *kafka.Writer
 	config   KafkaSegmentioConfig
+	record   *record
+	info     Info
+	ec       *uint64
 	logger   *log.Logger
+	batch    []kafka.Message
 }
 
 // KafkaSegmentioConfig represents kafka configuration
@@ -67,9 +74,13 @@ type KafkaSegmentioConfig struct {
 	TLSKeyFile      string   `yaml:"tls-key" env:"TLS_KEY"`
 	CAFile          string   `yaml:"ca-file" env:"CA_FILE"`
 	VerifySSL       bool     `yaml:"verify-ssl" env:"VERIFY_SSL"`
+	Key             string   `yaml:"key" env:"KEY"`
+	Headers         bool     `yaml:"headers" env:"HEADERS"`
+	Partitioner     string   `yaml:"partitioner" env:"PARTITIONER"`
 }
 
-func (k *KafkaSegmentio) setup(configFile string, logger *log.Logger) error {
+// Setup configures the kafka writer
+func (k *KafkaSegmentio) Setup(configFile string, logger *log.Logger) error {
 	var err error
 
 	// set default values
@@ -107,6 +118,16 @@ func (k *KafkaSegmentio) setup(configFile string, logger *log.Logger) error {
 		}
 	}
 
+	balancer, err := segmentioBalancer(k.config.Partitioner)
+	if err != nil {
+		return err
+	}
+
+	k.record, err = newRecord(k.config.Key, k.config.Headers, k.info)
+	if err != nil {
+		return err
+	}
+
 	// init kafka configuration
 	k.config.run = kafka.WriterConfig{
 		Brokers: k.config.Brokers,
@@ -116,7 +137,7 @@ func (k *KafkaSegmentio) setup(configFile string, logger *log.Logger) error {
 			KeepAlive: time.Second * time.Duration(k.config.KeepAlive),
 			DualStack: true,
 		},
-		Balancer:      &kafka.Hash{},
+		Balancer:      balancer,
 		MaxAttempts:   k.config.MaxAttempts,
 		QueueCapacity: k.config.QueueSize,
 		BatchSize:     k.config.BatchSize,
@@ -143,14 +164,17 @@ func (k *KafkaSegmentio) setup(configFile string, logger *log.Logger) error {
 	return err
 }
 
-func (k *KafkaSegmentio) inputMsg(topic string, mCh chan []byte, ec *uint64) {
+// Input produces the messages to the kafka topic in batches, the
+// batch is written once it's full or by the periodic flush
+func (k *KafkaSegmentio) Input(ctx context.Context, topic string, mCh chan Message, ec *uint64) error {
 
 	k.config.run.Topic = topic
 	k.logger.Printf("start producer: Kafka, brokers: %+v, topic: %s\n",
 		k.config.run.Brokers, k.config.run.Topic)
 	k.producer = kafka.NewWriter(k.config.run)
 
-	batch := make([]kafka.Message, 0, k.config.BatchSize)
+	k.batch = make([]kafka.Message, 0, k.config.BatchSize)
+	k.ec = ec
 
 	var shutdown = false
 	var pflush = false
@@ -160,40 +184,89 @@ func (k *KafkaSegmentio) inputMsg(topic string, mCh chan []byte, ec *uint64) {
 		select {
 		case message, ok := <-mCh:
 			if ok {
-				batch = append(batch, kafka.Message{Value: message})
+				k.batch = append(k.batch, k.message(message))
 			} else {
 				shutdown = true
 			}
 		case <-pftimer.C:
 			pflush = true
+		case <-ctx.Done():
+			// the pending batch can't be written anymore
+			pftimer.Stop()
+			atomic.AddUint64(ec, uint64(len(k.batch)))
+			k.batch = k.batch[:0]
+			return ctx.Err()
 		}
 
-		if len(batch) == k.config.BatchSize || shutdown || pflush {
+		if len(k.batch) == k.config.BatchSize || shutdown || pflush {
 
 			if !pftimer.Stop() {
 				pflush = false
 			}
 
-			err := k.producer.WriteMessages(context.Background(), batch...)
-
-			if err != nil {
-				k.logger.Printf("error writing to kafka: %v", err)
-				*ec++
-			}
+			k.flush(ctx)
 
 			if shutdown {
-				k.logger.Printf("shutting down kafka writer, flushed %d records", len(batch))
-				break
+				return nil
 			}
 
 			pftimer.Reset(time.Second * time.Duration(k.config.PeriodicFlush))
-			batch = nil
 		}
 	}
+}
+
+// SetInfo sets the producer information for the record headers
+func (k *KafkaSegmentio) SetInfo(info Info) {
+	k.info = info
+}
+
+func (k *KafkaSegmentio) message(msg Message) kafka.Message {
+	key, headers := k.record.build(msg)
+
+	m := kafka.Message{
+		Key:   key,
+		Value: msg.Value,
+	}
 
-	if err := k.producer.Close(); err != nil {
+	for _, h := range headers {
+		m.Headers = append(m.Headers, kafka.Header{Key: h.key, Value: h.value})
+	}
+
+	return m
+}
+
+// Close writes the pending batch until the context is canceled
+// and closes the kafka writer
+func (k *KafkaSegmentio) Close(ctx context.Context) error {
+	if k.producer == nil {
+		return nil
+	}
+
+	if len(k.batch) > 0 {
+		k.logger.Printf("shutting down kafka writer, flushing %d records", len(k.batch))
+		k.flush(ctx)
+	}
+
+	err := k.producer.Close()
+	if err != nil {
 		k.logger.Printf("error shutting down kafka writer: %v", err)
 	}
+
+	return err
+}
+
+// flush writes the batch, the writer isn't async so the batch could be
+// reused, the messages of the failed batch are counted by the error counter
+func (k *KafkaSegmentio) flush(ctx context.Context) error {
+	err := k.producer.WriteMessages(ctx, k.batch...)
+	if err != nil {
+		k.logger.Printf("error writing to kafka: %v", err)
+		atomic.AddUint64(k.ec, uint64(len(k.batch)))
+	}
+
+	k.batch = k.batch[:0]
+
+	return err
 }
 
 func (k *KafkaSegmentio) load(f string) error {
@@ -299,3 +372,22 @@ func bootstrapLookup(endpoint string) ([]string, error) {
 
 	return brokers, err
 }
+
+func segmentioBalancer(name string) (kafka.Balancer, error) {
+	switch name {
+	case "", "hash":
+		return &kafka.Hash{}, nil
+	case "crc32":
+		return kafka.CRC32Balancer{}, nil
+	case "murmur2":
+		return kafka.Murmur2Balancer{}, nil
+	case "random":
+		return kafka.BalancerFunc(func(msg kafka.Message, partitions ...int) int {
+			return partitions[rand.Intn(len(partitions))]
+		}), nil
+	case "roundrobin":
+		return &kafka.RoundRobin{}, nil
+	}
+
+	return nil, fmt.Errorf("unknown kafka.segmentio partitioner: %s", name)
+}
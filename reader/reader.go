@@ -125,6 +125,12 @@ func (r *Reader) Len() int {
 	return len(r.data)
 }
 
+// Reset resets the reader to read from b
+func (r *Reader) Reset(b []byte) {
+	r.data = b
+	r.count = 0
+}
+
 func (r *Reader) advance(num int) {
 	r.data = r.data[num:]
 	r.count += num
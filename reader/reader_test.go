@@ -122,3 +122,22 @@ func TestReadCount(t *testing.T) {
 	r.Read(3)
 	check(18)
 }
+
+func TestReset(t *testing.T) {
+	r := NewReader([]byte{0x01, 0x02})
+	r.Uint16()
+
+	r.Reset([]byte{0x05, 0x11, 0x01})
+	if r.Len() != 3 || r.ReadCount() != 0 {
+		t.Error("expect length 3 and count 0, got", r.Len(), r.ReadCount())
+	}
+
+	i, err := r.Uint16()
+	if err != nil {
+		t.Error("unexpected error happened, got", err)
+	}
+
+	if i != 0x0511 {
+		t.Error("expect read 0x0511, got", i)
+	}
+}
@@ -0,0 +1,2 @@
+// Package sequence tracks the flow export sequence numbers per exporter
+package sequence
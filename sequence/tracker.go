@@ -0,0 +1,252 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    tracker.go
+//: details: flow export sequence numbers tracking
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package sequence
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// maxGaps is the number of the recent gaps that are kept per domain
+	// to match the late packets against them
+	maxGaps = 16
+
+	// idleTimeout is the duration that a domain is kept without updates
+	idleTimeout = time.Hour
+)
+
+// Tracker tracks the sequence numbers of the exporters per
+// domain (observation domain, source id or sub agent). The
+// sequence number of a packet is expected to be the sequence
+// number of the previous packet plus its number of units which
+// could be flow records, samples or packets based on the protocol.
+type Tracker struct {
+	maxGap  uint32
+	lock    sync.Mutex
+	streams map[key]*stream
+	swept   time.Time
+	now     func() time.Time
+}
+
+// Stats represents the sequence stats of an exporter's domain
+type Stats struct {
+	Exporter   string
+	Domain     uint64
+	Sequence   uint32 // Last sequence number in order
+	Received   uint64 // Number of received packets
+	Lost       uint64 // Estimated number of lost units
+	Gaps       uint64 // Number of sequence gaps
+	Resets     uint64 // Number of sequence resets
+	Reordered  uint64 // Number of late packets that filled a gap
+	Duplicates uint64 // Number of duplicate or unexpected late packets
+	Drops      uint64 // Number of drops that the exporter reported
+}
+
+type key struct {
+	exporter string
+	domain   uint64
+}
+
+type stream struct {
+	Stats
+	expected uint32
+	synced   bool
+	gaps     []gap
+	seen     time.Time
+}
+
+// gap is a range of the sequence numbers which has been counted as lost
+type gap struct {
+	start uint32
+	n     uint32
+}
+
+// NewTracker constructs a sequence tracker, a jump more than maxGap
+// in either direction is considered as a sequence reset.
+func NewTracker(maxGap uint32) *Tracker {
+	return &Tracker{
+		maxGap:  maxGap,
+		streams: make(map[key]*stream),
+		now:     time.Now,
+	}
+}
+
+// Update tracks the packet sequence number and the number of the units
+// that the packet carries, it returns the number of lost units that
+// has been detected by this packet.
+func (t *Tracker) Update(exporter string, domain uint64, seq, count uint32) uint32 {
+	var lost uint32
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	s := t.get(exporter, domain)
+	s.Received++
+
+	if !s.synced {
+		s.advance(seq, count)
+		return 0
+	}
+
+	// the difference is calculated modulo 2^32 so the
+	// sequence numbers wrap around is handled naturally
+	diff := int32(seq - s.expected)
+
+	switch {
+	case diff == 0:
+		s.advance(seq, count)
+	case diff > 0 && uint32(diff) <= t.maxGap:
+		lost = uint32(diff)
+		s.Gaps++
+		s.Lost += uint64(lost)
+		s.addGap(s.expected, lost)
+		s.advance(seq, count)
+	case diff < 0 && uint32(-diff) <= t.maxGap:
+		// late packet, only the units which have
+		// been counted as lost are taken back
+		if filled := s.fill(seq, count); filled > 0 {
+			s.Reordered++
+			s.Lost -= uint64(filled)
+		} else {
+			s.Duplicates++
+		}
+	default:
+		s.Resets++
+		s.gaps = s.gaps[:0]
+		s.advance(seq, count)
+	}
+
+	return lost
+}
+
+// Resync sets the sequence number of a packet that its number of units
+// is unknown, the next packet of the domain isn't checked for the gap.
+func (t *Tracker) Resync(exporter string, domain uint64, seq uint32) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	s := t.get(exporter, domain)
+	s.Received++
+	s.Sequence = seq
+	s.synced = false
+}
+
+// SetDrops sets the number of drops that the exporter reported
+func (t *Tracker) SetDrops(exporter string, domain uint64, drops uint32) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.get(exporter, domain).Drops = uint64(drops)
+}
+
+// Stats returns the stats of all domains sorted by exporter and domain
+func (t *Tracker) Stats() []Stats {
+	t.lock.Lock()
+	stats := make([]Stats, 0, len(t.streams))
+	for _, s := range t.streams {
+		stats = append(stats, s.Stats)
+	}
+	t.lock.Unlock()
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Exporter != stats[j].Exporter {
+			return stats[i].Exporter < stats[j].Exporter
+		}
+		return stats[i].Domain < stats[j].Domain
+	})
+
+	return stats
+}
+
+// get returns the domain stream and removes the domains which
+// have not been updated for the idle timeout once in a while
+func (t *Tracker) get(exporter string, domain uint64) *stream {
+	now := t.now()
+	if now.Sub(t.swept) > idleTimeout {
+		for k, s := range t.streams {
+			if now.Sub(s.seen) > idleTimeout {
+				delete(t.streams, k)
+			}
+		}
+		t.swept = now
+	}
+
+	k := key{exporter, domain}
+	s, ok := t.streams[k]
+	if !ok {
+		s = &stream{Stats: Stats{Exporter: exporter, Domain: domain}}
+		t.streams[k] = s
+	}
+	s.seen = now
+
+	return s
+}
+
+// addGap records a lost range, the oldest one is
+// forgotten once the maxGaps ranges are recorded
+func (s *stream) addGap(start, n uint32) {
+	if len(s.gaps) == maxGaps {
+		copy(s.gaps, s.gaps[1:])
+		s.gaps = s.gaps[:maxGaps-1]
+	}
+	s.gaps = append(s.gaps, gap{start, n})
+}
+
+// fill removes the late units from the recorded gaps
+// and returns the number of the units that were lost
+func (s *stream) fill(seq, count uint32) uint32 {
+	for i, g := range s.gaps {
+		off := seq - g.start
+		if off >= g.n {
+			continue
+		}
+
+		filled := count
+		if filled > g.n-off {
+			filled = g.n - off
+		}
+
+		// split the gap into the ranges before and after the units
+		rest := gap{g.start + off + filled, g.n - off - filled}
+		if off > 0 {
+			s.gaps[i].n = off
+			if rest.n > 0 {
+				s.addGap(rest.start, rest.n)
+			}
+		} else if rest.n > 0 {
+			s.gaps[i] = rest
+		} else {
+			s.gaps = append(s.gaps[:i], s.gaps[i+1:]...)
+		}
+
+		return filled
+	}
+
+	return 0
+}
+
+func (s *stream) advance(seq, count uint32) {
+	s.Sequence = seq
+	s.expected = seq + count
+	s.synced = true
+}
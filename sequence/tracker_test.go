@@ -0,0 +1,164 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    tracker_test.go
+//: details: TODO
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package sequence
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTrackerInOrder(t *testing.T) {
+	tr := NewTracker(1000)
+
+	for i := uint32(0); i < 5; i++ {
+		if lost := tr.Update("192.0.2.1", 1, 100+i*10, 10); lost != 0 {
+			t.Error("expected lost 0, got", lost)
+		}
+	}
+
+	s := tr.Stats()[0]
+	if s.Received != 5 || s.Lost != 0 || s.Gaps != 0 || s.Sequence != 140 {
+		t.Error("unexpected stats", s)
+	}
+}
+
+func TestTrackerGap(t *testing.T) {
+	tr := NewTracker(1000)
+
+	tr.Update("192.0.2.1", 1, 100, 10)
+	if lost := tr.Update("192.0.2.1", 1, 130, 10); lost != 20 {
+		t.Error("expected lost 20, got", lost)
+	}
+
+	s := tr.Stats()[0]
+	if s.Lost != 20 || s.Gaps != 1 {
+		t.Error("expected lost 20 and gaps 1, got", s.Lost, s.Gaps)
+	}
+}
+
+func TestTrackerReorder(t *testing.T) {
+	tr := NewTracker(1000)
+
+	tr.Update("192.0.2.1", 1, 1, 1)
+	tr.Update("192.0.2.1", 1, 3, 1)
+	tr.Update("192.0.2.1", 1, 2, 1)
+	tr.Update("192.0.2.1", 1, 4, 1)
+
+	s := tr.Stats()[0]
+	if s.Lost != 0 || s.Gaps != 1 || s.Reordered != 1 || s.Sequence != 4 {
+		t.Error("unexpected stats", s)
+	}
+}
+
+func TestTrackerDuplicate(t *testing.T) {
+	tr := NewTracker(1000)
+
+	tr.Update("192.0.2.1", 1, 10, 10)
+	tr.Update("192.0.2.1", 1, 40, 10)
+	tr.Update("192.0.2.1", 1, 20, 5)
+	tr.Update("192.0.2.1", 1, 20, 5)
+	tr.Update("192.0.2.1", 1, 10, 10)
+	tr.Update("192.0.2.1", 1, 30, 10)
+
+	s := tr.Stats()[0]
+	if s.Lost != 5 || s.Reordered != 2 || s.Duplicates != 2 {
+		t.Error("unexpected stats", s)
+	}
+}
+
+func TestTrackerIdle(t *testing.T) {
+	now := time.Now()
+	tr := NewTracker(1000)
+	tr.now = func() time.Time { return now }
+
+	tr.Update("192.0.2.1", 1, 1, 1)
+	now = now.Add(idleTimeout / 2)
+	tr.Update("192.0.2.2", 1, 1, 1)
+	now = now.Add(idleTimeout)
+	tr.Update("192.0.2.3", 1, 1, 1)
+
+	stats := tr.Stats()
+	if len(stats) != 2 || stats[0].Exporter != "192.0.2.2" {
+		t.Error("expected the idle domain removed, got", stats)
+	}
+}
+
+func TestTrackerReset(t *testing.T) {
+	tr := NewTracker(1000)
+
+	tr.Update("192.0.2.1", 1, 500000, 1)
+	tr.Update("192.0.2.1", 1, 1, 1)
+	tr.Update("192.0.2.1", 1, 2, 1)
+
+	s := tr.Stats()[0]
+	if s.Resets != 1 || s.Lost != 0 || s.Sequence != 2 {
+		t.Error("unexpected stats", s)
+	}
+}
+
+func TestTrackerWrapAround(t *testing.T) {
+	tr := NewTracker(1000)
+
+	tr.Update("192.0.2.1", 1, 0xfffffff0, 0x10)
+	tr.Update("192.0.2.1", 1, 0, 5)
+	tr.Update("192.0.2.1", 1, 7, 1)
+
+	s := tr.Stats()[0]
+	if s.Resets != 0 || s.Lost != 2 || s.Gaps != 1 {
+		t.Error("unexpected stats", s)
+	}
+}
+
+func TestTrackerResync(t *testing.T) {
+	tr := NewTracker(1000)
+
+	tr.Update("192.0.2.1", 1, 100, 10)
+	tr.Resync("192.0.2.1", 1, 110)
+	tr.Update("192.0.2.1", 1, 150, 10)
+	tr.Update("192.0.2.1", 1, 160, 10)
+
+	s := tr.Stats()[0]
+	if s.Lost != 0 || s.Received != 4 {
+		t.Error("expected lost 0 and received 4, got", s.Lost, s.Received)
+	}
+}
+
+func TestTrackerDomains(t *testing.T) {
+	tr := NewTracker(1000)
+
+	tr.Update("192.0.2.2", 1, 1, 1)
+	tr.Update("192.0.2.1", 2, 1, 1)
+	tr.Update("192.0.2.1", 1, 1, 1)
+	tr.SetDrops("192.0.2.1", 2, 42)
+
+	stats := tr.Stats()
+	if len(stats) != 3 {
+		t.Fatal("expected 3 domains, got", len(stats))
+	}
+
+	if stats[0].Domain != 1 || stats[1].Domain != 2 || stats[2].Exporter != "192.0.2.2" {
+		t.Error("unexpected order", stats)
+	}
+
+	if stats[1].Drops != 42 {
+		t.Error("expected drops 42, got", stats[1].Drops)
+	}
+}
@@ -0,0 +1,87 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    compat.go
+//: details: sflow records map compatibility output
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package sflow
+
+type mapDatagram struct {
+	*SFDatagram
+	Samples  []Sample
+	Counters []Counter
+	Discards []*mapDiscardSample
+}
+
+type mapFlowSample struct {
+	*FlowSample
+	Records map[string]interface{}
+}
+
+type mapDiscardSample struct {
+	*DiscardSample
+	Records map[string]interface{}
+}
+
+type mapCounterSample struct {
+	*CounterSample
+	Records map[string]interface{}
+}
+
+// RecordsMap returns the datagram in the former output form
+// where the sample records are keyed by the record name. If a
+// sample carries several records of the same name, the last
+// one wins. The result is meant to be marshaled to JSON.
+func (d *SFDatagram) RecordsMap() interface{} {
+	m := &mapDatagram{
+		SFDatagram: d,
+		Samples:    make([]Sample, len(d.Samples)),
+		Counters:   make([]Counter, len(d.Counters)),
+		Discards:   make([]*mapDiscardSample, len(d.Discards)),
+	}
+
+	for i, s := range d.Samples {
+		if fs, ok := s.(*FlowSample); ok {
+			m.Samples[i] = &mapFlowSample{fs, recordsMap(fs.Records)}
+		} else {
+			m.Samples[i] = s
+		}
+	}
+
+	for i, c := range d.Counters {
+		if cs, ok := c.(*CounterSample); ok {
+			m.Counters[i] = &mapCounterSample{cs, recordsMap(cs.Records)}
+		} else {
+			m.Counters[i] = c
+		}
+	}
+
+	for i, ds := range d.Discards {
+		m.Discards[i] = &mapDiscardSample{ds, recordsMap(ds.Records)}
+	}
+
+	return m
+}
+
+func recordsMap(records []Record) map[string]interface{} {
+	m := make(map[string]interface{}, len(records))
+	for _, r := range records {
+		m[r.Name] = r.Data
+	}
+
+	return m
+}
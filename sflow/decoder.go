@@ -23,11 +23,12 @@
 package sflow
 
 import (
-	"encoding/binary"
 	"errors"
-	"io"
+	"math"
 	"net"
 	"time"
+
+	"github.com/EdgeCast/vflow/reader"
 )
 
 const (
@@ -36,11 +37,20 @@ const (
 
 	// DataCounterSample defines counter sampling
 	DataCounterSample = 2
+
+	// DataFlowSampleExpanded defines expanded packet flow sampling
+	DataFlowSampleExpanded = 3
+
+	// DataCounterSampleExpanded defines expanded counter sampling
+	DataCounterSampleExpanded = 4
+
+	// DataDiscardSample defines discarded packet sampling
+	DataDiscardSample = 5
 )
 
 // SFDecoder represents sFlow decoder
 type SFDecoder struct {
-	reader io.ReadSeeker
+	reader *reader.Reader
 	filter []uint32 // Filter data format(s)
 }
 
@@ -54,6 +64,7 @@ type SFDatagram struct {
 	SamplesNo  uint32 // Number of samples
 	Samples    []Sample
 	Counters   []Counter
+	Discards   []*DiscardSample
 
 	IPAddress net.IP // Agent IP address
 	ColTime   int64  // Collected time
@@ -74,106 +85,123 @@ type Sample interface{}
 // Counter represents sFlow counters
 type Counter interface{}
 
-// Record represents sFlow sample record record
-type Record interface{}
+// Record represents sFlow flow or counter record, Data holds
+// the decoded record e.g. *ExtRouterData for format 1002
+type Record struct {
+	Enterprise uint32
+	Format     uint32
+	Name       string
+	Data       interface{}
+}
+
+func newRecord(dataFormat uint32, name string, data interface{}) Record {
+	return Record{
+		Enterprise: dataFormat >> 12,
+		Format:     dataFormat & 0xfff,
+		Name:       name,
+		Data:       data,
+	}
+}
 
 var (
-	errNoneEnterpriseStandard = errors.New("the enterprise is not standard sflow data")
-	errDataLengthUnknown      = errors.New("the sflow data length is unknown")
-	errSFVersionNotSupport    = errors.New("the sflow version doesn't support")
-	errSampleLengthInvalid    = errors.New("the sflow sample length is invalid")
+	errDataLengthUnknown   = errors.New("the sflow data length is unknown")
+	errSFVersionNotSupport = errors.New("the sflow version doesn't support")
+	errSampleLengthInvalid = errors.New("the sflow sample length is invalid")
+	errRecordLengthInvalid = errors.New("the sflow record length is invalid")
+	errDataLengthInvalid   = errors.New("the sflow data length is invalid")
+	errUnknownFieldType    = errors.New("the sflow field type is unknown")
 )
 
-// NewSFDecoder constructs new sflow decoder
-func NewSFDecoder(r io.ReadSeeker, f []uint32) SFDecoder {
+// maxOpaqueLength is the maximum length of variable length data
+const maxOpaqueLength = 0xffff
+
+// NewSFDecoder constructs new sflow decoder, the decoded datagram
+// refers to b so b shouldn't be reused until the datagram is released.
+func NewSFDecoder(b []byte, f []uint32) SFDecoder {
 	return SFDecoder{
-		reader: r,
+		reader: reader.NewReader(b),
 		filter: f,
 	}
 }
 
 // SFDecode decodes sFlow data
 func (d *SFDecoder) SFDecode() (*SFDatagram, error) {
+	var sample reader.Reader
+
 	datagram, err := d.sfHeaderDecode()
 	if err != nil {
 		return nil, err
 	}
 
-	datagram.Samples = []Sample{}
-	datagram.Counters = []Counter{}
-
 	for i := uint32(0); i < datagram.SamplesNo; i++ {
-		sfTypeFormat, sfDataLength, err := d.getSampleInfo()
+		sfType, sfDataLength, err := d.getSampleInfo()
 		if err != nil {
-			return nil, err
+			return datagram, err
+		}
+
+		data, err := d.reader.Read(int(sfDataLength))
+		if err != nil {
+			return datagram, errSampleLengthInvalid
 		}
 
-		if m := d.isFilterMatch(sfTypeFormat); m {
-			d.reader.Seek(int64(sfDataLength), 1)
+		if m := d.isFilterMatch(sfType); m {
 			continue
 		}
 
-		var offsetBefore, _ = d.reader.Seek(0, 1)
+		// the sample is decoded from its own data so
+		// the padding after the sample is skipped
+		sample.Reset(data)
 
-		switch sfTypeFormat {
-		case DataFlowSample:
-			d, err := decodeFlowSample(d.reader)
+		switch sfType {
+		case DataFlowSample, DataFlowSampleExpanded:
+			d, err := decodeFlowSample(&sample, sfType == DataFlowSampleExpanded)
 			if err != nil {
 				return datagram, err
 			}
 			datagram.Samples = append(datagram.Samples, d)
-		case DataCounterSample:
-			d, err := decodeFlowCounter(d.reader)
+		case DataCounterSample, DataCounterSampleExpanded:
+			d, err := decodeFlowCounter(&sample, sfType == DataCounterSampleExpanded)
 			if err != nil {
 				return datagram, err
 			}
 			datagram.Counters = append(datagram.Counters, d)
+		case DataDiscardSample:
+			d, err := decodeDiscardSample(&sample)
+			if err != nil {
+				return datagram, err
+			}
+			datagram.Discards = append(datagram.Discards, d)
 		default:
-			d.reader.Seek(int64(sfDataLength), 1)
-		}
-
-		err = d.sfMoveToEndOfSample(sfDataLength, offsetBefore)
-		if err != nil {
-			return datagram, err
+			// enterprise or unknown samples: decode them if there is
+			// a registered decoder otherwise skip them
+			if _, s, ok := decodeRegistered(data, sampleDecoders, sfType); ok {
+				datagram.Samples = append(datagram.Samples, s)
+			}
 		}
-
 	}
 
 	return datagram, nil
 }
 
-func (d *SFDecoder) sfMoveToEndOfSample(sfDataLength uint32, offsetBefore int64) error {
-	var offsetAfter, _ = d.reader.Seek(0, 1)
-	var bytesRead = offsetAfter - offsetBefore
-	var byteUntilEndOfSample = int64(sfDataLength) - bytesRead
-	if byteUntilEndOfSample < 0 {
-		return errSampleLengthInvalid
-	}
-	if byteUntilEndOfSample > 0 {
-		var _, err = d.reader.Seek(byteUntilEndOfSample, 1)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
 func (d *SFDecoder) sfHeaderDecode() (*SFDatagram, error) {
 	var (
-		datagram = &SFDatagram{}
+		datagram = newDatagram()
 		ipLen    = 4
 		err      error
 	)
 
-	if err = read(d.reader, &datagram.Version); err != nil {
+	if datagram.Version, err = d.reader.Uint32(); err != nil {
+		datagram.Release()
 		return nil, err
 	}
 
 	if datagram.Version != 5 {
+		datagram.Release()
 		return nil, errSFVersionNotSupport
 	}
 
-	if err = read(d.reader, &datagram.IPVersion); err != nil {
+	if datagram.IPVersion, err = d.reader.Uint32(); err != nil {
+		datagram.Release()
 		return nil, err
 	}
 
@@ -181,23 +209,23 @@ func (d *SFDecoder) sfHeaderDecode() (*SFDatagram, error) {
 	if datagram.IPVersion == 2 {
 		ipLen = 16
 	}
-	buff := make([]byte, ipLen)
-	if _, err = d.reader.Read(buff); err != nil {
+	if datagram.IPAddress, err = d.reader.Read(ipLen); err != nil {
+		datagram.Release()
 		return nil, err
 	}
-	datagram.IPAddress = buff
 
-	if err = read(d.reader, &datagram.AgentSubID); err != nil {
-		return nil, err
-	}
-	if err = read(d.reader, &datagram.SequenceNo); err != nil {
-		return nil, err
-	}
-	if err = read(d.reader, &datagram.SysUpTime); err != nil {
-		return nil, err
+	fields := []interface{}{
+		&datagram.AgentSubID,
+		&datagram.SequenceNo,
+		&datagram.SysUpTime,
+		&datagram.SamplesNo,
 	}
-	if err = read(d.reader, &datagram.SamplesNo); err != nil {
-		return nil, err
+
+	for _, field := range fields {
+		if err = read(d.reader, field); err != nil {
+			datagram.Release()
+			return nil, err
+		}
 	}
 
 	datagram.ColTime = time.Now().Unix()
@@ -205,34 +233,26 @@ func (d *SFDecoder) sfHeaderDecode() (*SFDatagram, error) {
 	return datagram, nil
 }
 
+// getSampleInfo returns the sample data format and length, the data format
+// holds the enterprise (20 bits) and the format (12 bits) so the standard
+// sFlow data formats are equal to their format number.
 func (d *SFDecoder) getSampleInfo() (uint32, uint32, error) {
 	var (
-		sfType           uint32
-		sfTypeFormat     uint32
-		sfTypeEnterprise uint32
-		sfDataLength     uint32
+		sfType       uint32
+		sfDataLength uint32
 
 		err error
 	)
 
-	if err = read(d.reader, &sfType); err != nil {
+	if sfType, err = d.reader.Uint32(); err != nil {
 		return 0, 0, err
 	}
 
-	sfTypeEnterprise = sfType >> 12 // 20 bytes enterprise
-	sfTypeFormat = sfType & 0xfff   // 12 bytes format
-
-	// supports standard sflow data
-	if sfTypeEnterprise != 0 {
-		d.reader.Seek(int64(sfDataLength), 1)
-		return 0, 0, errNoneEnterpriseStandard
-	}
-
-	if err = read(d.reader, &sfDataLength); err != nil {
+	if sfDataLength, err = d.reader.Uint32(); err != nil {
 		return 0, 0, errDataLengthUnknown
 	}
 
-	return sfTypeFormat, sfDataLength, nil
+	return sfType, sfDataLength, nil
 }
 
 func (d *SFDecoder) isFilterMatch(f uint32) bool {
@@ -244,6 +264,101 @@ func (d *SFDecoder) isFilterMatch(f uint32) bool {
 	return false
 }
 
-func read(r io.Reader, v interface{}) error {
-	return binary.Read(r, binary.BigEndian, v)
+// read reads a big-endian fixed size field, v should be
+// a pointer to uint8, uint32, int32, uint64 or float32
+func read(r *reader.Reader, v interface{}) error {
+	var err error
+
+	switch v := v.(type) {
+	case *uint32:
+		*v, err = r.Uint32()
+	case *uint64:
+		*v, err = r.Uint64()
+	case *uint8:
+		*v, err = r.Uint8()
+	case *int32:
+		var u uint32
+		u, err = r.Uint32()
+		*v = int32(u)
+	case *float32:
+		var u uint32
+		u, err = r.Uint32()
+		*v = math.Float32frombits(u)
+	default:
+		err = errUnknownFieldType
+	}
+
+	return err
+}
+
+// readAddress reads sFlow address which is the address type
+// (1 = IPv4, 2 = IPv6) followed by the address
+func readAddress(r *reader.Reader) (net.IP, error) {
+	ipType, err := r.Uint32()
+	if err != nil {
+		return nil, err
+	}
+
+	switch ipType {
+	case 1:
+		return r.Read(4)
+	case 2:
+		return r.Read(16)
+	default:
+		return nil, nil
+	}
+}
+
+// readOpaque reads variable length opaque data, the data
+// is padded to a multiple of four bytes
+func readOpaque(r *reader.Reader) ([]byte, error) {
+	length, err := r.Uint32()
+	if err != nil {
+		return nil, err
+	}
+
+	if length > maxOpaqueLength {
+		return nil, errDataLengthInvalid
+	}
+
+	b, err := r.Read(int((length + 3) &^ 3))
+	if err != nil {
+		return nil, err
+	}
+
+	return b[:length], nil
+}
+
+func readString(r *reader.Reader) (string, error) {
+	b, err := readOpaque(r)
+	return string(b), err
+}
+
+// readMAC reads six bytes MAC address which is padded to eight bytes
+func readMAC(r *reader.Reader) (string, error) {
+	b, err := r.Read(8)
+	if err != nil {
+		return "", err
+	}
+
+	return net.HardwareAddr(b[:6]).String(), nil
+}
+
+// readUint32Array reads variable length array of unsigned int
+func readUint32Array(r *reader.Reader) ([]uint32, error) {
+	length, err := r.Uint32()
+	if err != nil {
+		return nil, err
+	}
+
+	if length > maxOpaqueLength/4 || int(length)*4 > r.Len() {
+		return nil, errDataLengthInvalid
+	}
+
+	a := make([]uint32, length)
+	for i := range a {
+		a[i], _ = r.Uint32()
+	}
+
+	return a, nil
 }
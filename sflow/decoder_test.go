@@ -24,7 +24,13 @@ package sflow
 
 import (
 	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"reflect"
 	"testing"
+
+	"github.com/EdgeCast/vflow/packet"
 )
 
 var TestsFlowRawPacket = []byte{0x00, 0x00, 0x00, 0x05, 0x00, 0x00,
@@ -190,8 +196,7 @@ var TestsFlowRawPacketWithPaddingAfterSample = []byte{
 
 func TestSFHeaderDecode(t *testing.T) {
 	filter := []uint32{DataCounterSample}
-	reader := bytes.NewReader(TestsFlowRawPacket)
-	d := NewSFDecoder(reader, filter)
+	d := NewSFDecoder(TestsFlowRawPacket, filter)
 	datagram, err := d.sfHeaderDecode()
 
 	if err != nil {
@@ -231,12 +236,8 @@ func TestSFHeaderDecode(t *testing.T) {
 
 func TestGetSampleInfo(t *testing.T) {
 	filter := []uint32{DataCounterSample}
-	reader := bytes.NewReader(TestsFlowRawPacket)
 	// skip sflow header
-	skip := make([]byte, 4*7)
-	reader.Read(skip)
-
-	d := NewSFDecoder(reader, filter)
+	d := NewSFDecoder(TestsFlowRawPacket[4*7:], filter)
 
 	sizes := []uint32{232, 232, 232, 172, 232}
 
@@ -252,14 +253,13 @@ func TestGetSampleInfo(t *testing.T) {
 			t.Error("expected data length: ", sizes[i], ", got", sfDataLength)
 		}
 
-		d.reader.Seek(int64(sfDataLength), 1)
+		d.reader.Read(int(sfDataLength))
 	}
 }
 
 func TestSFDecode(t *testing.T) {
 	filter := []uint32{DataCounterSample}
-	reader := bytes.NewReader(TestsFlowRawPacket)
-	d := NewSFDecoder(reader, filter)
+	d := NewSFDecoder(TestsFlowRawPacket, filter)
 	_, err := d.SFDecode()
 	if err != nil {
 		t.Error("unexpected error", err)
@@ -268,8 +268,7 @@ func TestSFDecode(t *testing.T) {
 
 func TestSFDecodeWithPaddingAfterSample(t *testing.T) {
 	filter := []uint32{DataCounterSample}
-	reader := bytes.NewReader(TestsFlowRawPacketWithPaddingAfterSample)
-	d := NewSFDecoder(reader, filter)
+	d := NewSFDecoder(TestsFlowRawPacketWithPaddingAfterSample, filter)
 	datagram, err := d.SFDecode()
 	if err != nil {
 		t.Error("unexpected error", err)
@@ -285,9 +284,8 @@ func TestSFDecodeWithPaddingAfterSample(t *testing.T) {
 
 func TestDecodeSampleHeader(t *testing.T) {
 	filter := []uint32{DataCounterSample}
-	reader := bytes.NewReader(TestsFlowRawPacket)
 
-	d := NewSFDecoder(reader, filter)
+	d := NewSFDecoder(TestsFlowRawPacket, filter)
 
 	datagram, err := d.SFDecode()
 	if err != nil {
@@ -334,11 +332,506 @@ func TestDecodeSampleHeader(t *testing.T) {
 
 }
 
+// xdr encodes the values as sFlow XDR data, a []byte
+// is written as is and it should be aligned by caller
+func xdr(values ...interface{}) []byte {
+	buf := new(bytes.Buffer)
+	for _, v := range values {
+		binary.Write(buf, binary.BigEndian, v)
+	}
+	return buf.Bytes()
+}
+
+// sfDatagram encodes an sFlow v5 datagram with IPv4 agent address
+func sfDatagram(samples ...[]byte) []byte {
+	b := xdr(uint32(5), uint32(1), []byte{192, 0, 2, 1},
+		uint32(0), uint32(1), uint32(1000), uint32(len(samples)))
+	for _, s := range samples {
+		b = append(b, s...)
+	}
+	return b
+}
+
+// sfData encodes data format, length and data of a sample or a record
+func sfData(enterprise, format uint32, data []byte) []byte {
+	return append(xdr(enterprise<<12|format, uint32(len(data))), data...)
+}
+
+// sfFlowSample encodes a compact flow sample with the records
+func sfFlowSample(records ...[]byte) []byte {
+	b := xdr(uint32(1), uint32(3), uint32(512), uint32(1024),
+		uint32(0), uint32(1), uint32(2), uint32(len(records)))
+	for _, r := range records {
+		b = append(b, r...)
+	}
+	return sfData(0, DataFlowSample, b)
+}
+
+func TestSFDecodeEnterpriseSample(t *testing.T) {
+	extSwitch := sfData(0, SFDataExtSwitch, xdr(uint32(10), uint32(1), uint32(20), uint32(2)))
+	vendor := sfData(4413, 1, xdr(uint32(1), uint32(2), uint32(3)))
+
+	b := sfDatagram(vendor, sfFlowSample(extSwitch), vendor)
+	d := NewSFDecoder(b, nil)
+	datagram, err := d.SFDecode()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if len(datagram.Samples) != 1 {
+		t.Fatal("expected samples# 1, got", len(datagram.Samples))
+	}
+
+	sample := datagram.Samples[0].(*FlowSample)
+	if recordData(sample.Records, "ExtSwitch") == nil {
+		t.Error("expected ExtSwitch record")
+	}
+}
+
+func TestSFDecodeEnterpriseRecord(t *testing.T) {
+	extSwitch := sfData(0, SFDataExtSwitch, xdr(uint32(10), uint32(1), uint32(20), uint32(2)))
+	vendor := sfData(8888, 5, xdr(uint32(0xcafe), uint32(0), uint32(0)))
+
+	b := sfDatagram(sfFlowSample(vendor, extSwitch))
+	d := NewSFDecoder(b, nil)
+	datagram, err := d.SFDecode()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	sample := datagram.Samples[0].(*FlowSample)
+	if len(sample.Records) != 1 {
+		t.Error("expected records# 1, got", len(sample.Records))
+	}
+
+	RegisterFlowRecordDecoder(8888, 5, "Vendor", func(b []byte) (interface{}, error) {
+		return binary.BigEndian.Uint32(b), nil
+	})
+
+	d = NewSFDecoder(b, nil)
+	datagram, err = d.SFDecode()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	sample = datagram.Samples[0].(*FlowSample)
+	if v, ok := recordData(sample.Records, "Vendor").(uint32); !ok || v != 0xcafe {
+		t.Error("expected Vendor record 0xcafe, got", v)
+	}
+
+	if recordData(sample.Records, "ExtSwitch") == nil {
+		t.Error("expected ExtSwitch record")
+	}
+}
+
+func TestRegisterSampleDecoder(t *testing.T) {
+	RegisterSampleDecoder(7777, 1, func(b []byte) (interface{}, error) {
+		return len(b), nil
+	})
+
+	b := sfDatagram(sfData(7777, 1, xdr(uint32(1), uint32(2))))
+	d := NewSFDecoder(b, nil)
+	datagram, err := d.SFDecode()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if len(datagram.Samples) != 1 || datagram.Samples[0].(int) != 8 {
+		t.Error("expected enterprise sample with 8 bytes, got", datagram.Samples)
+	}
+}
+
+func TestSFDecodeEnterpriseError(t *testing.T) {
+	errVendor := errors.New("vendor error")
+	RegisterSampleDecoder(7777, 2, func(b []byte) (interface{}, error) {
+		return nil, errVendor
+	})
+	RegisterFlowRecordDecoder(8888, 6, "VendorError", func(b []byte) (interface{}, error) {
+		return nil, errVendor
+	})
+
+	extSwitch := sfData(0, SFDataExtSwitch, xdr(uint32(10), uint32(1), uint32(20), uint32(2)))
+	vendor := sfData(8888, 6, xdr(uint32(0xcafe)))
+
+	before := EnterpriseErrors()
+	b := sfDatagram(sfData(7777, 2, xdr(uint32(1))), sfFlowSample(vendor, extSwitch))
+	d := NewSFDecoder(b, nil)
+	datagram, err := d.SFDecode()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if len(datagram.Samples) != 1 {
+		t.Fatal("expected samples# 1, got", len(datagram.Samples))
+	}
+
+	sample := datagram.Samples[0].(*FlowSample)
+	if len(sample.Records) != 1 || recordData(sample.Records, "ExtSwitch") == nil {
+		t.Error("expected ExtSwitch record only, got", sample.Records)
+	}
+
+	if n := EnterpriseErrors() - before; n != 2 {
+		t.Error("expected enterprise errors 2, got", n)
+	}
+}
+
+func TestSFDecodeExpandedSamples(t *testing.T) {
+	extSwitch := sfData(0, SFDataExtSwitch, xdr(uint32(10), uint32(1), uint32(20), uint32(2)))
+	flow := sfData(0, DataFlowSampleExpanded, append(xdr(uint32(7), uint32(0), uint32(0x12345678),
+		uint32(512), uint32(1024), uint32(3), uint32(0), uint32(0x1000001), uint32(2),
+		uint32(4), uint32(1)), extSwitch...))
+
+	vlan := sfData(0, SFVLANCounters, xdr(uint32(100), uint64(1), uint32(2), uint32(3), uint32(4), uint32(5)))
+	counter := sfData(0, DataCounterSampleExpanded, append(xdr(uint32(9), uint32(2),
+		uint32(0x2000002), uint32(1)), vlan...))
+
+	b := sfDatagram(flow, counter)
+	d := NewSFDecoder(b, nil)
+	datagram, err := d.SFDecode()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if len(datagram.Samples) != 1 || len(datagram.Counters) != 1 {
+		t.Fatal("expected one flow and one counter sample, got",
+			len(datagram.Samples), len(datagram.Counters))
+	}
+
+	fs := datagram.Samples[0].(*FlowSample)
+	if fs.SourceIDIdx != 0x12345678 {
+		t.Error("expected SourceIDIdx 0x12345678, got", fs.SourceIDIdx)
+	}
+	if fs.Drops != 3 {
+		t.Error("expected Drops 3, got", fs.Drops)
+	}
+	if fs.Input != 0x1000001 {
+		t.Error("expected Input 0x1000001, got", fs.Input)
+	}
+	if fs.OutputFormat != 2 || fs.Output != 4 {
+		t.Error("expected multiple (2) output interfaces 4, got", fs.OutputFormat, fs.Output)
+	}
+	if recordData(fs.Records, "ExtSwitch") == nil {
+		t.Error("expected ExtSwitch record")
+	}
+
+	cs := datagram.Counters[0].(*CounterSample)
+	if cs.SourceIDType != 2 || cs.SourceIDIdx != 0x2000002 {
+		t.Error("expected source id 2:0x2000002, got", cs.SourceIDType, cs.SourceIDIdx)
+	}
+	if v, ok := recordData(cs.Records, "Vlan").(*VlanCounters); !ok || v.ID != 100 {
+		t.Error("expected vlan counters ID 100, got", recordData(cs.Records, "Vlan"))
+	}
+}
+
+func TestSFDecodeCompactSourceID(t *testing.T) {
+	b := sfDatagram(sfData(0, DataFlowSample, xdr(uint32(1), uint32(0x01000203),
+		uint32(512), uint32(1024), uint32(0), uint32(0x40000005), uint32(2), uint32(0))))
+	d := NewSFDecoder(b, nil)
+	datagram, err := d.SFDecode()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	fs := datagram.Samples[0].(*FlowSample)
+	if fs.SourceID != 1 || fs.SourceIDIdx != 0x203 {
+		t.Error("expected source id 1:0x203, got", fs.SourceID, fs.SourceIDIdx)
+	}
+	if fs.InputFormat != 1 || fs.Input != 5 {
+		t.Error("expected discarded (1) input reason 5, got", fs.InputFormat, fs.Input)
+	}
+}
+
+func TestSFDecodeStandardFlowRecords(t *testing.T) {
+	gateway := xdr(uint32(1), []byte{192, 0, 2, 254}, uint32(65000), uint32(65001), uint32(65002),
+		uint32(1), uint32(2), uint32(2), uint32(65003), uint32(65004),
+		uint32(2), uint32(100), uint32(200), uint32(50))
+	mpls := xdr(uint32(1), []byte{192, 0, 2, 253}, uint32(1), uint32(16), uint32(2), uint32(17), uint32(18))
+	ipv4 := xdr(uint32(84), uint32(6), []byte{10, 0, 0, 1}, []byte{10, 0, 0, 2},
+		uint32(1234), uint32(443), uint32(0x12), uint32(0))
+	user := xdr(uint32(106), uint32(5), []byte("alice\x00\x00\x00"), uint32(106), uint32(0))
+
+	b := sfDatagram(sfFlowSample(
+		sfData(0, SFDataExtGateway, gateway),
+		sfData(0, SFDataExtMPLS, mpls),
+		sfData(0, SFDataIPv4, ipv4),
+		sfData(0, SFDataExtUser, user),
+	))
+	d := NewSFDecoder(b, nil)
+	datagram, err := d.SFDecode()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	fs := datagram.Samples[0].(*FlowSample)
+
+	eg, ok := recordData(fs.Records, "ExtGateway").(*ExtGatewayData)
+	if !ok {
+		t.Fatal("expected ExtGateway record, got", fs.Records)
+	}
+	if eg.NextHop.String() != "192.0.2.254" || eg.AS != 65000 || eg.LocalPref != 50 {
+		t.Error("unexpected gateway data", eg)
+	}
+	if len(eg.DstASPath) != 1 || eg.DstASPath[0].Type != 2 ||
+		!reflect.DeepEqual(eg.DstASPath[0].ASNumbers, []uint32{65003, 65004}) {
+		t.Error("unexpected AS path", eg.DstASPath)
+	}
+	if !reflect.DeepEqual(eg.Communities, []uint32{100, 200}) {
+		t.Error("expected communities [100 200], got", eg.Communities)
+	}
+
+	em, ok := recordData(fs.Records, "ExtMPLS").(*ExtMPLSData)
+	if !ok {
+		t.Fatal("expected ExtMPLS record, got", fs.Records)
+	}
+	if !reflect.DeepEqual(em.InStack, []uint32{16}) || !reflect.DeepEqual(em.OutStack, []uint32{17, 18}) {
+		t.Error("unexpected label stacks", em.InStack, em.OutStack)
+	}
+
+	ip, ok := recordData(fs.Records, "IPv4Data").(*IPv4Data)
+	if !ok {
+		t.Fatal("expected IPv4Data record, got", fs.Records)
+	}
+	if ip.SrcIP.String() != "10.0.0.1" || ip.DstPort != 443 || ip.TCPFlags != 0x12 {
+		t.Error("unexpected ipv4 data", ip)
+	}
+
+	eu, ok := recordData(fs.Records, "ExtUser").(*ExtUserData)
+	if !ok {
+		t.Fatal("expected ExtUser record, got", fs.Records)
+	}
+	if eu.SrcUser != "alice" || eu.DstUser != "" {
+		t.Error("unexpected user data", eu)
+	}
+}
+
+func recordData(records []Record, name string) interface{} {
+	for _, r := range records {
+		if r.Name == name {
+			return r.Data
+		}
+	}
+	return nil
+}
+
+func sfCounterSample(records ...[]byte) []byte {
+	b := xdr(uint32(1), uint32(3), uint32(len(records)))
+	for _, r := range records {
+		b = append(b, r...)
+	}
+	return sfData(0, DataCounterSample, b)
+}
+
+func TestSFDecodeHostCounters(t *testing.T) {
+	cpu := xdr(float32(0.5), float32(0.25), float32(0.125))
+	for i := 0; i < 14; i++ {
+		cpu = append(cpu, xdr(uint32(i))...)
+	}
+	cpuSteal := append(append([]byte{}, cpu...), xdr(uint32(7), uint32(8), uint32(9))...)
+
+	descr := xdr(uint32(4), []byte("web1"), []byte{0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0,
+		0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0}, uint32(3), uint32(2), uint32(0))
+	adapters := xdr(uint32(1), uint32(2), uint32(1), []byte{0, 1, 2, 3, 4, 5, 0, 0})
+	sfp := xdr(uint32(1), uint32(1), uint32(3300), int32(-5000), uint32(1),
+		uint32(1), uint32(2), uint32(3), uint32(4), uint32(5), uint32(1310), uint32(7), uint32(8), uint32(9), uint32(1310))
+
+	b := sfDatagram(
+		sfCounterSample(
+			sfData(0, SFHostCPUCounters, cpu),
+			sfData(0, SFHostDescrCounters, descr),
+			sfData(0, SFHostAdaptersCounters, adapters),
+			sfData(0, SFSFPCounters, sfp),
+		),
+		sfCounterSample(sfData(0, SFHostCPUCounters, cpuSteal)),
+	)
+	d := NewSFDecoder(b, nil)
+	datagram, err := d.SFDecode()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if len(datagram.Counters) != 2 {
+		t.Fatal("expected 2 counter samples, got", len(datagram.Counters))
+	}
+
+	cs := datagram.Counters[0].(*CounterSample)
+	hc, ok := recordData(cs.Records, "HostCPU").(*HostCPUCounters)
+	if !ok {
+		t.Fatal("expected HostCPU record, got", cs.Records)
+	}
+	if hc.LoadOne != 0.5 || hc.Contexts != 13 || hc.CPUSteal != 0 {
+		t.Error("unexpected host cpu counters", hc)
+	}
+
+	hd, ok := recordData(cs.Records, "HostDescr").(*HostDescrCounters)
+	if !ok {
+		t.Fatal("expected HostDescr record, got", cs.Records)
+	}
+	if hd.Hostname != "web1" || hd.UUID != "12345678-9abc-def0-1234-56789abcdef0" || hd.OSRelease != "" {
+		t.Error("unexpected host description", hd)
+	}
+
+	ha, ok := recordData(cs.Records, "HostAdapters").(*HostAdaptersCounters)
+	if !ok {
+		t.Fatal("expected HostAdapters record, got", cs.Records)
+	}
+	if len(ha.Adapters) != 1 || ha.Adapters[0].IfIndex != 2 ||
+		!reflect.DeepEqual(ha.Adapters[0].MACAddresses, []string{"00:01:02:03:04:05"}) {
+		t.Error("unexpected host adapters", ha.Adapters)
+	}
+
+	sf, ok := recordData(cs.Records, "SFP").(*SFPCounters)
+	if !ok {
+		t.Fatal("expected SFP record, got", cs.Records)
+	}
+	if sf.ModuleTemperature != -5000 || len(sf.Lanes) != 1 || sf.Lanes[0].RxWavelength != 1310 {
+		t.Error("unexpected sfp counters", sf)
+	}
+
+	cs = datagram.Counters[1].(*CounterSample)
+	hc = recordData(cs.Records, "HostCPU").(*HostCPUCounters)
+	if hc.CPUSteal != 7 || hc.CPUGuestNice != 9 {
+		t.Error("expected steal 7 and guest nice 9, got", hc.CPUSteal, hc.CPUGuestNice)
+	}
+}
+
+func TestSFDecodeRecordsOrder(t *testing.T) {
+	b := sfDatagram(sfFlowSample(
+		sfData(0, SFDataExtSwitch, xdr(uint32(10), uint32(0), uint32(20), uint32(0))),
+		sfData(0, SFDataExtMPLSLVPFEC, xdr(uint32(24))),
+		sfData(0, SFDataExtSwitch, xdr(uint32(30), uint32(0), uint32(40), uint32(0))),
+	))
+	d := NewSFDecoder(b, nil)
+	datagram, err := d.SFDecode()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	fs := datagram.Samples[0].(*FlowSample)
+	if len(fs.Records) != 3 {
+		t.Fatal("expected 3 records, got", len(fs.Records))
+	}
+
+	for i, format := range []uint32{SFDataExtSwitch, SFDataExtMPLSLVPFEC, SFDataExtSwitch} {
+		if fs.Records[i].Enterprise != 0 || fs.Records[i].Format != format {
+			t.Errorf("expected record #%d format 0:%d, got %d:%d", i, format,
+				fs.Records[i].Enterprise, fs.Records[i].Format)
+		}
+	}
+
+	if es := fs.Records[2].Data.(*ExtSwitchData); es.SrcVlan != 30 {
+		t.Error("expected last ExtSwitch SrcVlan 30, got", es.SrcVlan)
+	}
+
+	j, err := json.Marshal(fs.Records[1])
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	expected := `{"Enterprise":0,"Format":1011,"Name":"ExtMPLSLVPFEC","Data":{"FecAddrPrefixLength":24}}`
+	if string(j) != expected {
+		t.Errorf("expected %s, got %s", expected, j)
+	}
+}
+
+func TestSFDatagramRecordsMap(t *testing.T) {
+	b := sfDatagram(
+		sfFlowSample(
+			sfData(0, SFDataExtSwitch, xdr(uint32(10), uint32(0), uint32(20), uint32(0))),
+			sfData(0, SFDataExtSwitch, xdr(uint32(30), uint32(0), uint32(40), uint32(0))),
+		),
+		sfCounterSample(sfData(0, SFRadioUtilizationCounters, xdr(uint32(1), uint32(2), uint32(3)))),
+	)
+	d := NewSFDecoder(b, nil)
+	datagram, err := d.SFDecode()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	j, err := json.Marshal(datagram.RecordsMap())
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	var m struct {
+		Version  uint32
+		Samples  []struct{ Records map[string]json.RawMessage }
+		Counters []struct{ Records map[string]json.RawMessage }
+	}
+	if err = json.Unmarshal(j, &m); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if m.Version != 5 {
+		t.Error("expected version 5, got", m.Version)
+	}
+
+	expected := `{"SrcVlan":30,"SrcPriority":0,"DstVlan":40,"DstPriority":0}`
+	if len(m.Samples) != 1 || string(m.Samples[0].Records["ExtSwitch"]) != expected {
+		t.Errorf("expected ExtSwitch %s, got %s", expected, j)
+	}
+
+	if len(m.Counters) != 1 || m.Counters[0].Records["Radio"] == nil {
+		t.Errorf("expected Radio counters record, got %s", j)
+	}
+}
+
+func TestSFDecodeDiscardSample(t *testing.T) {
+	header := []byte{
+		0xd4, 0x04, 0xff, 0x01, 0x1d, 0x9e, 0x30, 0x7c, 0x5e, 0xe5, 0x59, 0xef, 0x08, 0x00,
+		0x45, 0x00, 0x00, 0x28, 0x00, 0x01, 0x00, 0x00, 0x01, 0x06, 0x00, 0x00,
+		0x0a, 0x00, 0x00, 0x01, 0x0a, 0x00, 0x00, 0x02,
+		0x04, 0xd2, 0x01, 0xbb, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00,
+		0x50, 0x02, 0x20, 0x00, 0x00, 0x00, 0x00, 0x00,
+	}
+	raw := append(xdr(uint32(1), uint32(60), uint32(4), uint32(len(header))), header...)
+	discard := xdr(uint32(9), uint32(0), uint32(7), uint32(0), uint32(7), uint32(0), uint32(257), uint32(1))
+	discard = append(discard, sfData(0, SFDataRawHeader, raw)...)
+
+	b := sfDatagram(sfData(0, DataDiscardSample, discard))
+	d := NewSFDecoder(b, nil)
+	datagram, err := d.SFDecode()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if len(datagram.Discards) != 1 || len(datagram.Samples) != 0 {
+		t.Fatal("expected 1 discard sample, got", len(datagram.Discards), len(datagram.Samples))
+	}
+
+	ds := datagram.Discards[0]
+	if ds.SequenceNo != 9 || ds.SourceIDIdx != 7 || ds.Input != 7 {
+		t.Error("unexpected discard sample", ds)
+	}
+
+	if ds.Reason != 257 || ds.ReasonName != "ttl_exceeded" {
+		t.Error("expected reason ttl_exceeded (257), got", ds.ReasonName, ds.Reason)
+	}
+
+	p, ok := recordData(ds.Records, "RawHeader").(*packet.Packet)
+	if !ok {
+		t.Fatal("expected RawHeader record, got", ds.Records)
+	}
+
+	if ip, ok := p.L3.(*packet.IPv4Header); !ok || ip.Dst.String() != "10.0.0.2" || ip.TTL != 1 {
+		t.Error("unexpected discarded packet L3", p.L3)
+	}
+
+	// the discard samples and their packets return to the pools
+	datagram.ReleaseDiscards()
+	if len(datagram.Discards) != 0 || ds.Records[0].Data != nil {
+		t.Error("expected released discard samples, got", datagram.Discards, ds.Records)
+	}
+
+	if DropReasonName(1000) != "reason_1000" {
+		t.Error("expected reason_1000, got", DropReasonName(1000))
+	}
+}
+
 func BenchmarkSFDecode(b *testing.B) {
 	filter := []uint32{DataCounterSample}
+	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
-		reader := bytes.NewReader(TestsFlowRawPacket)
-		d := NewSFDecoder(reader, filter)
-		d.SFDecode()
+		d := NewSFDecoder(TestsFlowRawPacket, filter)
+		datagram, _ := d.SFDecode()
+		datagram.Release()
 	}
 }
@@ -0,0 +1,112 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    enterprise.go
+//: details: sflow enterprise-specific structures registry
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package sflow
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// EnterpriseDecoder decodes an sFlow structure which vflow doesn't
+// support natively, b holds the structure data without the data
+// format and the length fields. b refers to the datagram buffer so
+// the decoder should copy the bytes which are kept in the result.
+type EnterpriseDecoder func(b []byte) (interface{}, error)
+
+type dataFormat struct {
+	enterprise uint32
+	format     uint32
+}
+
+type registeredDecoder struct {
+	name   string
+	decode EnterpriseDecoder
+}
+
+var (
+	registryLock          sync.RWMutex
+	sampleDecoders        = make(map[dataFormat]registeredDecoder)
+	flowRecordDecoders    = make(map[dataFormat]registeredDecoder)
+	counterRecordDecoders = make(map[dataFormat]registeredDecoder)
+
+	enterpriseErrors uint64
+)
+
+// RegisterSampleDecoder registers a sample decoder for the enterprise/format
+// pair, the decoded sample is appended to the datagram samples.
+func RegisterSampleDecoder(enterprise, format uint32, d EnterpriseDecoder) {
+	register(sampleDecoders, enterprise, format, "", d)
+}
+
+// RegisterFlowRecordDecoder registers a flow sample record decoder for the
+// enterprise/format pair, the decoded record is stored by the given name.
+func RegisterFlowRecordDecoder(enterprise, format uint32, name string, d EnterpriseDecoder) {
+	register(flowRecordDecoders, enterprise, format, name, d)
+}
+
+// RegisterCounterRecordDecoder registers a counter sample record decoder for the
+// enterprise/format pair, the decoded record is stored by the given name.
+func RegisterCounterRecordDecoder(enterprise, format uint32, name string, d EnterpriseDecoder) {
+	register(counterRecordDecoders, enterprise, format, name, d)
+}
+
+func register(registry map[dataFormat]registeredDecoder, enterprise, format uint32, name string, d EnterpriseDecoder) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	registry[dataFormat{enterprise, format}] = registeredDecoder{name, d}
+}
+
+func lookup(registry map[dataFormat]registeredDecoder, sfType uint32) (registeredDecoder, bool) {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+
+	d, ok := registry[dataFormat{sfType >> 12, sfType & 0xfff}]
+
+	return d, ok
+}
+
+// EnterpriseErrors returns the number of the samples and records
+// which the registered decoders failed to decode
+func EnterpriseErrors() uint64 {
+	return atomic.LoadUint64(&enterpriseErrors)
+}
+
+// decodeRegistered decodes the structure through the registered decoder,
+// it returns false if there is no decoder for the data format. The
+// structure which the decoder fails is counted and skipped so the rest
+// of the datagram is still decoded.
+func decodeRegistered(b []byte, registry map[dataFormat]registeredDecoder,
+	sfType uint32) (string, interface{}, bool) {
+
+	d, ok := lookup(registry, sfType)
+	if !ok {
+		return "", nil, false
+	}
+
+	v, err := d.decode(b)
+	if err != nil {
+		atomic.AddUint64(&enterpriseErrors, 1)
+		return "", nil, false
+	}
+
+	return d.name, v, true
+}
@@ -22,7 +22,7 @@
 
 package sflow
 
-import "io"
+import "github.com/EdgeCast/vflow/reader"
 
 const (
 	// SFGenericInterfaceCounters is Generic interface counters - see RFC 2233
@@ -40,8 +40,23 @@ const (
 	// SFVLANCounters is VLAN counters
 	SFVLANCounters = 5
 
+	// SFLAGPortCounters is IEEE 802.3ad link aggregation port statistics
+	SFLAGPortCounters = 7
+
+	// SFSFPCounters is optical SFP/QSFP module counters
+	SFSFPCounters = 10
+
 	// SFProcessorCounters is processor counters
 	SFProcessorCounters = 1001
+
+	// SFRadioUtilizationCounters is 802.11 radio utilization counters
+	SFRadioUtilizationCounters = 1002
+
+	// SFOpenFlowPortCounters is OpenFlow port counters
+	SFOpenFlowPortCounters = 1004
+
+	// SFPortNameCounters is port name counters
+	SFPortNameCounters = 1005
 )
 
 // GenericInterfaceCounters represents Generic Interface Counters RFC2233
@@ -143,84 +158,259 @@ type ProcessorCounters struct {
 	FreeMemory  uint64
 }
 
+// LAGPortCounters represents IEEE 802.3ad Link Aggregation port statistics
+type LAGPortCounters struct {
+	ActorSystemID        string
+	PartnerSystemID      string
+	AttachedAggID        uint32
+	ActorAdminState      uint8
+	ActorOperState       uint8
+	PartnerAdminState    uint8
+	PartnerOperState     uint8
+	LACPDUsRx            uint32
+	MarkerPDUsRx         uint32
+	MarkerResponsePDUsRx uint32
+	UnknownRx            uint32
+	IllegalRx            uint32
+	LACPDUsTx            uint32
+	MarkerPDUsTx         uint32
+	MarkerResponsePDUsTx uint32
+}
+
+// SFPLane represents optical lane of a SFP module
+type SFPLane struct {
+	Index         uint32
+	TxBiasCurrent uint32 // microamps
+	TxPower       uint32 // microwatts
+	TxPowerMin    uint32
+	TxPowerMax    uint32
+	TxWavelength  uint32 // nanometers
+	RxPower       uint32 // microwatts
+	RxPowerMin    uint32
+	RxPowerMax    uint32
+	RxWavelength  uint32 // nanometers
+}
+
+// SFPCounters represents optical SFP/QSFP module counters
+type SFPCounters struct {
+	ModuleID            uint32
+	ModuleTotalLanes    uint32
+	ModuleSupplyVoltage uint32 // millivolts
+	ModuleTemperature   int32  // thousandths of a degree Celsius
+	Lanes               []SFPLane
+}
+
+// RadioUtilizationCounters represents 802.11 radio utilization
+type RadioUtilizationCounters struct {
+	ElapsedTime       uint32 // milliseconds
+	OnChannelTime     uint32 // milliseconds
+	OnChannelBusyTime uint32 // milliseconds
+}
+
+// OpenFlowPortCounters represents OpenFlow port
+type OpenFlowPortCounters struct {
+	DatapathID uint64
+	PortNo     uint32
+}
+
+// PortNameCounters represents port name
+type PortNameCounters struct {
+	Name string
+}
+
 // CounterSample represents the periodic sampling or polling of counters associated with a Data Source
 type CounterSample struct {
 	SequenceNo   uint32
-	SourceIDType byte
+	SourceIDType uint32
 	SourceIDIdx  uint32
 	RecordsNo    uint32
-	Records      map[string]Record
+	Records      []Record
 }
 
-func decodeFlowCounter(r io.ReadSeeker) (*CounterSample, error) {
+func decodeFlowCounter(r *reader.Reader, expanded bool) (*CounterSample, error) {
 	var (
-		cs          = new(CounterSample)
+		cs          = newCounterSample()
+		record      reader.Reader
 		rTypeFormat uint32
 		rTypeLength uint32
 		err         error
 	)
 
-	if err = cs.unmarshal(r); err != nil {
+	if expanded {
+		err = cs.unmarshalExpanded(r)
+	} else {
+		err = cs.unmarshal(r)
+	}
+	if err != nil {
+		cs.release()
 		return nil, err
 	}
 
-	cs.Records = make(map[string]Record)
-
 	for i := uint32(0); i < cs.RecordsNo; i++ {
-		if err = read(r, &rTypeFormat); err != nil {
-			return nil, err
+		if rTypeFormat, err = r.Uint32(); err != nil {
+			return cs, err
+		}
+		if rTypeLength, err = r.Uint32(); err != nil {
+			return cs, err
 		}
-		if err = read(r, &rTypeLength); err != nil {
-			return nil, err
+
+		data, err := r.Read(int(rTypeLength))
+		if err != nil {
+			return cs, errRecordLengthInvalid
 		}
+		record.Reset(data)
 
 		switch rTypeFormat {
 
 		case SFGenericInterfaceCounters:
-			d, err := decodeGenericIntCounters(r)
+			d, err := decodeGenericIntCounters(&record)
 			if err != nil {
 				return cs, err
 			}
-			cs.Records["GenInt"] = d
+			cs.Records = append(cs.Records, newRecord(rTypeFormat, "GenInt", d))
 		case SFEthernetInterfaceCounters:
-			d, err := decodeEthIntCounters(r)
+			d, err := decodeEthIntCounters(&record)
 			if err != nil {
 				return cs, err
 			}
-			cs.Records["EthInt"] = d
+			cs.Records = append(cs.Records, newRecord(rTypeFormat, "EthInt", d))
 		case SFTokenRingInterfaceCounters:
-			d, err := decodeTokenRingCounters(r)
+			d, err := decodeTokenRingCounters(&record)
 			if err != nil {
 				return cs, err
 			}
-			cs.Records["TRInt"] = d
+			cs.Records = append(cs.Records, newRecord(rTypeFormat, "TRInt", d))
 		case SF100BaseVGInterfaceCounters:
-			d, err := decodeVGCounters(r)
+			d, err := decodeVGCounters(&record)
 			if err != nil {
 				return cs, err
 			}
-			cs.Records["VGInt"] = d
+			cs.Records = append(cs.Records, newRecord(rTypeFormat, "VGInt", d))
 		case SFVLANCounters:
-			d, err := decodeVlanCounters(r)
+			d, err := decodeVlanCounters(&record)
 			if err != nil {
 				return cs, err
 			}
-			cs.Records["Vlan"] = d
+			cs.Records = append(cs.Records, newRecord(rTypeFormat, "Vlan", d))
 		case SFProcessorCounters:
-			d, err := decodedProcessorCounters(r)
+			d, err := decodedProcessorCounters(&record)
+			if err != nil {
+				return cs, err
+			}
+			cs.Records = append(cs.Records, newRecord(rTypeFormat, "Proc", d))
+		case SFLAGPortCounters:
+			d, err := decodeLAGPortCounters(&record)
+			if err != nil {
+				return cs, err
+			}
+			cs.Records = append(cs.Records, newRecord(rTypeFormat, "LAG", d))
+		case SFSFPCounters:
+			d, err := decodeSFPCounters(&record)
+			if err != nil {
+				return cs, err
+			}
+			cs.Records = append(cs.Records, newRecord(rTypeFormat, "SFP", d))
+		case SFRadioUtilizationCounters:
+			d, err := decodeRadioUtilizationCounters(&record)
+			if err != nil {
+				return cs, err
+			}
+			cs.Records = append(cs.Records, newRecord(rTypeFormat, "Radio", d))
+		case SFOpenFlowPortCounters:
+			d, err := decodeOpenFlowPortCounters(&record)
+			if err != nil {
+				return cs, err
+			}
+			cs.Records = append(cs.Records, newRecord(rTypeFormat, "OFPort", d))
+		case SFPortNameCounters:
+			d, err := decodePortNameCounters(&record)
+			if err != nil {
+				return cs, err
+			}
+			cs.Records = append(cs.Records, newRecord(rTypeFormat, "PortName", d))
+		case SFHostDescrCounters:
+			d, err := decodeHostDescrCounters(&record)
+			if err != nil {
+				return cs, err
+			}
+			cs.Records = append(cs.Records, newRecord(rTypeFormat, "HostDescr", d))
+		case SFHostAdaptersCounters:
+			d, err := decodeHostAdaptersCounters(&record)
+			if err != nil {
+				return cs, err
+			}
+			cs.Records = append(cs.Records, newRecord(rTypeFormat, "HostAdapters", d))
+		case SFHostParentCounters:
+			d, err := decodeHostParentCounters(&record)
+			if err != nil {
+				return cs, err
+			}
+			cs.Records = append(cs.Records, newRecord(rTypeFormat, "HostParent", d))
+		case SFHostCPUCounters:
+			d, err := decodeHostCPUCounters(&record, rTypeLength)
 			if err != nil {
 				return cs, err
 			}
-			cs.Records["Proc"] = d
+			cs.Records = append(cs.Records, newRecord(rTypeFormat, "HostCPU", d))
+		case SFHostMemoryCounters:
+			d, err := decodeHostMemoryCounters(&record)
+			if err != nil {
+				return cs, err
+			}
+			cs.Records = append(cs.Records, newRecord(rTypeFormat, "HostMem", d))
+		case SFHostDiskIOCounters:
+			d, err := decodeHostDiskIOCounters(&record)
+			if err != nil {
+				return cs, err
+			}
+			cs.Records = append(cs.Records, newRecord(rTypeFormat, "HostDisk", d))
+		case SFHostNetIOCounters:
+			d, err := decodeNetIOCounters(&record)
+			if err != nil {
+				return cs, err
+			}
+			cs.Records = append(cs.Records, newRecord(rTypeFormat, "HostNet", d))
+		case SFVirtNodeCounters:
+			d, err := decodeVirtNodeCounters(&record)
+			if err != nil {
+				return cs, err
+			}
+			cs.Records = append(cs.Records, newRecord(rTypeFormat, "VirtNode", d))
+		case SFVirtCPUCounters:
+			d, err := decodeVirtCPUCounters(&record)
+			if err != nil {
+				return cs, err
+			}
+			cs.Records = append(cs.Records, newRecord(rTypeFormat, "VirtCPU", d))
+		case SFVirtMemoryCounters:
+			d, err := decodeVirtMemoryCounters(&record)
+			if err != nil {
+				return cs, err
+			}
+			cs.Records = append(cs.Records, newRecord(rTypeFormat, "VirtMem", d))
+		case SFVirtDiskIOCounters:
+			d, err := decodeVirtDiskIOCounters(&record)
+			if err != nil {
+				return cs, err
+			}
+			cs.Records = append(cs.Records, newRecord(rTypeFormat, "VirtDisk", d))
+		case SFVirtNetIOCounters:
+			d, err := decodeNetIOCounters(&record)
+			if err != nil {
+				return cs, err
+			}
+			cs.Records = append(cs.Records, newRecord(rTypeFormat, "VirtNet", d))
 		default:
-			r.Seek(int64(rTypeLength), 1)
+			if name, d, ok := decodeRegistered(data, counterRecordDecoders, rTypeFormat); ok {
+				cs.Records = append(cs.Records, newRecord(rTypeFormat, name, d))
+			}
 		}
 	}
 
 	return cs, nil
 }
 
-func decodeGenericIntCounters(r io.Reader) (*GenericInterfaceCounters, error) {
+func decodeGenericIntCounters(r *reader.Reader) (*GenericInterfaceCounters, error) {
 	var gic = new(GenericInterfaceCounters)
 
 	if err := gic.unmarshal(r); err != nil {
@@ -230,7 +420,7 @@ func decodeGenericIntCounters(r io.Reader) (*GenericInterfaceCounters, error) {
 	return gic, nil
 }
 
-func (gic *GenericInterfaceCounters) unmarshal(r io.Reader) error {
+func (gic *GenericInterfaceCounters) unmarshal(r *reader.Reader) error {
 	var err error
 
 	fields := []interface{}{
@@ -263,7 +453,7 @@ func (gic *GenericInterfaceCounters) unmarshal(r io.Reader) error {
 
 	return nil
 }
-func decodeEthIntCounters(r io.Reader) (*EthernetInterfaceCounters, error) {
+func decodeEthIntCounters(r *reader.Reader) (*EthernetInterfaceCounters, error) {
 	var eic = new(EthernetInterfaceCounters)
 
 	if err := eic.unmarshal(r); err != nil {
@@ -273,7 +463,7 @@ func decodeEthIntCounters(r io.Reader) (*EthernetInterfaceCounters, error) {
 	return eic, nil
 }
 
-func (eic *EthernetInterfaceCounters) unmarshal(r io.Reader) error {
+func (eic *EthernetInterfaceCounters) unmarshal(r *reader.Reader) error {
 	var err error
 
 	fields := []interface{}{
@@ -300,7 +490,7 @@ func (eic *EthernetInterfaceCounters) unmarshal(r io.Reader) error {
 
 	return nil
 }
-func decodeTokenRingCounters(r io.Reader) (*TokenRingCounters, error) {
+func decodeTokenRingCounters(r *reader.Reader) (*TokenRingCounters, error) {
 	var tr = new(TokenRingCounters)
 
 	if err := tr.unmarshal(r); err != nil {
@@ -310,7 +500,7 @@ func decodeTokenRingCounters(r io.Reader) (*TokenRingCounters, error) {
 	return tr, nil
 }
 
-func (tr *TokenRingCounters) unmarshal(r io.Reader) error {
+func (tr *TokenRingCounters) unmarshal(r *reader.Reader) error {
 	var err error
 
 	fields := []interface{}{
@@ -343,7 +533,7 @@ func (tr *TokenRingCounters) unmarshal(r io.Reader) error {
 	return nil
 }
 
-func decodeVGCounters(r io.Reader) (*VGCounters, error) {
+func decodeVGCounters(r *reader.Reader) (*VGCounters, error) {
 	var vg = new(VGCounters)
 
 	if err := vg.unmarshal(r); err != nil {
@@ -353,7 +543,7 @@ func decodeVGCounters(r io.Reader) (*VGCounters, error) {
 	return vg, nil
 }
 
-func (vg *VGCounters) unmarshal(r io.Reader) error {
+func (vg *VGCounters) unmarshal(r *reader.Reader) error {
 	var err error
 
 	fields := []interface{}{
@@ -382,7 +572,7 @@ func (vg *VGCounters) unmarshal(r io.Reader) error {
 	return nil
 }
 
-func decodeVlanCounters(r io.Reader) (*VlanCounters, error) {
+func decodeVlanCounters(r *reader.Reader) (*VlanCounters, error) {
 	var vc = new(VlanCounters)
 
 	if err := vc.unmarshal(r); err != nil {
@@ -392,7 +582,7 @@ func decodeVlanCounters(r io.Reader) (*VlanCounters, error) {
 	return vc, nil
 }
 
-func (vc *VlanCounters) unmarshal(r io.Reader) error {
+func (vc *VlanCounters) unmarshal(r *reader.Reader) error {
 	var err error
 	fields := []interface{}{
 		&vc.ID,
@@ -412,7 +602,7 @@ func (vc *VlanCounters) unmarshal(r io.Reader) error {
 	return nil
 }
 
-func decodedProcessorCounters(r io.Reader) (*ProcessorCounters, error) {
+func decodedProcessorCounters(r *reader.Reader) (*ProcessorCounters, error) {
 	var pc = new(ProcessorCounters)
 
 	if err := pc.unmarshal(r); err != nil {
@@ -422,7 +612,7 @@ func decodedProcessorCounters(r io.Reader) (*ProcessorCounters, error) {
 	return pc, nil
 }
 
-func (pc *ProcessorCounters) unmarshal(r io.Reader) error {
+func (pc *ProcessorCounters) unmarshal(r *reader.Reader) error {
 	var err error
 	fields := []interface{}{
 		&pc.CPU5s,
@@ -441,23 +631,213 @@ func (pc *ProcessorCounters) unmarshal(r io.Reader) error {
 	return nil
 }
 
-func (cs *CounterSample) unmarshal(r io.Reader) error {
+func decodeLAGPortCounters(r *reader.Reader) (*LAGPortCounters, error) {
+	var lag = new(LAGPortCounters)
+
+	if err := lag.unmarshal(r); err != nil {
+		return nil, err
+	}
+
+	return lag, nil
+}
+
+func (lag *LAGPortCounters) unmarshal(r *reader.Reader) error {
+	var err error
+
+	if lag.ActorSystemID, err = readMAC(r); err != nil {
+		return err
+	}
+
+	if lag.PartnerSystemID, err = readMAC(r); err != nil {
+		return err
+	}
+
+	fields := []interface{}{
+		&lag.AttachedAggID,
+		&lag.ActorAdminState,
+		&lag.ActorOperState,
+		&lag.PartnerAdminState,
+		&lag.PartnerOperState,
+		&lag.LACPDUsRx,
+		&lag.MarkerPDUsRx,
+		&lag.MarkerResponsePDUsRx,
+		&lag.UnknownRx,
+		&lag.IllegalRx,
+		&lag.LACPDUsTx,
+		&lag.MarkerPDUsTx,
+		&lag.MarkerResponsePDUsTx,
+	}
+
+	for _, field := range fields {
+		if err = read(r, field); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func decodeSFPCounters(r *reader.Reader) (*SFPCounters, error) {
+	var sfp = new(SFPCounters)
+
+	if err := sfp.unmarshal(r); err != nil {
+		return nil, err
+	}
+
+	return sfp, nil
+}
+
+func (sfp *SFPCounters) unmarshal(r *reader.Reader) error {
+	var (
+		lanes uint32
+		err   error
+	)
+
+	fields := []interface{}{
+		&sfp.ModuleID,
+		&sfp.ModuleTotalLanes,
+		&sfp.ModuleSupplyVoltage,
+		&sfp.ModuleTemperature,
+		&lanes,
+	}
+
+	for _, field := range fields {
+		if err = read(r, field); err != nil {
+			return err
+		}
+	}
+
+	if lanes > maxOpaqueLength/40 {
+		return errDataLengthInvalid
+	}
+
+	sfp.Lanes = make([]SFPLane, lanes)
+	for i := range sfp.Lanes {
+		if err = sfp.Lanes[i].unmarshal(r); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (l *SFPLane) unmarshal(r *reader.Reader) error {
+	var err error
+
+	fields := []interface{}{
+		&l.Index,
+		&l.TxBiasCurrent,
+		&l.TxPower,
+		&l.TxPowerMin,
+		&l.TxPowerMax,
+		&l.TxWavelength,
+		&l.RxPower,
+		&l.RxPowerMin,
+		&l.RxPowerMax,
+		&l.RxWavelength,
+	}
+
+	for _, field := range fields {
+		if err = read(r, field); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func decodeRadioUtilizationCounters(r *reader.Reader) (*RadioUtilizationCounters, error) {
+	var ru = new(RadioUtilizationCounters)
+
+	if err := ru.unmarshal(r); err != nil {
+		return nil, err
+	}
+
+	return ru, nil
+}
+
+func (ru *RadioUtilizationCounters) unmarshal(r *reader.Reader) error {
+	var err error
+
+	fields := []interface{}{
+		&ru.ElapsedTime,
+		&ru.OnChannelTime,
+		&ru.OnChannelBusyTime,
+	}
+
+	for _, field := range fields {
+		if err = read(r, field); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func decodeOpenFlowPortCounters(r *reader.Reader) (*OpenFlowPortCounters, error) {
+	var of = new(OpenFlowPortCounters)
+
+	if err := read(r, &of.DatapathID); err != nil {
+		return nil, err
+	}
+
+	if err := read(r, &of.PortNo); err != nil {
+		return nil, err
+	}
+
+	return of, nil
+}
+
+func decodePortNameCounters(r *reader.Reader) (*PortNameCounters, error) {
+	var (
+		pn  = new(PortNameCounters)
+		err error
+	)
+
+	if pn.Name, err = readString(r); err != nil {
+		return nil, err
+	}
+
+	return pn, nil
+}
+
+func (cs *CounterSample) unmarshal(r *reader.Reader) error {
+	var (
+		sourceID uint32
+		err      error
+	)
+
+	if err = read(r, &cs.SequenceNo); err != nil {
+		return err
+	}
+
+	// source id type (8 bits) and index (24 bits)
+	if err = read(r, &sourceID); err != nil {
+		return err
+	}
+	cs.SourceIDType = sourceID >> 24
+	cs.SourceIDIdx = sourceID & 0x00ffffff
+
+	err = read(r, &cs.RecordsNo)
+
+	return err
+}
 
+func (cs *CounterSample) unmarshalExpanded(r *reader.Reader) error {
 	var err error
 
 	if err = read(r, &cs.SequenceNo); err != nil {
 		return err
 	}
 
+	// source id type and index are 32 bits each
 	if err = read(r, &cs.SourceIDType); err != nil {
 		return err
 	}
 
-	buf := make([]byte, 3)
-	if err = read(r, &buf); err != nil {
+	if err = read(r, &cs.SourceIDIdx); err != nil {
 		return err
 	}
-	cs.SourceIDIdx = uint32(buf[2]) | uint32(buf[1])<<8 | uint32(buf[0])<<16
 
 	err = read(r, &cs.RecordsNo)
 
@@ -0,0 +1,601 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    flow_record.go
+//: details: sflow flow sample records decoders
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package sflow
+
+import (
+	"net"
+
+	"github.com/EdgeCast/vflow/reader"
+)
+
+// EthFrameData represents Ethernet Frame Data
+type EthFrameData struct {
+	Length uint32 // The length of the MAC packet received on the network
+	SrcMAC string // Source MAC address
+	DstMAC string // Destination MAC address
+	Type   uint32 // Ethernet packet type
+}
+
+// IPv4Data represents Packet IP version 4 Data
+type IPv4Data struct {
+	Length   uint32 // The length of the IP packet excluding lower layer encapsulations
+	Protocol uint32 // IP Protocol type (for example, TCP = 6, UDP = 17)
+	SrcIP    net.IP // Source IP Address
+	DstIP    net.IP // Destination IP Address
+	SrcPort  uint32 // TCP/UDP source port number or equivalent
+	DstPort  uint32 // TCP/UDP destination port number or equivalent
+	TCPFlags uint32 // TCP flags
+	TOS      uint32 // IP type of service
+}
+
+// IPv6Data represents Packet IP Version 6 Data
+type IPv6Data struct {
+	Length   uint32 // The length of the IP packet excluding lower layer encapsulations
+	Protocol uint32 // IP next header (for example, TCP = 6, UDP = 17)
+	SrcIP    net.IP // Source IP Address
+	DstIP    net.IP // Destination IP Address
+	SrcPort  uint32 // TCP/UDP source port number or equivalent
+	DstPort  uint32 // TCP/UDP destination port number or equivalent
+	TCPFlags uint32 // TCP flags
+	Priority uint32 // IP priority
+}
+
+// ASPathSegment represents BGP AS path segment
+type ASPathSegment struct {
+	Type      uint32   // 1 = AS_SET, 2 = AS_SEQUENCE
+	ASNumbers []uint32 // AS numbers
+}
+
+// ExtGatewayData represents Extended Gateway Data
+type ExtGatewayData struct {
+	NextHop     net.IP          // Address of the border router that should be used for the destination network
+	AS          uint32          // Autonomous system number of router
+	SrcAS       uint32          // Autonomous system number of source
+	SrcPeerAS   uint32          // Autonomous system number of source peer
+	DstASPath   []ASPathSegment // Autonomous system path to the destination
+	Communities []uint32        // Communities associated with this route
+	LocalPref   uint32          // LocalPref associated with this route
+}
+
+// ExtUserData represents Extended User Data
+type ExtUserData struct {
+	SrcCharset uint32 // Character set for src user (MIBEnum value)
+	SrcUser    string // User ID associated with packet source
+	DstCharset uint32 // Character set for dst user (MIBEnum value)
+	DstUser    string // User ID associated with packet destination
+}
+
+// ExtURLData represents Extended URL Data
+type ExtURLData struct {
+	Direction uint32 // 1 = source, 2 = destination
+	URL       string // URL associated with the packet flow
+	Host      string // The host field from the HTTP header
+}
+
+// ExtMPLSData represents Extended MPLS Data
+type ExtMPLSData struct {
+	NextHop  net.IP   // Address of the next hop
+	InStack  []uint32 // Label stack of received packet
+	OutStack []uint32 // Label stack for transmitted packet
+}
+
+// ExtNATData represents Extended NAT Data
+type ExtNATData struct {
+	SrcIP net.IP // Source address
+	DstIP net.IP // Destination address
+}
+
+// ExtMPLSTunnelData represents Extended MPLS Tunnel
+type ExtMPLSTunnelData struct {
+	TunnelLSPName string // Tunnel name
+	TunnelID      uint32 // Tunnel ID
+	TunnelCOS     uint32 // Tunnel COS value
+}
+
+// ExtMPLSVCData represents Extended MPLS Virtual Circuit
+type ExtMPLSVCData struct {
+	VCInstanceName string // VC instance name
+	VLLVCID        uint32 // VLL/VC instance ID
+	VCLabelCOS     uint32 // VC Label COS value
+}
+
+// ExtMPLSFECData represents Extended MPLS FEC
+type ExtMPLSFECData struct {
+	FTNDescr string // FTN description
+	FTNMask  uint32 // FTN mask
+}
+
+// ExtMPLSLVPFECData represents Extended MPLS LVP FEC
+type ExtMPLSLVPFECData struct {
+	FecAddrPrefixLength uint32 // Length of the address prefix
+}
+
+// ExtVlanTunnelData represents Extended VLAN tunnel
+type ExtVlanTunnelData struct {
+	Stack []uint32 // List of stripped 802.1Q TPID/TCI layers
+}
+
+// Ext80211PayloadData represents Extended 802.11 Payload
+type Ext80211PayloadData struct {
+	CipherSuite uint32 // Cipher suite used to decrypt the payload
+	Data        []byte // Unencrypted payload
+}
+
+// Ext80211RXData represents Extended 802.11 RX
+type Ext80211RXData struct {
+	SSID           string // SSID string
+	BSSID          string // BSSID
+	Version        uint32 // Version (1 = a, 2 = b, 3 = g, 4 = n)
+	Channel        uint32 // Channel number
+	Speed          uint64 // Speed
+	RSNI           uint32 // Received signal to noise ratio
+	RCPI           uint32 // Received channel power
+	PacketDuration uint32 // Amount of time that the successfully received frame occupied the medium
+}
+
+// Ext80211TXData represents Extended 802.11 TX
+type Ext80211TXData struct {
+	SSID            string // SSID string
+	BSSID           string // BSSID
+	Version         uint32 // Version (1 = a, 2 = b, 3 = g, 4 = n)
+	Transmissions   uint32 // Number of transmissions for sampled packet
+	PacketDuration  uint32 // Amount of time that the successful transmission occupied the medium
+	RetransDuration uint32 // Amount of time that failed transmission attempts occupied the medium
+	Channel         uint32 // Channel number
+	Speed           uint64 // Speed
+	Power           uint32 // Transmit power in mW
+}
+
+// Ext80211AggregationData represents Extended 802.11 Aggregation
+type Ext80211AggregationData struct {
+	PDUs [][]Record // Records of each aggregated PDU
+}
+
+func decodeEthFrameData(r *reader.Reader) (*EthFrameData, error) {
+	var (
+		ef  = new(EthFrameData)
+		err error
+	)
+
+	if err = read(r, &ef.Length); err != nil {
+		return nil, err
+	}
+
+	if ef.SrcMAC, err = readMAC(r); err != nil {
+		return nil, err
+	}
+
+	if ef.DstMAC, err = readMAC(r); err != nil {
+		return nil, err
+	}
+
+	if err = read(r, &ef.Type); err != nil {
+		return nil, err
+	}
+
+	return ef, nil
+}
+
+func decodeIPv4Data(r *reader.Reader) (*IPv4Data, error) {
+	var (
+		ip  = new(IPv4Data)
+		err error
+	)
+
+	if err = read(r, &ip.Length); err != nil {
+		return nil, err
+	}
+
+	if err = read(r, &ip.Protocol); err != nil {
+		return nil, err
+	}
+
+	if ip.SrcIP, err = r.Read(4); err != nil {
+		return nil, err
+	}
+
+	if ip.DstIP, err = r.Read(4); err != nil {
+		return nil, err
+	}
+
+	fields := []interface{}{
+		&ip.SrcPort,
+		&ip.DstPort,
+		&ip.TCPFlags,
+		&ip.TOS,
+	}
+
+	for _, field := range fields {
+		if err = read(r, field); err != nil {
+			return nil, err
+		}
+	}
+
+	return ip, nil
+}
+
+func decodeIPv6Data(r *reader.Reader) (*IPv6Data, error) {
+	var (
+		ip  = new(IPv6Data)
+		err error
+	)
+
+	if err = read(r, &ip.Length); err != nil {
+		return nil, err
+	}
+
+	if err = read(r, &ip.Protocol); err != nil {
+		return nil, err
+	}
+
+	if ip.SrcIP, err = r.Read(16); err != nil {
+		return nil, err
+	}
+
+	if ip.DstIP, err = r.Read(16); err != nil {
+		return nil, err
+	}
+
+	fields := []interface{}{
+		&ip.SrcPort,
+		&ip.DstPort,
+		&ip.TCPFlags,
+		&ip.Priority,
+	}
+
+	for _, field := range fields {
+		if err = read(r, field); err != nil {
+			return nil, err
+		}
+	}
+
+	return ip, nil
+}
+
+func decodeExtGatewayData(r *reader.Reader) (*ExtGatewayData, error) {
+	var (
+		eg       = new(ExtGatewayData)
+		segments uint32
+		err      error
+	)
+
+	if eg.NextHop, err = readAddress(r); err != nil {
+		return nil, err
+	}
+
+	fields := []interface{}{
+		&eg.AS,
+		&eg.SrcAS,
+		&eg.SrcPeerAS,
+		&segments,
+	}
+
+	for _, field := range fields {
+		if err = read(r, field); err != nil {
+			return nil, err
+		}
+	}
+
+	if segments > maxOpaqueLength/8 {
+		return nil, errDataLengthInvalid
+	}
+
+	eg.DstASPath = make([]ASPathSegment, segments)
+	for i := range eg.DstASPath {
+		if err = read(r, &eg.DstASPath[i].Type); err != nil {
+			return nil, err
+		}
+
+		if eg.DstASPath[i].ASNumbers, err = readUint32Array(r); err != nil {
+			return nil, err
+		}
+	}
+
+	if eg.Communities, err = readUint32Array(r); err != nil {
+		return nil, err
+	}
+
+	if err = read(r, &eg.LocalPref); err != nil {
+		return nil, err
+	}
+
+	return eg, nil
+}
+
+func decodeExtUserData(r *reader.Reader) (*ExtUserData, error) {
+	var (
+		eu  = new(ExtUserData)
+		err error
+	)
+
+	if err = read(r, &eu.SrcCharset); err != nil {
+		return nil, err
+	}
+
+	if eu.SrcUser, err = readString(r); err != nil {
+		return nil, err
+	}
+
+	if err = read(r, &eu.DstCharset); err != nil {
+		return nil, err
+	}
+
+	if eu.DstUser, err = readString(r); err != nil {
+		return nil, err
+	}
+
+	return eu, nil
+}
+
+func decodeExtURLData(r *reader.Reader) (*ExtURLData, error) {
+	var (
+		eu  = new(ExtURLData)
+		err error
+	)
+
+	if err = read(r, &eu.Direction); err != nil {
+		return nil, err
+	}
+
+	if eu.URL, err = readString(r); err != nil {
+		return nil, err
+	}
+
+	if eu.Host, err = readString(r); err != nil {
+		return nil, err
+	}
+
+	return eu, nil
+}
+
+func decodeExtMPLSData(r *reader.Reader) (*ExtMPLSData, error) {
+	var (
+		em  = new(ExtMPLSData)
+		err error
+	)
+
+	if em.NextHop, err = readAddress(r); err != nil {
+		return nil, err
+	}
+
+	if em.InStack, err = readUint32Array(r); err != nil {
+		return nil, err
+	}
+
+	if em.OutStack, err = readUint32Array(r); err != nil {
+		return nil, err
+	}
+
+	return em, nil
+}
+
+func decodeExtNATData(r *reader.Reader) (*ExtNATData, error) {
+	var (
+		en  = new(ExtNATData)
+		err error
+	)
+
+	if en.SrcIP, err = readAddress(r); err != nil {
+		return nil, err
+	}
+
+	if en.DstIP, err = readAddress(r); err != nil {
+		return nil, err
+	}
+
+	return en, nil
+}
+
+func decodeExtMPLSTunnelData(r *reader.Reader) (*ExtMPLSTunnelData, error) {
+	var (
+		et  = new(ExtMPLSTunnelData)
+		err error
+	)
+
+	if et.TunnelLSPName, err = readString(r); err != nil {
+		return nil, err
+	}
+
+	if err = read(r, &et.TunnelID); err != nil {
+		return nil, err
+	}
+
+	if err = read(r, &et.TunnelCOS); err != nil {
+		return nil, err
+	}
+
+	return et, nil
+}
+
+func decodeExtMPLSVCData(r *reader.Reader) (*ExtMPLSVCData, error) {
+	var (
+		ev  = new(ExtMPLSVCData)
+		err error
+	)
+
+	if ev.VCInstanceName, err = readString(r); err != nil {
+		return nil, err
+	}
+
+	if err = read(r, &ev.VLLVCID); err != nil {
+		return nil, err
+	}
+
+	if err = read(r, &ev.VCLabelCOS); err != nil {
+		return nil, err
+	}
+
+	return ev, nil
+}
+
+func decodeExtMPLSFECData(r *reader.Reader) (*ExtMPLSFECData, error) {
+	var (
+		ef  = new(ExtMPLSFECData)
+		err error
+	)
+
+	if ef.FTNDescr, err = readString(r); err != nil {
+		return nil, err
+	}
+
+	if err = read(r, &ef.FTNMask); err != nil {
+		return nil, err
+	}
+
+	return ef, nil
+}
+
+func decodeExtMPLSLVPFECData(r *reader.Reader) (*ExtMPLSLVPFECData, error) {
+	var el = new(ExtMPLSLVPFECData)
+
+	if err := read(r, &el.FecAddrPrefixLength); err != nil {
+		return nil, err
+	}
+
+	return el, nil
+}
+
+func decodeExtVlanTunnelData(r *reader.Reader) (*ExtVlanTunnelData, error) {
+	var (
+		ev  = new(ExtVlanTunnelData)
+		err error
+	)
+
+	if ev.Stack, err = readUint32Array(r); err != nil {
+		return nil, err
+	}
+
+	return ev, nil
+}
+
+func decodeExt80211PayloadData(r *reader.Reader) (*Ext80211PayloadData, error) {
+	var (
+		ep  = new(Ext80211PayloadData)
+		err error
+	)
+
+	if err = read(r, &ep.CipherSuite); err != nil {
+		return nil, err
+	}
+
+	data, err := readOpaque(r)
+	if err != nil {
+		return nil, err
+	}
+	ep.Data = append([]byte{}, data...)
+
+	return ep, nil
+}
+
+func decodeExt80211RXData(r *reader.Reader) (*Ext80211RXData, error) {
+	var (
+		er  = new(Ext80211RXData)
+		err error
+	)
+
+	if er.SSID, err = readString(r); err != nil {
+		return nil, err
+	}
+
+	if er.BSSID, err = readMAC(r); err != nil {
+		return nil, err
+	}
+
+	fields := []interface{}{
+		&er.Version,
+		&er.Channel,
+		&er.Speed,
+		&er.RSNI,
+		&er.RCPI,
+		&er.PacketDuration,
+	}
+
+	for _, field := range fields {
+		if err = read(r, field); err != nil {
+			return nil, err
+		}
+	}
+
+	return er, nil
+}
+
+func decodeExt80211TXData(r *reader.Reader) (*Ext80211TXData, error) {
+	var (
+		et  = new(Ext80211TXData)
+		err error
+	)
+
+	if et.SSID, err = readString(r); err != nil {
+		return nil, err
+	}
+
+	if et.BSSID, err = readMAC(r); err != nil {
+		return nil, err
+	}
+
+	fields := []interface{}{
+		&et.Version,
+		&et.Transmissions,
+		&et.PacketDuration,
+		&et.RetransDuration,
+		&et.Channel,
+		&et.Speed,
+		&et.Power,
+	}
+
+	for _, field := range fields {
+		if err = read(r, field); err != nil {
+			return nil, err
+		}
+	}
+
+	return et, nil
+}
+
+func decodeExt80211AggregationData(r *reader.Reader) (*Ext80211AggregationData, error) {
+	var (
+		ea        = new(Ext80211AggregationData)
+		pdus      uint32
+		recordsNo uint32
+		err       error
+	)
+
+	if err = read(r, &pdus); err != nil {
+		return nil, err
+	}
+
+	if pdus > maxOpaqueLength/8 {
+		return nil, errDataLengthInvalid
+	}
+
+	ea.PDUs = make([][]Record, pdus)
+	for i := range ea.PDUs {
+		if err = read(r, &recordsNo); err != nil {
+			return nil, err
+		}
+
+		if ea.PDUs[i], err = decodeFlowRecords(r, recordsNo, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return ea, nil
+}
@@ -24,34 +24,88 @@ package sflow
 
 import (
 	"errors"
-	"io"
 	"net"
 
 	"github.com/EdgeCast/vflow/packet"
+	"github.com/EdgeCast/vflow/reader"
 )
 
 const (
 	// SFDataRawHeader is sFlow Raw Packet Header number
 	SFDataRawHeader = 1
 
+	// SFDataEthernetFrame is sFlow Ethernet Frame Data number
+	SFDataEthernetFrame = 2
+
+	// SFDataIPv4 is sFlow Packet IP version 4 Data number
+	SFDataIPv4 = 3
+
+	// SFDataIPv6 is sFlow Packet IP version 6 Data number
+	SFDataIPv6 = 4
+
 	// SFDataExtSwitch is sFlow Extended Switch Data number
 	SFDataExtSwitch = 1001
 
 	// SFDataExtRouter is sFlow Extended Router Data number
 	SFDataExtRouter = 1002
+
+	// SFDataExtGateway is sFlow Extended Gateway Data number
+	SFDataExtGateway = 1003
+
+	// SFDataExtUser is sFlow Extended User Data number
+	SFDataExtUser = 1004
+
+	// SFDataExtURL is sFlow Extended URL Data number
+	SFDataExtURL = 1005
+
+	// SFDataExtMPLS is sFlow Extended MPLS Data number
+	SFDataExtMPLS = 1006
+
+	// SFDataExtNAT is sFlow Extended NAT Data number
+	SFDataExtNAT = 1007
+
+	// SFDataExtMPLSTunnel is sFlow Extended MPLS Tunnel number
+	SFDataExtMPLSTunnel = 1008
+
+	// SFDataExtMPLSVC is sFlow Extended MPLS Virtual Circuit number
+	SFDataExtMPLSVC = 1009
+
+	// SFDataExtMPLSFEC is sFlow Extended MPLS FEC number
+	SFDataExtMPLSFEC = 1010
+
+	// SFDataExtMPLSLVPFEC is sFlow Extended MPLS LVP FEC number
+	SFDataExtMPLSLVPFEC = 1011
+
+	// SFDataExtVlanTunnel is sFlow Extended VLAN tunnel number
+	SFDataExtVlanTunnel = 1012
+
+	// SFDataExt80211Payload is sFlow Extended 802.11 Payload number
+	SFDataExt80211Payload = 1013
+
+	// SFDataExt80211RX is sFlow Extended 802.11 RX number
+	SFDataExt80211RX = 1014
+
+	// SFDataExt80211TX is sFlow Extended 802.11 TX number
+	SFDataExt80211TX = 1015
+
+	// SFDataExt80211Aggregation is sFlow Extended 802.11 Aggregation number
+	SFDataExt80211Aggregation = 1016
 )
 
 // FlowSample represents single flow sample
 type FlowSample struct {
 	SequenceNo   uint32 // Incremented with each flow sample
-	SourceID     byte   // sfSourceID
+	SourceID     uint32 // sfSourceID type
+	SourceIDIdx  uint32 // sfSourceID index
 	SamplingRate uint32 // sfPacketSamplingRate
 	SamplePool   uint32 // Total number of packets that could have been sampled
 	Drops        uint32 // Number of times a packet was dropped due to lack of resources
+	InputFormat  uint32 // Input interface format (0 = ifIndex, 1 = discarded, 2 = multiple)
 	Input        uint32 // SNMP ifIndex of input interface
-	Output       uint32 // SNMP ifIndex of input interface
+	OutputFormat uint32 // Output interface format (0 = ifIndex, 1 = discarded, 2 = multiple)
+	Output       uint32 // SNMP ifIndex of output interface
 	RecordsNo    uint32 // Number of records to follow
-	Records      map[string]Record
+	Records      []Record
 }
 
 // SampledHeader represents sampled header
@@ -82,18 +136,68 @@ var (
 	errMaxOutEthernetLength = errors.New("the ethernet length is greater than 1500")
 )
 
-func (fs *FlowSample) unmarshal(r io.ReadSeeker) error {
+func (fs *FlowSample) unmarshal(r *reader.Reader) error {
+	var (
+		sourceID uint32
+		err      error
+	)
+
+	if err = read(r, &fs.SequenceNo); err != nil {
+		return err
+	}
+
+	// source id type (8 bits) and index (24 bits)
+	if err = read(r, &sourceID); err != nil {
+		return err
+	}
+	fs.SourceID = sourceID >> 24
+	fs.SourceIDIdx = sourceID & 0x00ffffff
+
+	if err = read(r, &fs.SamplingRate); err != nil {
+		return err
+	}
+
+	if err = read(r, &fs.SamplePool); err != nil {
+		return err
+	}
+
+	if err = read(r, &fs.Drops); err != nil {
+		return err
+	}
+
+	// interface format (2 bits) and value (30 bits)
+	if err = read(r, &fs.Input); err != nil {
+		return err
+	}
+	fs.InputFormat = fs.Input >> 30
+	fs.Input &= 0x3fffffff
+
+	if err = read(r, &fs.Output); err != nil {
+		return err
+	}
+	fs.OutputFormat = fs.Output >> 30
+	fs.Output &= 0x3fffffff
+
+	err = read(r, &fs.RecordsNo)
+
+	return err
+}
+
+func (fs *FlowSample) unmarshalExpanded(r *reader.Reader) error {
 	var err error
 
 	if err = read(r, &fs.SequenceNo); err != nil {
 		return err
 	}
 
+	// source id type and index are 32 bits each
 	if err = read(r, &fs.SourceID); err != nil {
 		return err
 	}
 
-	r.Seek(3, 1) // skip counter sample decoding
+	if err = read(r, &fs.SourceIDIdx); err != nil {
+		return err
+	}
 
 	if err = read(r, &fs.SamplingRate); err != nil {
 		return err
@@ -107,10 +211,19 @@ func (fs *FlowSample) unmarshal(r io.ReadSeeker) error {
 		return err
 	}
 
+	// interface format and value are 32 bits each
+	if err = read(r, &fs.InputFormat); err != nil {
+		return err
+	}
+
 	if err = read(r, &fs.Input); err != nil {
 		return err
 	}
 
+	if err = read(r, &fs.OutputFormat); err != nil {
+		return err
+	}
+
 	if err = read(r, &fs.Output); err != nil {
 		return err
 	}
@@ -120,7 +233,7 @@ func (fs *FlowSample) unmarshal(r io.ReadSeeker) error {
 	return err
 }
 
-func (sh *SampledHeader) unmarshal(r io.Reader) error {
+func (sh *SampledHeader) unmarshal(r *reader.Reader) error {
 	var err error
 
 	if err = read(r, &sh.Protocol); err != nil {
@@ -143,23 +256,13 @@ func (sh *SampledHeader) unmarshal(r io.Reader) error {
 		return errMaxOutEthernetLength
 	}
 
-	// cut off a header length mod 4 == 0 number of bytes
-	tmp := (4 - sh.HeaderLength) % 4
-	if tmp < 0 {
-		tmp += 4
-	}
-
-	sh.Header = make([]byte, sh.HeaderLength+tmp)
-	if _, err = r.Read(sh.Header); err != nil {
-		return err
-	}
-
-	sh.Header = sh.Header[:sh.HeaderLength]
+	// the padding after the header bytes is skipped by the record length
+	sh.Header, err = r.Read(int(sh.HeaderLength))
 
-	return nil
+	return err
 }
 
-func (es *ExtSwitchData) unmarshal(r io.Reader) error {
+func (es *ExtSwitchData) unmarshal(r *reader.Reader) error {
 	var err error
 
 	if err = read(r, &es.SrcVlan); err != nil {
@@ -174,19 +277,17 @@ func (es *ExtSwitchData) unmarshal(r io.Reader) error {
 		return err
 	}
 
-	err = read(r, &es.SrcPriority)
+	err = read(r, &es.DstPriority)
 
 	return err
 }
 
-func (er *ExtRouterData) unmarshal(r io.Reader, l uint32) error {
+func (er *ExtRouterData) unmarshal(r *reader.Reader) error {
 	var err error
 
-	buff := make([]byte, l-8)
-	if err = read(r, &buff); err != nil {
+	if er.NextHop, err = readAddress(r); err != nil {
 		return err
 	}
-	er.NextHop = buff[4:]
 
 	if err = read(r, &er.SrcMask); err != nil {
 		return err
@@ -197,58 +298,152 @@ func (er *ExtRouterData) unmarshal(r io.Reader, l uint32) error {
 	return err
 }
 
-func decodeFlowSample(r io.ReadSeeker) (*FlowSample, error) {
+func decodeFlowSample(r *reader.Reader, expanded bool) (*FlowSample, error) {
 	var (
-		fs          = new(FlowSample)
-		rTypeFormat uint32
-		rTypeLength uint32
-		err         error
+		fs  = newFlowSample()
+		err error
 	)
 
-	if err = fs.unmarshal(r); err != nil {
+	if expanded {
+		err = fs.unmarshalExpanded(r)
+	} else {
+		err = fs.unmarshal(r)
+	}
+	if err != nil {
+		fs.release()
 		return nil, err
 	}
 
-	fs.Records = make(map[string]Record)
+	if fs.Records, err = decodeFlowRecords(r, fs.RecordsNo, fs.Records); err != nil {
+		return fs, err
+	}
+
+	return fs, nil
+}
+
+// decodeFlowRecords appends the decoded flow records to records
+func decodeFlowRecords(r *reader.Reader, recordsNo uint32, records []Record) ([]Record, error) {
+	var (
+		record      reader.Reader
+		rTypeFormat uint32
+		rTypeLength uint32
+		name        string
+		d           interface{}
+		ok          bool
+		err         error
+	)
 
-	for i := uint32(0); i < fs.RecordsNo; i++ {
-		if err = read(r, &rTypeFormat); err != nil {
-			return nil, err
+	for i := uint32(0); i < recordsNo; i++ {
+		if rTypeFormat, err = r.Uint32(); err != nil {
+			return records, err
+		}
+		if rTypeLength, err = r.Uint32(); err != nil {
+			return records, err
 		}
-		if err = read(r, &rTypeLength); err != nil {
-			return nil, err
+
+		data, err := r.Read(int(rTypeLength))
+		if err != nil {
+			return records, errRecordLengthInvalid
 		}
+		record.Reset(data)
 
-		switch rTypeFormat {
-		case SFDataRawHeader:
-			d, err := decodeSampledHeader(r)
-			if err != nil {
-				return fs, err
-			}
-			fs.Records["RawHeader"] = d
-		case SFDataExtSwitch:
-			d, err := decodeExtSwitchData(r)
-			if err != nil {
-				return fs, err
-			}
-
-			fs.Records["ExtSwitch"] = d
-		case SFDataExtRouter:
-			d, err := decodeExtRouterData(r, rTypeLength)
-			if err != nil {
-				return fs, err
-			}
-
-			fs.Records["ExtRouter"] = d
-		default:
-			r.Seek(int64(rTypeLength), 1)
+		name, d, ok, err = decodeFlowRecord(&record, rTypeFormat, data)
+		if err != nil {
+			return records, err
+		}
+		if ok {
+			records = append(records, newRecord(rTypeFormat, name, d))
 		}
 	}
 
-	return fs, nil
+	return records, nil
+}
+
+// decodeFlowRecord decodes a flow record, data is the raw record
+// which is used by the registered enterprise decoders
+func decodeFlowRecord(r *reader.Reader, rTypeFormat uint32, data []byte) (string, interface{}, bool, error) {
+	var (
+		d   interface{}
+		err error
+	)
+
+	switch rTypeFormat {
+	case SFDataRawHeader:
+		d, err = decodeSampledHeader(r)
+		return "RawHeader", d, err == nil, err
+	case SFDataEthernetFrame:
+		d, err = decodeEthFrameData(r)
+		return "EthernetFrame", d, err == nil, err
+	case SFDataIPv4:
+		d, err = decodeIPv4Data(r)
+		return "IPv4Data", d, err == nil, err
+	case SFDataIPv6:
+		d, err = decodeIPv6Data(r)
+		return "IPv6Data", d, err == nil, err
+	case SFDataExtSwitch:
+		d, err = decodeExtSwitchData(r)
+		return "ExtSwitch", d, err == nil, err
+	case SFDataExtRouter:
+		d, err = decodeExtRouterData(r)
+		return "ExtRouter", d, err == nil, err
+	case SFDataExtGateway:
+		d, err = decodeExtGatewayData(r)
+		return "ExtGateway", d, err == nil, err
+	case SFDataExtUser:
+		d, err = decodeExtUserData(r)
+		return "ExtUser", d, err == nil, err
+	case SFDataExtURL:
+		d, err = decodeExtURLData(r)
+		return "ExtURL", d, err == nil, err
+	case SFDataExtMPLS:
+		d, err = decodeExtMPLSData(r)
+		return "ExtMPLS", d, err == nil, err
+	case SFDataExtNAT:
+		d, err = decodeExtNATData(r)
+		return "ExtNAT", d, err == nil, err
+	case SFDataExtMPLSTunnel:
+		d, err = decodeExtMPLSTunnelData(r)
+		return "ExtMPLSTunnel", d, err == nil, err
+	case SFDataExtMPLSVC:
+		d, err = decodeExtMPLSVCData(r)
+		return "ExtMPLSVC", d, err == nil, err
+	case SFDataExtMPLSFEC:
+		d, err = decodeExtMPLSFECData(r)
+		return "ExtMPLSFEC", d, err == nil, err
+	case SFDataExtMPLSLVPFEC:
+		d, err = decodeExtMPLSLVPFECData(r)
+		return "ExtMPLSLVPFEC", d, err == nil, err
+	case SFDataExtVlanTunnel:
+		d, err = decodeExtVlanTunnelData(r)
+		return "ExtVlanTunnel", d, err == nil, err
+	case SFDataExt80211Payload:
+		d, err = decodeExt80211PayloadData(r)
+		return "Ext80211Payload", d, err == nil, err
+	case SFDataExt80211RX:
+		d, err = decodeExt80211RXData(r)
+		return "Ext80211RX", d, err == nil, err
+	case SFDataExt80211TX:
+		d, err = decodeExt80211TXData(r)
+		return "Ext80211TX", d, err == nil, err
+	case SFDataExt80211Aggregation:
+		d, err = decodeExt80211AggregationData(r)
+		return "Ext80211Aggregation", d, err == nil, err
+	default:
+		name, d, ok := decodeRegistered(data, flowRecordDecoders, rTypeFormat)
+		return name, d, ok, nil
+	}
+}
+
+// packetOptions is used to decode the sampled headers
+var packetOptions packet.Options
+
+// SetPacketOptions sets the sampled header decoding options, it
+// should be called before decoding e.g. to enable decapsulation.
+func SetPacketOptions(opts packet.Options) {
+	packetOptions = opts
 }
 
-func decodeSampledHeader(r io.Reader) (*packet.Packet, error) {
+func decodeSampledHeader(r *reader.Reader) (*packet.Packet, error) {
 	var (
 		h   = new(SampledHeader)
 		err error
@@ -258,16 +453,17 @@ func decodeSampledHeader(r io.Reader) (*packet.Packet, error) {
 		return nil, err
 	}
 
-	p := packet.NewPacket()
+	p := newPacket()
 	d, err := p.Decoder(h.Header, h.Protocol)
 	if err != nil {
+		packetPool.Put(p)
 		return nil, err
 	}
 
 	return d, nil
 }
 
-func decodeExtSwitchData(r io.Reader) (*ExtSwitchData, error) {
+func decodeExtSwitchData(r *reader.Reader) (*ExtSwitchData, error) {
 	var es = new(ExtSwitchData)
 
 	if err := es.unmarshal(r); err != nil {
@@ -277,10 +473,10 @@ func decodeExtSwitchData(r io.Reader) (*ExtSwitchData, error) {
 	return es, nil
 }
 
-func decodeExtRouterData(r io.Reader, l uint32) (*ExtRouterData, error) {
+func decodeExtRouterData(r *reader.Reader) (*ExtRouterData, error) {
 	var er = new(ExtRouterData)
 
-	if err := er.unmarshal(r, l); err != nil {
+	if err := er.unmarshal(r); err != nil {
 		return nil, err
 	}
 
@@ -0,0 +1,553 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    host_counter.go
+//: details: sflow host and virtual machine counters decoders
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package sflow
+
+import (
+	"fmt"
+
+	"github.com/EdgeCast/vflow/reader"
+)
+
+const (
+	// SFHostDescrCounters is Host sFlow physical or virtual host description
+	SFHostDescrCounters = 2000
+
+	// SFHostAdaptersCounters is Host sFlow host network adapters
+	SFHostAdaptersCounters = 2001
+
+	// SFHostParentCounters is Host sFlow host parent
+	SFHostParentCounters = 2002
+
+	// SFHostCPUCounters is Host sFlow physical server CPU
+	SFHostCPUCounters = 2003
+
+	// SFHostMemoryCounters is Host sFlow physical server memory
+	SFHostMemoryCounters = 2004
+
+	// SFHostDiskIOCounters is Host sFlow physical server disk I/O
+	SFHostDiskIOCounters = 2005
+
+	// SFHostNetIOCounters is Host sFlow physical server network I/O
+	SFHostNetIOCounters = 2006
+
+	// SFVirtNodeCounters is Host sFlow hypervisor node
+	SFVirtNodeCounters = 2100
+
+	// SFVirtCPUCounters is Host sFlow virtual domain CPU
+	SFVirtCPUCounters = 2101
+
+	// SFVirtMemoryCounters is Host sFlow virtual domain memory
+	SFVirtMemoryCounters = 2102
+
+	// SFVirtDiskIOCounters is Host sFlow virtual domain disk I/O
+	SFVirtDiskIOCounters = 2103
+
+	// SFVirtNetIOCounters is Host sFlow virtual domain network I/O
+	SFVirtNetIOCounters = 2104
+)
+
+// hostCPUBaseLength is the host cpu record length without
+// the optional steal, guest and guest nice counters
+const hostCPUBaseLength = 68
+
+// HostDescrCounters represents physical or virtual host description
+type HostDescrCounters struct {
+	Hostname    string
+	UUID        string
+	MachineType uint32
+	OSName      uint32
+	OSRelease   string
+}
+
+// HostAdapter represents a host network adapter
+type HostAdapter struct {
+	IfIndex      uint32
+	MACAddresses []string
+}
+
+// HostAdaptersCounters represents host network adapters
+type HostAdaptersCounters struct {
+	Adapters []HostAdapter
+}
+
+// HostParentCounters represents the container of a host
+type HostParentCounters struct {
+	ContainerType  uint32
+	ContainerIndex uint32
+}
+
+// HostCPUCounters represents physical server CPU
+type HostCPUCounters struct {
+	LoadOne      float32
+	LoadFive     float32
+	LoadFifteen  float32
+	ProcRun      uint32
+	ProcTotal    uint32
+	CPUNum       uint32
+	CPUSpeed     uint32 // MHz
+	Uptime       uint32 // seconds
+	CPUUser      uint32 // milliseconds
+	CPUNice      uint32
+	CPUSystem    uint32
+	CPUIdle      uint32
+	CPUWio       uint32
+	CPUIntr      uint32
+	CPUSintr     uint32
+	Interrupts   uint32
+	Contexts     uint32
+	CPUSteal     uint32
+	CPUGuest     uint32
+	CPUGuestNice uint32
+}
+
+// HostMemoryCounters represents physical server memory
+type HostMemoryCounters struct {
+	Total     uint64
+	Free      uint64
+	Shared    uint64
+	Buffers   uint64
+	Cached    uint64
+	SwapTotal uint64
+	SwapFree  uint64
+	PageIn    uint32
+	PageOut   uint32
+	SwapIn    uint32
+	SwapOut   uint32
+}
+
+// HostDiskIOCounters represents physical server disk I/O
+type HostDiskIOCounters struct {
+	Total        uint64
+	Free         uint64
+	PartMaxUsed  uint32 // percent * 100
+	Reads        uint32
+	BytesRead    uint64
+	ReadTime     uint32 // milliseconds
+	Writes       uint32
+	BytesWritten uint64
+	WriteTime    uint32 // milliseconds
+}
+
+// NetIOCounters represents physical server or virtual domain network I/O
+type NetIOCounters struct {
+	BytesIn  uint64
+	PktsIn   uint32
+	ErrsIn   uint32
+	DropsIn  uint32
+	BytesOut uint64
+	PktsOut  uint32
+	ErrsOut  uint32
+	DropsOut uint32
+}
+
+// VirtNodeCounters represents hypervisor node
+type VirtNodeCounters struct {
+	MHz        uint32
+	CPUs       uint32
+	Memory     uint64
+	MemoryFree uint64
+	NumDomains uint32
+}
+
+// VirtCPUCounters represents virtual domain CPU
+type VirtCPUCounters struct {
+	State     uint32
+	CPUTime   uint32 // milliseconds
+	NrVirtCPU uint32
+}
+
+// VirtMemoryCounters represents virtual domain memory
+type VirtMemoryCounters struct {
+	Memory    uint64
+	MaxMemory uint64
+}
+
+// VirtDiskIOCounters represents virtual domain disk I/O
+type VirtDiskIOCounters struct {
+	Capacity   uint64
+	Allocation uint64
+	Available  uint64
+	RdReq      uint32
+	RdBytes    uint64
+	WrReq      uint32
+	WrBytes    uint64
+	Errs       uint32
+}
+
+func decodeHostDescrCounters(r *reader.Reader) (*HostDescrCounters, error) {
+	var (
+		hd   = new(HostDescrCounters)
+		uuid []byte
+		err  error
+	)
+
+	if hd.Hostname, err = readString(r); err != nil {
+		return nil, err
+	}
+
+	if uuid, err = r.Read(16); err != nil {
+		return nil, err
+	}
+	hd.UUID = fmt.Sprintf("%x-%x-%x-%x-%x", uuid[:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:])
+
+	if err = read(r, &hd.MachineType); err != nil {
+		return nil, err
+	}
+
+	if err = read(r, &hd.OSName); err != nil {
+		return nil, err
+	}
+
+	if hd.OSRelease, err = readString(r); err != nil {
+		return nil, err
+	}
+
+	return hd, nil
+}
+
+func decodeHostAdaptersCounters(r *reader.Reader) (*HostAdaptersCounters, error) {
+	var (
+		ha       = new(HostAdaptersCounters)
+		adapters uint32
+		macs     uint32
+		err      error
+	)
+
+	if err = read(r, &adapters); err != nil {
+		return nil, err
+	}
+
+	if adapters > maxOpaqueLength/8 {
+		return nil, errDataLengthInvalid
+	}
+
+	ha.Adapters = make([]HostAdapter, adapters)
+	for i := range ha.Adapters {
+		if err = read(r, &ha.Adapters[i].IfIndex); err != nil {
+			return nil, err
+		}
+
+		if err = read(r, &macs); err != nil {
+			return nil, err
+		}
+
+		if macs > maxOpaqueLength/8 {
+			return nil, errDataLengthInvalid
+		}
+
+		ha.Adapters[i].MACAddresses = make([]string, macs)
+		for j := range ha.Adapters[i].MACAddresses {
+			if ha.Adapters[i].MACAddresses[j], err = readMAC(r); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return ha, nil
+}
+
+func decodeHostParentCounters(r *reader.Reader) (*HostParentCounters, error) {
+	var hp = new(HostParentCounters)
+
+	if err := hp.unmarshal(r); err != nil {
+		return nil, err
+	}
+
+	return hp, nil
+}
+
+func (hp *HostParentCounters) unmarshal(r *reader.Reader) error {
+	var err error
+
+	fields := []interface{}{
+		&hp.ContainerType,
+		&hp.ContainerIndex,
+	}
+
+	for _, field := range fields {
+		if err = read(r, field); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func decodeHostCPUCounters(r *reader.Reader, length uint32) (*HostCPUCounters, error) {
+	var (
+		hc  = new(HostCPUCounters)
+		err error
+	)
+
+	fields := []interface{}{
+		&hc.LoadOne,
+		&hc.LoadFive,
+		&hc.LoadFifteen,
+		&hc.ProcRun,
+		&hc.ProcTotal,
+		&hc.CPUNum,
+		&hc.CPUSpeed,
+		&hc.Uptime,
+		&hc.CPUUser,
+		&hc.CPUNice,
+		&hc.CPUSystem,
+		&hc.CPUIdle,
+		&hc.CPUWio,
+		&hc.CPUIntr,
+		&hc.CPUSintr,
+		&hc.Interrupts,
+		&hc.Contexts,
+	}
+
+	// older agents don't send steal, guest and guest nice
+	if length > hostCPUBaseLength {
+		fields = append(fields, &hc.CPUSteal, &hc.CPUGuest, &hc.CPUGuestNice)
+	}
+
+	for _, field := range fields {
+		if err = read(r, field); err != nil {
+			return nil, err
+		}
+	}
+
+	return hc, nil
+}
+
+func decodeHostMemoryCounters(r *reader.Reader) (*HostMemoryCounters, error) {
+	var hm = new(HostMemoryCounters)
+
+	if err := hm.unmarshal(r); err != nil {
+		return nil, err
+	}
+
+	return hm, nil
+}
+
+func (hm *HostMemoryCounters) unmarshal(r *reader.Reader) error {
+	var err error
+
+	fields := []interface{}{
+		&hm.Total,
+		&hm.Free,
+		&hm.Shared,
+		&hm.Buffers,
+		&hm.Cached,
+		&hm.SwapTotal,
+		&hm.SwapFree,
+		&hm.PageIn,
+		&hm.PageOut,
+		&hm.SwapIn,
+		&hm.SwapOut,
+	}
+
+	for _, field := range fields {
+		if err = read(r, field); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func decodeHostDiskIOCounters(r *reader.Reader) (*HostDiskIOCounters, error) {
+	var hd = new(HostDiskIOCounters)
+
+	if err := hd.unmarshal(r); err != nil {
+		return nil, err
+	}
+
+	return hd, nil
+}
+
+func (hd *HostDiskIOCounters) unmarshal(r *reader.Reader) error {
+	var err error
+
+	fields := []interface{}{
+		&hd.Total,
+		&hd.Free,
+		&hd.PartMaxUsed,
+		&hd.Reads,
+		&hd.BytesRead,
+		&hd.ReadTime,
+		&hd.Writes,
+		&hd.BytesWritten,
+		&hd.WriteTime,
+	}
+
+	for _, field := range fields {
+		if err = read(r, field); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func decodeNetIOCounters(r *reader.Reader) (*NetIOCounters, error) {
+	var n = new(NetIOCounters)
+
+	if err := n.unmarshal(r); err != nil {
+		return nil, err
+	}
+
+	return n, nil
+}
+
+func (n *NetIOCounters) unmarshal(r *reader.Reader) error {
+	var err error
+
+	fields := []interface{}{
+		&n.BytesIn,
+		&n.PktsIn,
+		&n.ErrsIn,
+		&n.DropsIn,
+		&n.BytesOut,
+		&n.PktsOut,
+		&n.ErrsOut,
+		&n.DropsOut,
+	}
+
+	for _, field := range fields {
+		if err = read(r, field); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func decodeVirtNodeCounters(r *reader.Reader) (*VirtNodeCounters, error) {
+	var vn = new(VirtNodeCounters)
+
+	if err := vn.unmarshal(r); err != nil {
+		return nil, err
+	}
+
+	return vn, nil
+}
+
+func (vn *VirtNodeCounters) unmarshal(r *reader.Reader) error {
+	var err error
+
+	fields := []interface{}{
+		&vn.MHz,
+		&vn.CPUs,
+		&vn.Memory,
+		&vn.MemoryFree,
+		&vn.NumDomains,
+	}
+
+	for _, field := range fields {
+		if err = read(r, field); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func decodeVirtCPUCounters(r *reader.Reader) (*VirtCPUCounters, error) {
+	var vc = new(VirtCPUCounters)
+
+	if err := vc.unmarshal(r); err != nil {
+		return nil, err
+	}
+
+	return vc, nil
+}
+
+func (vc *VirtCPUCounters) unmarshal(r *reader.Reader) error {
+	var err error
+
+	fields := []interface{}{
+		&vc.State,
+		&vc.CPUTime,
+		&vc.NrVirtCPU,
+	}
+
+	for _, field := range fields {
+		if err = read(r, field); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func decodeVirtMemoryCounters(r *reader.Reader) (*VirtMemoryCounters, error) {
+	var vm = new(VirtMemoryCounters)
+
+	if err := vm.unmarshal(r); err != nil {
+		return nil, err
+	}
+
+	return vm, nil
+}
+
+func (vm *VirtMemoryCounters) unmarshal(r *reader.Reader) error {
+	var err error
+
+	fields := []interface{}{
+		&vm.Memory,
+		&vm.MaxMemory,
+	}
+
+	for _, field := range fields {
+		if err = read(r, field); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func decodeVirtDiskIOCounters(r *reader.Reader) (*VirtDiskIOCounters, error) {
+	var vd = new(VirtDiskIOCounters)
+
+	if err := vd.unmarshal(r); err != nil {
+		return nil, err
+	}
+
+	return vd, nil
+}
+
+func (vd *VirtDiskIOCounters) unmarshal(r *reader.Reader) error {
+	var err error
+
+	fields := []interface{}{
+		&vd.Capacity,
+		&vd.Allocation,
+		&vd.Available,
+		&vd.RdReq,
+		&vd.RdBytes,
+		&vd.WrReq,
+		&vd.WrBytes,
+		&vd.Errs,
+	}
+
+	for _, field := range fields {
+		if err = read(r, field); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
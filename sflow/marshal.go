@@ -0,0 +1,723 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    marshal.go
+//: details: encoding of each decoded sFlow datagram
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package sflow
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/netip"
+	"strconv"
+
+	"github.com/EdgeCast/vflow/packet"
+)
+
+// JSONMarshal encodes sFlow datagram, the output is the same as
+// encoding/json output but the common samples and records are
+// encoded without reflection.
+func (d *SFDatagram) JSONMarshal(b *bytes.Buffer) ([]byte, error) {
+	b.WriteString("{\"Version\":")
+	writeUint(b, uint64(d.Version))
+	b.WriteString(",\"IPVersion\":")
+	writeUint(b, uint64(d.IPVersion))
+	b.WriteString(",\"AgentSubID\":")
+	writeUint(b, uint64(d.AgentSubID))
+	b.WriteString(",\"SequenceNo\":")
+	writeUint(b, uint64(d.SequenceNo))
+	b.WriteString(",\"SysUpTime\":")
+	writeUint(b, uint64(d.SysUpTime))
+	b.WriteString(",\"SamplesNo\":")
+	writeUint(b, uint64(d.SamplesNo))
+
+	if err := d.encodeSamples(b); err != nil {
+		return nil, err
+	}
+
+	if err := d.encodeCounters(b); err != nil {
+		return nil, err
+	}
+
+	if err := d.encodeDiscards(b); err != nil {
+		return nil, err
+	}
+
+	b.WriteString(",\"IPAddress\":")
+	writeIP(b, d.IPAddress)
+	b.WriteString(",\"ColTime\":")
+	b.Write(strconv.AppendInt(b.AvailableBuffer(), d.ColTime, 10))
+	b.WriteByte('}')
+
+	return b.Bytes(), nil
+}
+
+func (d *SFDatagram) encodeSamples(b *bytes.Buffer) error {
+	b.WriteString(",\"Samples\":")
+	if d.Samples == nil {
+		b.WriteString("null")
+		return nil
+	}
+
+	b.WriteByte('[')
+	for i, s := range d.Samples {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+
+		fs, ok := s.(*FlowSample)
+		if !ok || fs == nil {
+			if err := writeValue(b, s); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := fs.encode(b); err != nil {
+			return err
+		}
+	}
+	b.WriteByte(']')
+
+	return nil
+}
+
+func (d *SFDatagram) encodeCounters(b *bytes.Buffer) error {
+	b.WriteString(",\"Counters\":")
+	if d.Counters == nil {
+		b.WriteString("null")
+		return nil
+	}
+
+	b.WriteByte('[')
+	for i, c := range d.Counters {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+
+		cs, ok := c.(*CounterSample)
+		if !ok || cs == nil {
+			if err := writeValue(b, c); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := cs.encode(b); err != nil {
+			return err
+		}
+	}
+	b.WriteByte(']')
+
+	return nil
+}
+
+func (d *SFDatagram) encodeDiscards(b *bytes.Buffer) error {
+	b.WriteString(",\"Discards\":")
+	if d.Discards == nil {
+		b.WriteString("null")
+		return nil
+	}
+
+	b.WriteByte('[')
+	for i, ds := range d.Discards {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+
+		if ds == nil {
+			b.WriteString("null")
+			continue
+		}
+
+		if err := ds.encode(b); err != nil {
+			return err
+		}
+	}
+	b.WriteByte(']')
+
+	return nil
+}
+
+func (fs *FlowSample) encode(b *bytes.Buffer) error {
+	b.WriteString("{\"SequenceNo\":")
+	writeUint(b, uint64(fs.SequenceNo))
+	b.WriteString(",\"SourceID\":")
+	writeUint(b, uint64(fs.SourceID))
+	b.WriteString(",\"SourceIDIdx\":")
+	writeUint(b, uint64(fs.SourceIDIdx))
+	b.WriteString(",\"SamplingRate\":")
+	writeUint(b, uint64(fs.SamplingRate))
+	b.WriteString(",\"SamplePool\":")
+	writeUint(b, uint64(fs.SamplePool))
+	b.WriteString(",\"Drops\":")
+	writeUint(b, uint64(fs.Drops))
+	b.WriteString(",\"InputFormat\":")
+	writeUint(b, uint64(fs.InputFormat))
+	b.WriteString(",\"Input\":")
+	writeUint(b, uint64(fs.Input))
+	b.WriteString(",\"OutputFormat\":")
+	writeUint(b, uint64(fs.OutputFormat))
+	b.WriteString(",\"Output\":")
+	writeUint(b, uint64(fs.Output))
+	b.WriteString(",\"RecordsNo\":")
+	writeUint(b, uint64(fs.RecordsNo))
+
+	if err := encodeRecords(b, fs.Records); err != nil {
+		return err
+	}
+
+	b.WriteByte('}')
+
+	return nil
+}
+
+func (cs *CounterSample) encode(b *bytes.Buffer) error {
+	b.WriteString("{\"SequenceNo\":")
+	writeUint(b, uint64(cs.SequenceNo))
+	b.WriteString(",\"SourceIDType\":")
+	writeUint(b, uint64(cs.SourceIDType))
+	b.WriteString(",\"SourceIDIdx\":")
+	writeUint(b, uint64(cs.SourceIDIdx))
+	b.WriteString(",\"RecordsNo\":")
+	writeUint(b, uint64(cs.RecordsNo))
+
+	if err := encodeRecords(b, cs.Records); err != nil {
+		return err
+	}
+
+	b.WriteByte('}')
+
+	return nil
+}
+
+func (ds *DiscardSample) encode(b *bytes.Buffer) error {
+	b.WriteString("{\"SequenceNo\":")
+	writeUint(b, uint64(ds.SequenceNo))
+	b.WriteString(",\"SourceIDType\":")
+	writeUint(b, uint64(ds.SourceIDType))
+	b.WriteString(",\"SourceIDIdx\":")
+	writeUint(b, uint64(ds.SourceIDIdx))
+	b.WriteString(",\"Drops\":")
+	writeUint(b, uint64(ds.Drops))
+	b.WriteString(",\"Input\":")
+	writeUint(b, uint64(ds.Input))
+	b.WriteString(",\"Output\":")
+	writeUint(b, uint64(ds.Output))
+	b.WriteString(",\"Reason\":")
+	writeUint(b, uint64(ds.Reason))
+	b.WriteString(",\"ReasonName\":")
+	if err := writeString(b, ds.ReasonName); err != nil {
+		return err
+	}
+	b.WriteString(",\"RecordsNo\":")
+	writeUint(b, uint64(ds.RecordsNo))
+
+	if err := encodeRecords(b, ds.Records); err != nil {
+		return err
+	}
+
+	b.WriteByte('}')
+
+	return nil
+}
+
+func encodeRecords(b *bytes.Buffer, records []Record) error {
+	b.WriteString(",\"Records\":")
+	if records == nil {
+		b.WriteString("null")
+		return nil
+	}
+
+	b.WriteByte('[')
+	for i := range records {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+
+		b.WriteString("{\"Enterprise\":")
+		writeUint(b, uint64(records[i].Enterprise))
+		b.WriteString(",\"Format\":")
+		writeUint(b, uint64(records[i].Format))
+		b.WriteString(",\"Name\":")
+		if err := writeString(b, records[i].Name); err != nil {
+			return err
+		}
+		b.WriteString(",\"Data\":")
+		if err := encodeRecordData(b, records[i].Data); err != nil {
+			return err
+		}
+		b.WriteByte('}')
+	}
+	b.WriteByte(']')
+
+	return nil
+}
+
+// encodeRecordData encodes the frequent records, the rest
+// of them are encoded by encoding/json
+func encodeRecordData(b *bytes.Buffer, data interface{}) error {
+	switch d := data.(type) {
+	case *packet.Packet:
+		if d != nil {
+			return encodePacket(b, d)
+		}
+	case *ExtSwitchData:
+		if d != nil {
+			b.WriteString("{\"SrcVlan\":")
+			writeUint(b, uint64(d.SrcVlan))
+			b.WriteString(",\"SrcPriority\":")
+			writeUint(b, uint64(d.SrcPriority))
+			b.WriteString(",\"DstVlan\":")
+			writeUint(b, uint64(d.DstVlan))
+			b.WriteString(",\"DstPriority\":")
+			writeUint(b, uint64(d.DstPriority))
+			b.WriteByte('}')
+			return nil
+		}
+	case *ExtRouterData:
+		if d != nil {
+			b.WriteString("{\"NextHop\":")
+			writeIP(b, d.NextHop)
+			b.WriteString(",\"SrcMask\":")
+			writeUint(b, uint64(d.SrcMask))
+			b.WriteString(",\"DstMask\":")
+			writeUint(b, uint64(d.DstMask))
+			b.WriteByte('}')
+			return nil
+		}
+	case *GenericInterfaceCounters:
+		if d != nil {
+			d.encode(b)
+			return nil
+		}
+	case *EthernetInterfaceCounters:
+		if d != nil {
+			d.encode(b)
+			return nil
+		}
+	}
+
+	return writeValue(b, data)
+}
+
+func encodePacket(b *bytes.Buffer, p *packet.Packet) error {
+	b.WriteString("{\"L2\":{\"SrcMAC\":")
+	writeMAC(b, p.L2.SrcMAC)
+	b.WriteString(",\"DstMAC\":")
+	writeMAC(b, p.L2.DstMAC)
+	b.WriteString(",\"Vlan\":")
+	writeInt(b, p.L2.Vlan)
+	b.WriteString(",\"EtherType\":")
+	writeUint(b, uint64(p.L2.EtherType))
+
+	if len(p.L2.Tags) > 0 {
+		b.WriteString(",\"Tags\":[")
+		for i, tag := range p.L2.Tags {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString("{\"TPID\":")
+			writeUint(b, uint64(tag.TPID))
+			b.WriteString(",\"PCP\":")
+			writeInt(b, tag.PCP)
+			b.WriteString(",\"DEI\":")
+			writeInt(b, tag.DEI)
+			b.WriteString(",\"ID\":")
+			writeInt(b, tag.ID)
+			b.WriteByte('}')
+		}
+		b.WriteByte(']')
+	}
+	b.WriteByte('}')
+
+	if len(p.MPLS) > 0 {
+		b.WriteString(",\"MPLS\":[")
+		for i, l := range p.MPLS {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString("{\"Label\":")
+			writeInt(b, l.Label)
+			b.WriteString(",\"TC\":")
+			writeInt(b, l.TC)
+			b.WriteString(",\"TTL\":")
+			writeInt(b, l.TTL)
+			b.WriteByte('}')
+		}
+		b.WriteByte(']')
+	}
+
+	b.WriteString(",\"L3\":")
+	switch h := p.L3.(type) {
+	case *packet.IPv4Header:
+		b.WriteString("{\"Version\":")
+		writeInt(b, h.Version)
+		b.WriteString(",\"TOS\":")
+		writeInt(b, h.TOS)
+		b.WriteString(",\"TotalLen\":")
+		writeInt(b, h.TotalLen)
+		b.WriteString(",\"ID\":")
+		writeInt(b, h.ID)
+		b.WriteString(",\"Flags\":")
+		writeInt(b, h.Flags)
+		b.WriteString(",\"FragOff\":")
+		writeInt(b, h.FragOff)
+		b.WriteString(",\"TTL\":")
+		writeInt(b, h.TTL)
+		b.WriteString(",\"Protocol\":")
+		writeInt(b, h.Protocol)
+		b.WriteString(",\"Checksum\":")
+		writeInt(b, h.Checksum)
+		b.WriteString(",\"Src\":")
+		writeAddr(b, h.Src)
+		b.WriteString(",\"Dst\":")
+		writeAddr(b, h.Dst)
+		b.WriteByte('}')
+	case *packet.IPv6Header:
+		b.WriteString("{\"Version\":")
+		writeInt(b, h.Version)
+		b.WriteString(",\"TrafficClass\":")
+		writeInt(b, h.TrafficClass)
+		b.WriteString(",\"FlowLabel\":")
+		writeInt(b, h.FlowLabel)
+		b.WriteString(",\"PayloadLen\":")
+		writeInt(b, h.PayloadLen)
+		b.WriteString(",\"NextHeader\":")
+		writeInt(b, h.NextHeader)
+		b.WriteString(",\"HopLimit\":")
+		writeInt(b, h.HopLimit)
+		b.WriteString(",\"Src\":")
+		writeAddr(b, h.Src)
+		b.WriteString(",\"Dst\":")
+		writeAddr(b, h.Dst)
+		if len(h.ExtHeaders) > 0 {
+			b.WriteString(",\"ExtHeaders\":[")
+			for i, e := range h.ExtHeaders {
+				if i > 0 {
+					b.WriteByte(',')
+				}
+				writeInt(b, e)
+			}
+			b.WriteByte(']')
+		}
+		b.WriteString(",\"Protocol\":")
+		writeInt(b, h.Protocol)
+		if h.Fragment != nil {
+			b.WriteString(",\"Fragment\":{\"Offset\":")
+			writeInt(b, h.Fragment.Offset)
+			b.WriteString(",\"More\":")
+			writeInt(b, h.Fragment.More)
+			b.WriteString(",\"ID\":")
+			writeInt(b, h.Fragment.ID)
+			b.WriteByte('}')
+		}
+		b.WriteByte('}')
+	default:
+		if err := writeValue(b, p.L3); err != nil {
+			return err
+		}
+	}
+
+	b.WriteString(",\"L4\":")
+	switch h := p.L4.(type) {
+	case *packet.TCPHeader:
+		b.WriteString("{\"SrcPort\":")
+		writeInt(b, h.SrcPort)
+		b.WriteString(",\"DstPort\":")
+		writeInt(b, h.DstPort)
+		b.WriteString(",\"DataOffset\":")
+		writeInt(b, h.DataOffset)
+		b.WriteString(",\"Reserved\":")
+		writeInt(b, h.Reserved)
+		b.WriteString(",\"Flags\":")
+		writeInt(b, h.Flags)
+		b.WriteString(",\"Seq\":")
+		writeInt(b, h.Seq)
+		b.WriteString(",\"Ack\":")
+		writeInt(b, h.Ack)
+		b.WriteString(",\"Window\":")
+		writeInt(b, h.Window)
+		if h.Options != nil {
+			b.WriteString(",\"Options\":")
+			if err := writeValue(b, h.Options); err != nil {
+				return err
+			}
+		}
+		b.WriteByte('}')
+	case *packet.UDPHeader:
+		b.WriteString("{\"SrcPort\":")
+		writeInt(b, h.SrcPort)
+		b.WriteString(",\"DstPort\":")
+		writeInt(b, h.DstPort)
+		b.WriteByte('}')
+	default:
+		if err := writeValue(b, p.L4); err != nil {
+			return err
+		}
+	}
+
+	if p.L7 != nil {
+		b.WriteString(",\"L7\":")
+		if err := encodeApplication(b, p.L7); err != nil {
+			return err
+		}
+	}
+
+	if p.Tunnel != nil {
+		if err := encodeTunnel(b, p.Tunnel); err != nil {
+			return err
+		}
+	}
+
+	if p.Inner != nil {
+		b.WriteString(",\"Inner\":")
+		if err := encodePacket(b, p.Inner); err != nil {
+			return err
+		}
+	}
+
+	b.WriteByte('}')
+
+	return nil
+}
+
+func encodeApplication(b *bytes.Buffer, l7 interface{}) error {
+	switch h := l7.(type) {
+	case *packet.DNS:
+		b.WriteString("{\"ID\":")
+		writeInt(b, h.ID)
+		if h.Response {
+			b.WriteString(",\"Response\":true")
+		} else {
+			b.WriteString(",\"Response\":false")
+		}
+		b.WriteString(",\"Opcode\":")
+		writeInt(b, h.Opcode)
+		b.WriteString(",\"RCode\":")
+		writeInt(b, h.RCode)
+		b.WriteString(",\"QName\":")
+		if err := writeString(b, h.QName); err != nil {
+			return err
+		}
+		b.WriteString(",\"QType\":")
+		writeInt(b, h.QType)
+		b.WriteByte('}')
+	case *packet.TLS:
+		b.WriteString("{\"Version\":")
+		writeInt(b, h.Version)
+		if h.SNI != "" {
+			b.WriteString(",\"SNI\":")
+			if err := writeString(b, h.SNI); err != nil {
+				return err
+			}
+		}
+		if len(h.ALPN) > 0 {
+			b.WriteString(",\"ALPN\":[")
+			for i, v := range h.ALPN {
+				if i > 0 {
+					b.WriteByte(',')
+				}
+				if err := writeString(b, v); err != nil {
+					return err
+				}
+			}
+			b.WriteByte(']')
+		}
+		b.WriteByte('}')
+	case *packet.HTTP:
+		b.WriteString("{\"Method\":")
+		if err := writeString(b, h.Method); err != nil {
+			return err
+		}
+		if h.Host != "" {
+			b.WriteString(",\"Host\":")
+			if err := writeString(b, h.Host); err != nil {
+				return err
+			}
+		}
+		b.WriteString(",\"Path\":")
+		if err := writeString(b, h.Path); err != nil {
+			return err
+		}
+		b.WriteByte('}')
+	default:
+		return writeValue(b, l7)
+	}
+
+	return nil
+}
+
+func encodeTunnel(b *bytes.Buffer, t *packet.Tunnel) error {
+	b.WriteString(",\"Tunnel\":{\"Type\":")
+	if err := writeString(b, t.Type); err != nil {
+		return err
+	}
+
+	fields := []struct {
+		name  string
+		value int
+	}{
+		{",\"VNI\":", t.VNI},
+		{",\"Key\":", t.Key},
+		{",\"Protocol\":", t.Protocol},
+		{",\"SessionID\":", t.SessionID},
+	}
+
+	for _, f := range fields {
+		if f.value != 0 {
+			b.WriteString(f.name)
+			writeInt(b, f.value)
+		}
+	}
+
+	b.WriteByte('}')
+
+	return nil
+}
+
+func (gic *GenericInterfaceCounters) encode(b *bytes.Buffer) {
+	b.WriteString("{\"Index\":")
+	writeUint(b, uint64(gic.Index))
+	b.WriteString(",\"Type\":")
+	writeUint(b, uint64(gic.Type))
+	b.WriteString(",\"Speed\":")
+	writeUint(b, gic.Speed)
+	b.WriteString(",\"Direction\":")
+	writeUint(b, uint64(gic.Direction))
+	b.WriteString(",\"Status\":")
+	writeUint(b, uint64(gic.Status))
+	b.WriteString(",\"InOctets\":")
+	writeUint(b, gic.InOctets)
+	b.WriteString(",\"InUnicastPackets\":")
+	writeUint(b, uint64(gic.InUnicastPackets))
+	b.WriteString(",\"InMulticastPackets\":")
+	writeUint(b, uint64(gic.InMulticastPackets))
+	b.WriteString(",\"InBroadcastPackets\":")
+	writeUint(b, uint64(gic.InBroadcastPackets))
+	b.WriteString(",\"InDiscards\":")
+	writeUint(b, uint64(gic.InDiscards))
+	b.WriteString(",\"InErrors\":")
+	writeUint(b, uint64(gic.InErrors))
+	b.WriteString(",\"InUnknownProtocols\":")
+	writeUint(b, uint64(gic.InUnknownProtocols))
+	b.WriteString(",\"OutOctets\":")
+	writeUint(b, gic.OutOctets)
+	b.WriteString(",\"OutUnicastPackets\":")
+	writeUint(b, uint64(gic.OutUnicastPackets))
+	b.WriteString(",\"OutMulticastPackets\":")
+	writeUint(b, uint64(gic.OutMulticastPackets))
+	b.WriteString(",\"OutBroadcastPackets\":")
+	writeUint(b, uint64(gic.OutBroadcastPackets))
+	b.WriteString(",\"OutDiscards\":")
+	writeUint(b, uint64(gic.OutDiscards))
+	b.WriteString(",\"OutErrors\":")
+	writeUint(b, uint64(gic.OutErrors))
+	b.WriteString(",\"PromiscuousMode\":")
+	writeUint(b, uint64(gic.PromiscuousMode))
+	b.WriteByte('}')
+}
+
+func (eic *EthernetInterfaceCounters) encode(b *bytes.Buffer) {
+	b.WriteString("{\"AlignmentErrors\":")
+	writeUint(b, uint64(eic.AlignmentErrors))
+	b.WriteString(",\"FCSErrors\":")
+	writeUint(b, uint64(eic.FCSErrors))
+	b.WriteString(",\"SingleCollisionFrames\":")
+	writeUint(b, uint64(eic.SingleCollisionFrames))
+	b.WriteString(",\"MultipleCollisionFrames\":")
+	writeUint(b, uint64(eic.MultipleCollisionFrames))
+	b.WriteString(",\"SQETestErrors\":")
+	writeUint(b, uint64(eic.SQETestErrors))
+	b.WriteString(",\"DeferredTransmissions\":")
+	writeUint(b, uint64(eic.DeferredTransmissions))
+	b.WriteString(",\"LateCollisions\":")
+	writeUint(b, uint64(eic.LateCollisions))
+	b.WriteString(",\"ExcessiveCollisions\":")
+	writeUint(b, uint64(eic.ExcessiveCollisions))
+	b.WriteString(",\"InternalMACTransmitErrors\":")
+	writeUint(b, uint64(eic.InternalMACTransmitErrors))
+	b.WriteString(",\"CarrierSenseErrors\":")
+	writeUint(b, uint64(eic.CarrierSenseErrors))
+	b.WriteString(",\"FrameTooLongs\":")
+	writeUint(b, uint64(eic.FrameTooLongs))
+	b.WriteString(",\"InternalMACReceiveErrors\":")
+	writeUint(b, uint64(eic.InternalMACReceiveErrors))
+	b.WriteString(",\"SymbolErrors\":")
+	writeUint(b, uint64(eic.SymbolErrors))
+	b.WriteByte('}')
+}
+
+func writeUint(b *bytes.Buffer, v uint64) {
+	b.Write(strconv.AppendUint(b.AvailableBuffer(), v, 10))
+}
+
+func writeInt(b *bytes.Buffer, v int) {
+	b.Write(strconv.AppendInt(b.AvailableBuffer(), int64(v), 10))
+}
+
+// writeIP writes the IP address same as net.IP MarshalText
+func writeIP(b *bytes.Buffer, ip net.IP) {
+	addr, _ := netip.AddrFromSlice(ip)
+	writeAddr(b, addr.Unmap())
+}
+
+// writeAddr writes the address without allocation, the
+// invalid address is written as empty string
+func writeAddr(b *bytes.Buffer, addr netip.Addr) {
+	b.WriteByte('"')
+	if addr.IsValid() {
+		b.Write(addr.AppendTo(b.AvailableBuffer()))
+	}
+	b.WriteByte('"')
+}
+
+func writeMAC(b *bytes.Buffer, m packet.MAC) {
+	b.WriteByte('"')
+	b.Write(m.AppendTo(b.AvailableBuffer()))
+	b.WriteByte('"')
+}
+
+// writeString writes the string as is if it doesn't need
+// any JSON escaping otherwise encoding/json encodes it
+func writeString(b *bytes.Buffer, s string) error {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c > 0x7e || c == '"' || c == '\\' ||
+			c == '<' || c == '>' || c == '&' {
+			return writeValue(b, s)
+		}
+	}
+
+	b.WriteByte('"')
+	b.WriteString(s)
+	b.WriteByte('"')
+
+	return nil
+}
+
+func writeValue(b *bytes.Buffer, v interface{}) error {
+	d, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	b.Write(d)
+
+	return nil
+}
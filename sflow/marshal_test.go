@@ -0,0 +1,148 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    marshal_test.go
+//: details: TODO
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package sflow
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/EdgeCast/vflow/packet"
+)
+
+func mockDatagram() []byte {
+	url := xdr(uint32(1), uint32(19), []byte("/search?q=<a>&b=\"c\"\x00"), uint32(0))
+	mpls := []byte{
+		0x00, 0x01, 0x41, 0x40, 0x45, 0x00, 0x00, 0x4b,
+		0x08, 0xf8, 0x00, 0x00, 0x3e, 0x11, 0x82, 0x91,
+		0xc0, 0xe5, 0xd8, 0x8f, 0xc0, 0xe5, 0x96, 0xbe,
+		0x64, 0x9b, 0x00, 0x35, 0x00, 0x37, 0x00, 0x00,
+	}
+	http := append([]byte{
+		0x45, 0x00, 0x00, 0x54, 0x08, 0xf8, 0x40, 0x00,
+		0x3e, 0x06, 0x82, 0x91, 0xc0, 0xe5, 0xd8, 0x8f,
+		0xc0, 0xe5, 0x96, 0xbe, 0xa5, 0x8e, 0x00, 0x50,
+		0x54, 0x01, 0x4f, 0x1c, 0x52, 0x7f, 0x00, 0xf9,
+		0x50, 0x18, 0x01, 0x2a, 0xbb, 0xde, 0x00, 0x00,
+	}, "GET /a\"b HTTP/1.1\r\nHost: <example>\r\n\r\n"...)
+	gre := []byte{
+		0x60, 0x00, 0x00, 0x00, 0x00, 0x24, 0x2f, 0x40,
+		0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01,
+		0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02,
+		0x20, 0x00, 0x08, 0x00, 0x00, 0x00, 0x00, 0x2a,
+		0x45, 0x00, 0x00, 0x4b, 0x08, 0xf8, 0x00, 0x00,
+		0x3e, 0x11, 0x82, 0x91, 0xc0, 0xe5, 0xd8, 0x8f,
+		0xc0, 0xe5, 0x96, 0xbe, 0x64, 0x9b, 0x00, 0x35,
+		0x00, 0x37, 0x00, 0x00,
+	}
+	ipv6 := []byte{
+		0x60, 0x00, 0x00, 0x00, 0x00, 0x18, 0x2c, 0x40,
+		0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01,
+		0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02,
+		0x11, 0x00, 0x00, 0x01, 0x12, 0x34, 0x56, 0x78,
+		0x64, 0x9b, 0x00, 0x35, 0x00, 0x10, 0x00, 0x00,
+	}
+	return sfDatagram(
+		sfFlowSample(
+			sfData(0, SFDataExtSwitch, xdr(uint32(10), uint32(1), uint32(20), uint32(2))),
+			sfData(0, SFDataExtRouter, xdr(uint32(2), make([]byte, 15), byte(1), uint32(24), uint32(16))),
+			sfData(0, SFDataExtURL, url),
+			sfData(0, SFDataRawHeader, xdr(uint32(13), uint32(79), uint32(0), uint32(len(mpls)), mpls)),
+			sfData(0, SFDataRawHeader, xdr(uint32(12), uint32(96), uint32(0), uint32(len(ipv6)), ipv6)),
+			sfData(0, SFDataRawHeader, xdr(uint32(12), uint32(96), uint32(0), uint32(len(gre)), gre)),
+			sfData(0, SFDataRawHeader, xdr(uint32(11), uint32(84), uint32(0), uint32(len(http)), http)),
+		),
+		sfCounterSample(
+			sfData(0, SFGenericInterfaceCounters, make([]byte, 88)),
+			sfData(0, SFEthernetInterfaceCounters, make([]byte, 52)),
+			sfData(0, SFHostCPUCounters, xdr(float32(1.5), make([]byte, 64))),
+		),
+		sfData(0, DataDiscardSample, xdr(uint32(1), uint32(0), uint32(1), uint32(0),
+			uint32(1), uint32(0), uint32(258), uint32(0))),
+	)
+}
+
+func TestJSONMarshal(t *testing.T) {
+	SetPacketOptions(packet.Options{Decap: true, L7: true})
+	defer SetPacketOptions(packet.Options{})
+
+	for _, raw := range [][]byte{TestsFlowRawPacket, mockDatagram()} {
+		d := NewSFDecoder(raw, nil)
+		datagram, err := d.SFDecode()
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+
+		expected, err := json.Marshal(datagram)
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+
+		b, err := datagram.JSONMarshal(new(bytes.Buffer))
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+
+		if !bytes.Equal(b, expected) {
+			t.Errorf("expected\n%s\ngot\n%s", expected, b)
+		}
+	}
+}
+
+func TestJSONMarshalNilSlices(t *testing.T) {
+	datagram := &SFDatagram{Version: 5, Samples: []Sample{&FlowSample{}}}
+
+	expected, _ := json.Marshal(datagram)
+	b, err := datagram.JSONMarshal(new(bytes.Buffer))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if !bytes.Equal(b, expected) {
+		t.Errorf("expected\n%s\ngot\n%s", expected, b)
+	}
+}
+
+func BenchmarkJSONMarshal(b *testing.B) {
+	buf := new(bytes.Buffer)
+	d := NewSFDecoder(TestsFlowRawPacket, nil)
+	datagram, _ := d.SFDecode()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		datagram.JSONMarshal(buf)
+	}
+}
+
+func BenchmarkEncodingJSONMarshal(b *testing.B) {
+	d := NewSFDecoder(TestsFlowRawPacket, nil)
+	datagram, _ := d.SFDecode()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		json.Marshal(datagram)
+	}
+}
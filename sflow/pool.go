@@ -0,0 +1,167 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    pool.go
+//: details: sflow datagram and samples pools
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package sflow
+
+import (
+	"sync"
+
+	"github.com/EdgeCast/vflow/packet"
+)
+
+var (
+	datagramPool = sync.Pool{
+		New: func() interface{} {
+			return &SFDatagram{
+				Samples:  make([]Sample, 0, 8),
+				Counters: make([]Counter, 0, 8),
+				Discards: make([]*DiscardSample, 0),
+			}
+		},
+	}
+
+	flowSamplePool = sync.Pool{
+		New: func() interface{} {
+			return &FlowSample{Records: make([]Record, 0, 4)}
+		},
+	}
+
+	counterSamplePool = sync.Pool{
+		New: func() interface{} {
+			return &CounterSample{Records: make([]Record, 0, 4)}
+		},
+	}
+
+	discardSamplePool = sync.Pool{
+		New: func() interface{} {
+			return &DiscardSample{Records: make([]Record, 0, 2)}
+		},
+	}
+
+	// the sampled header packets keep their layers
+	// storage so they're decoded without allocation
+	packetPool = sync.Pool{
+		New: func() interface{} {
+			return new(packet.Packet)
+		},
+	}
+)
+
+func newDatagram() *SFDatagram {
+	d := datagramPool.Get().(*SFDatagram)
+	*d = SFDatagram{
+		Samples:  d.Samples[:0],
+		Counters: d.Counters[:0],
+		Discards: d.Discards[:0],
+	}
+
+	return d
+}
+
+// Release returns the datagram and its flow, counter and discard samples
+// to the pools, the datagram shouldn't be used after the release.
+func (d *SFDatagram) Release() {
+	if d == nil {
+		return
+	}
+
+	for i, s := range d.Samples {
+		if fs, ok := s.(*FlowSample); ok {
+			fs.release()
+		}
+		d.Samples[i] = nil
+	}
+
+	for i, c := range d.Counters {
+		if cs, ok := c.(*CounterSample); ok {
+			cs.release()
+		}
+		d.Counters[i] = nil
+	}
+
+	d.ReleaseDiscards()
+
+	datagramPool.Put(d)
+}
+
+// ReleaseDiscards returns the datagram discard samples to the pool,
+// the datagram keeps its discards slice for the reuse.
+func (d *SFDatagram) ReleaseDiscards() {
+	for i, ds := range d.Discards {
+		ds.release()
+		d.Discards[i] = nil
+	}
+
+	d.Discards = d.Discards[:0]
+}
+
+func newFlowSample() *FlowSample {
+	fs := flowSamplePool.Get().(*FlowSample)
+	*fs = FlowSample{Records: fs.Records[:0]}
+
+	return fs
+}
+
+func (fs *FlowSample) release() {
+	clearRecords(fs.Records)
+	flowSamplePool.Put(fs)
+}
+
+func newCounterSample() *CounterSample {
+	cs := counterSamplePool.Get().(*CounterSample)
+	*cs = CounterSample{Records: cs.Records[:0]}
+
+	return cs
+}
+
+func (cs *CounterSample) release() {
+	clearRecords(cs.Records)
+	counterSamplePool.Put(cs)
+}
+
+func newDiscardSample() *DiscardSample {
+	ds := discardSamplePool.Get().(*DiscardSample)
+	*ds = DiscardSample{Records: ds.Records[:0]}
+
+	return ds
+}
+
+func (ds *DiscardSample) release() {
+	clearRecords(ds.Records)
+	discardSamplePool.Put(ds)
+}
+
+func newPacket() *packet.Packet {
+	p := packetPool.Get().(*packet.Packet)
+	p.SetOptions(packetOptions)
+
+	return p
+}
+
+// clearRecords drops the references to the decoded
+// records and returns the packets to the pool
+func clearRecords(records []Record) {
+	for i := range records {
+		if p, ok := records[i].Data.(*packet.Packet); ok {
+			packetPool.Put(p)
+		}
+		records[i] = Record{}
+	}
+}
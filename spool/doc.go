@@ -0,0 +1,2 @@
+// Package spool buffers the messages on disk in order while the message queue is unavailable
+package spool
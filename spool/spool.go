@@ -0,0 +1,549 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    spool.go
+//: details: bounded on-disk message queue
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package spool
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// PolicyDropOldest evicts the oldest segment when the spool is full
+	PolicyDropOldest = "drop-oldest"
+
+	// PolicyDropNewest drops the new messages when the spool is full
+	PolicyDropNewest = "drop-newest"
+
+	// RecordHLen is the record header length: message length and crc32
+	RecordHLen = 8
+
+	segmentExt   = ".seg"
+	cursorFile   = "cursor"
+	maxRecordLen = 64 << 20
+)
+
+var (
+	// ErrFull is returned by Put if the message can't fit in the spool
+	ErrFull = errors.New("spool is full")
+
+	// ErrEmpty is returned by Get if there isn't any message
+	ErrEmpty = errors.New("spool is empty")
+
+	// ErrClosed is returned if the spool has been closed
+	ErrClosed = errors.New("spool is closed")
+
+	errUnknownPolicy = errors.New("unknown spool overflow policy")
+)
+
+// Config represents the spool configuration
+type Config struct {
+	Dir         string // directory of the segment files
+	MaxSize     int64  // maximum size of the segments in bytes
+	SegmentSize int64  // segment file size in bytes
+	Policy      string // overflow policy, drop-oldest or drop-newest
+}
+
+// Stats represents the spool stats
+type Stats struct {
+	Depth    uint64 // Number of the messages in the spool
+	Bytes    int64  // Size of the segments on disk
+	MaxBytes int64  // Maximum size of the segments
+	Policy   string // Overflow policy
+	Spilled  uint64 // Number of the written messages
+	Replayed uint64 // Number of the read messages
+	Dropped  uint64 // Number of the messages dropped by the overflow policy or corruption
+}
+
+// Queue is a bounded write-ahead FIFO queue on disk, the messages
+// are appended to the segment files and the consumed segments are
+// removed. The read position is saved when a segment is consumed and
+// when the queue is closed so the messages after a crash could be
+// replayed again since the last saved position.
+type Queue struct {
+	cfg   Config
+	lock  sync.Mutex
+	segs  []*segment // the oldest first, the last one is written
+	w     *os.File
+	r     *os.File
+	rOff  int64  // read offset in the first segment
+	rRecs uint64 // read records in the first segment
+	next  uint64 // next segment id
+	stats Stats
+	buf   []byte
+	hdr   [RecordHLen]byte
+
+	closed bool
+}
+
+type segment struct {
+	id      uint64
+	size    int64
+	records uint64
+}
+
+// Open opens the spool directory and loads the unread messages
+func Open(cfg Config) (*Queue, error) {
+	if cfg.Policy == "" {
+		cfg.Policy = PolicyDropOldest
+	}
+
+	if cfg.Policy != PolicyDropOldest && cfg.Policy != PolicyDropNewest {
+		return nil, errUnknownPolicy
+	}
+
+	if cfg.MaxSize < 1 {
+		return nil, fmt.Errorf("spool: invalid max size %d", cfg.MaxSize)
+	}
+
+	// the drop-oldest policy evicts a segment at once so the
+	// spool is divided to 8 segments by default
+	if cfg.SegmentSize < 1 {
+		cfg.SegmentSize = cfg.MaxSize / 8
+	}
+
+	if cfg.SegmentSize > cfg.MaxSize {
+		cfg.SegmentSize = cfg.MaxSize
+	}
+
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, err
+	}
+
+	q := &Queue{
+		cfg: cfg,
+		stats: Stats{
+			MaxBytes: cfg.MaxSize,
+			Policy:   cfg.Policy,
+		},
+	}
+
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+
+	if err := q.rotate(); err != nil {
+		return nil, err
+	}
+
+	return q, nil
+}
+
+// Put appends the message to the spool, if the spool is full the
+// oldest segment is evicted or ErrFull is returned based on the policy
+func (q *Queue) Put(b []byte) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+
+	n := int64(len(b) + RecordHLen)
+	if n > q.cfg.MaxSize || len(b) > maxRecordLen {
+		q.stats.Dropped++
+		return ErrFull
+	}
+
+	for q.stats.Bytes+n > q.cfg.MaxSize {
+		if q.cfg.Policy == PolicyDropNewest {
+			q.stats.Dropped++
+			return ErrFull
+		}
+
+		if err := q.evict(); err != nil {
+			return err
+		}
+	}
+
+	tail := q.segs[len(q.segs)-1]
+	if tail.size > 0 && tail.size+n > q.cfg.SegmentSize {
+		if err := q.rotate(); err != nil {
+			return err
+		}
+		tail = q.segs[len(q.segs)-1]
+	}
+
+	q.buf = q.buf[:0]
+	q.buf = binary.BigEndian.AppendUint32(q.buf, uint32(len(b)))
+	q.buf = binary.BigEndian.AppendUint32(q.buf, crc32.ChecksumIEEE(b))
+	q.buf = append(q.buf, b...)
+
+	if _, err := q.w.Write(q.buf); err != nil {
+		// the partial record is removed to keep the segment readable
+		q.w.Truncate(tail.size)
+		return err
+	}
+
+	tail.size += n
+	tail.records++
+
+	q.stats.Bytes += n
+	q.stats.Depth++
+	q.stats.Spilled++
+
+	return nil
+}
+
+// Get removes and returns the oldest message, it returns ErrEmpty
+// if there isn't any message. The message isn't reused by the queue.
+func (q *Queue) Get() ([]byte, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.closed {
+		return nil, ErrClosed
+	}
+
+	for q.stats.Depth > 0 {
+		head := q.segs[0]
+		if q.rRecs == head.records {
+			if err := q.remove(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		b, err := q.read(head)
+		if err != nil {
+			// the rest of the segment is unreadable so it's evicted,
+			// the next messages are appended to a new segment
+			if err := q.evict(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		q.stats.Depth--
+		q.stats.Replayed++
+
+		return b, nil
+	}
+
+	return nil, ErrEmpty
+}
+
+// Len returns the number of the messages in the spool
+func (q *Queue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return int(q.stats.Depth)
+}
+
+// Stats returns the spool stats
+func (q *Queue) Stats() Stats {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return q.stats
+}
+
+// Close saves the read position and closes the segment files,
+// the unread messages are loaded by the next Open
+func (q *Queue) Close() error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.closed {
+		return nil
+	}
+
+	q.closed = true
+
+	err := q.saveCursor()
+
+	if q.r != nil {
+		q.r.Close()
+	}
+
+	if cErr := q.w.Close(); err == nil {
+		err = cErr
+	}
+
+	return err
+}
+
+func (q *Queue) read(head *segment) ([]byte, error) {
+	var err error
+
+	if q.r == nil {
+		q.r, err = os.Open(q.segmentFile(head.id))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	b, n, err := readRecord(q.r, q.rOff, q.hdr[:])
+	if err != nil {
+		return nil, err
+	}
+
+	q.rOff += n
+	q.rRecs++
+
+	return b, nil
+}
+
+// evict removes the oldest segment, the written
+// segment is rotated before it's removed
+func (q *Queue) evict() error {
+	if len(q.segs) == 1 {
+		if err := q.rotate(); err != nil {
+			return err
+		}
+	}
+
+	q.drop(q.segs[0].records - q.rRecs)
+
+	return q.remove()
+}
+
+func (q *Queue) drop(n uint64) {
+	q.stats.Depth -= n
+	q.stats.Dropped += n
+}
+
+// remove removes the first segment which has been consumed
+// or evicted and saves the read position
+func (q *Queue) remove() error {
+	head := q.segs[0]
+
+	if q.r != nil {
+		q.r.Close()
+		q.r = nil
+	}
+
+	q.segs = q.segs[1:]
+	q.rOff = 0
+	q.rRecs = 0
+	q.stats.Bytes -= head.size
+
+	if err := os.Remove(q.segmentFile(head.id)); err != nil {
+		return err
+	}
+
+	return q.saveCursor()
+}
+
+// rotate closes the written segment and creates the next one
+func (q *Queue) rotate() error {
+	id := q.next
+
+	w, err := os.OpenFile(q.segmentFile(id), os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	if q.w != nil {
+		q.w.Close()
+	}
+
+	q.w = w
+	q.segs = append(q.segs, &segment{id: id})
+	q.next++
+
+	return nil
+}
+
+// load scans the segment files, removes the consumed
+// ones and truncates the incomplete records
+func (q *Queue) load() error {
+	files, err := filepath.Glob(filepath.Join(q.cfg.Dir, "*"+segmentExt))
+	if err != nil {
+		return err
+	}
+
+	ids := make([]uint64, 0, len(files))
+	for _, f := range files {
+		var id uint64
+		if _, err := fmt.Sscanf(filepath.Base(f), "%016x"+segmentExt, &id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	cID, cOff := q.loadCursor()
+
+	// the segment ids continue after the removed segments
+	q.next = cID
+	if len(ids) > 0 && ids[len(ids)-1] >= q.next {
+		q.next = ids[len(ids)-1] + 1
+	}
+
+	for _, id := range ids {
+		name := q.segmentFile(id)
+
+		if id < cID {
+			os.Remove(name)
+			continue
+		}
+
+		s, err := scanSegment(name)
+		if err != nil {
+			return err
+		}
+
+		if s.records == 0 {
+			os.Remove(name)
+			continue
+		}
+
+		s.id = id
+		q.segs = append(q.segs, s)
+		q.stats.Bytes += s.size
+		q.stats.Depth += s.records
+	}
+
+	if len(q.segs) > 0 && q.segs[0].id == cID {
+		q.skip(cOff)
+	}
+
+	return nil
+}
+
+// skip moves the read position of the first segment to the offset
+func (q *Queue) skip(offset int64) {
+	f, err := os.Open(q.segmentFile(q.segs[0].id))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	for q.rOff < offset {
+		_, n, err := readRecord(f, q.rOff, q.hdr[:])
+		if err != nil {
+			return
+		}
+
+		q.rOff += n
+		q.rRecs++
+		q.stats.Depth--
+	}
+}
+
+func (q *Queue) loadCursor() (uint64, int64) {
+	var (
+		id  uint64
+		off int64
+	)
+
+	b, err := ioutil.ReadFile(filepath.Join(q.cfg.Dir, cursorFile))
+	if err != nil {
+		return 0, 0
+	}
+
+	fmt.Sscanf(strings.TrimSpace(string(b)), "%d %d", &id, &off)
+
+	return id, off
+}
+
+func (q *Queue) saveCursor() error {
+	var (
+		id  uint64
+		off int64
+	)
+
+	if len(q.segs) > 0 {
+		id, off = q.segs[0].id, q.rOff
+	}
+
+	name := filepath.Join(q.cfg.Dir, cursorFile)
+	err := ioutil.WriteFile(name+".tmp", []byte(fmt.Sprintf("%d %d\n", id, off)), 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(name+".tmp", name)
+}
+
+func (q *Queue) segmentFile(id uint64) string {
+	return filepath.Join(q.cfg.Dir, fmt.Sprintf("%016x"+segmentExt, id))
+}
+
+// scanSegment counts the complete records of the segment file,
+// the file is truncated after the last complete record
+func scanSegment(name string) (*segment, error) {
+	var (
+		s   = &segment{}
+		hdr [RecordHLen]byte
+	)
+
+	f, err := os.OpenFile(name, os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	for {
+		_, n, err := readRecord(f, s.size, hdr[:])
+		if err != nil {
+			break
+		}
+
+		s.size += n
+		s.records++
+	}
+
+	if err := f.Truncate(s.size); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// readRecord reads the record at the offset and
+// returns the message and the record length
+func readRecord(f *os.File, offset int64, hdr []byte) ([]byte, int64, error) {
+	if _, err := f.ReadAt(hdr, offset); err != nil {
+		return nil, 0, err
+	}
+
+	length := binary.BigEndian.Uint32(hdr[0:4])
+	sum := binary.BigEndian.Uint32(hdr[4:8])
+
+	if length > maxRecordLen {
+		return nil, 0, fmt.Errorf("spool: invalid record length at %s:%d", f.Name(), offset)
+	}
+
+	b := make([]byte, length)
+	if _, err := f.ReadAt(b, offset+RecordHLen); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, 0, err
+	}
+
+	if crc32.ChecksumIEEE(b) != sum {
+		return nil, 0, fmt.Errorf("spool: corrupted record at %s:%d", f.Name(), offset)
+	}
+
+	return b, int64(length) + RecordHLen, nil
+}
@@ -0,0 +1,185 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    spool_test.go
+//: details: TODO
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package spool
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func put(t *testing.T, q *Queue, from, to int) {
+	for i := from; i < to; i++ {
+		if err := q.Put([]byte(fmt.Sprintf("msg-%03d", i))); err != nil {
+			t.Fatal("unexpected error", err)
+		}
+	}
+}
+
+func get(t *testing.T, q *Queue, from, to int) {
+	for i := from; i < to; i++ {
+		b, err := q.Get()
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+
+		if string(b) != fmt.Sprintf("msg-%03d", i) {
+			t.Fatalf("expect msg-%03d, got %s", i, b)
+		}
+	}
+}
+
+func TestQueueOrder(t *testing.T) {
+	q, err := Open(Config{Dir: t.TempDir(), MaxSize: 1 << 20, SegmentSize: 64})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer q.Close()
+
+	put(t, q, 0, 20)
+	get(t, q, 0, 10)
+	put(t, q, 20, 30)
+	get(t, q, 10, 30)
+
+	if _, err := q.Get(); err != ErrEmpty {
+		t.Error("expect empty spool, got", err)
+	}
+
+	s := q.Stats()
+	if s.Depth != 0 || s.Spilled != 30 || s.Replayed != 30 || s.Dropped != 0 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+
+	// the consumed segments are removed
+	if len(q.segs) != 1 {
+		t.Error("expect one segment, got", len(q.segs))
+	}
+}
+
+func TestQueueReopen(t *testing.T) {
+	dir := t.TempDir()
+
+	q, err := Open(Config{Dir: dir, MaxSize: 1 << 20, SegmentSize: 64})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	put(t, q, 0, 20)
+	get(t, q, 0, 7)
+	q.Close()
+
+	// incomplete record after a crash
+	f, _ := os.OpenFile(q.segmentFile(q.segs[len(q.segs)-1].id), os.O_WRONLY|os.O_APPEND, 0644)
+	f.Write([]byte{0, 0, 0, 10, 1, 2})
+	f.Close()
+
+	q, err = Open(Config{Dir: dir, MaxSize: 1 << 20, SegmentSize: 64})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer q.Close()
+
+	if q.Len() != 13 {
+		t.Fatal("expect 13 messages, got", q.Len())
+	}
+
+	put(t, q, 20, 25)
+	get(t, q, 7, 25)
+}
+
+func TestQueueCorrupted(t *testing.T) {
+	q, err := Open(Config{Dir: t.TempDir(), MaxSize: 1 << 20, SegmentSize: 64})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer q.Close()
+
+	put(t, q, 0, 6)
+
+	// corrupt the first message of the written segment
+	tail := q.segs[len(q.segs)-1]
+	f, _ := os.OpenFile(q.segmentFile(tail.id), os.O_WRONLY, 0644)
+	f.WriteAt([]byte("x"), RecordHLen)
+	f.Close()
+
+	get(t, q, 0, 4)
+
+	if _, err := q.Get(); err != ErrEmpty {
+		t.Error("expect empty spool, got", err)
+	}
+
+	// the new messages aren't appended to the corrupted segment
+	put(t, q, 6, 8)
+	get(t, q, 6, 8)
+
+	s := q.Stats()
+	if s.Depth != 0 || s.Dropped != 2 || s.Replayed != 6 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+}
+
+func TestQueueDropOldest(t *testing.T) {
+	// each record is 15 bytes and each segment has 2 records
+	q, err := Open(Config{Dir: t.TempDir(), MaxSize: 120, SegmentSize: 30})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer q.Close()
+
+	put(t, q, 0, 10)
+
+	s := q.Stats()
+	if s.Depth != 8 || s.Dropped != 2 || s.Bytes > 120 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+
+	get(t, q, 2, 10)
+}
+
+func TestQueueDropNewest(t *testing.T) {
+	q, err := Open(Config{Dir: t.TempDir(), MaxSize: 120, SegmentSize: 30, Policy: PolicyDropNewest})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer q.Close()
+
+	put(t, q, 0, 8)
+
+	if err := q.Put([]byte("msg-008")); err != ErrFull {
+		t.Error("expect full spool, got", err)
+	}
+
+	s := q.Stats()
+	if s.Depth != 8 || s.Dropped != 1 || s.Policy != PolicyDropNewest {
+		t.Errorf("unexpected stats %+v", s)
+	}
+
+	get(t, q, 0, 8)
+	put(t, q, 8, 10)
+	get(t, q, 8, 10)
+}
+
+func TestQueuePolicy(t *testing.T) {
+	_, err := Open(Config{Dir: t.TempDir(), MaxSize: 120, Policy: "drop-all"})
+	if err != errUnknownPolicy {
+		t.Error("expect unknown policy error, got", err)
+	}
+}
@@ -24,25 +24,34 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"net"
-	"path"
 	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/EdgeCast/vflow/ipfix"
+	"github.com/EdgeCast/vflow/mirror"
 	"github.com/EdgeCast/vflow/producer"
+	"github.com/EdgeCast/vflow/sequence"
 )
 
 // IPFIX represents IPFIX collector
 type IPFIX struct {
-	port    int
-	addr    string
-	workers int
-	stop    bool
-	stats   IPFIXStats
-	pool    chan chan struct{}
+	port     int
+	addr     string
+	workers  int
+	stop     int32
+	stopped  chan struct{}
+	quit     chan struct{}
+	dynWG    sync.WaitGroup
+	wg       sync.WaitGroup
+	mirrorWG sync.WaitGroup
+	stats    IPFIXStats
+	pool     chan chan struct{}
+	seq      *sequence.Tracker
+	sinks    *sinks
 }
 
 // IPFIXUDPMsg represents IPFIX UDP data
@@ -59,13 +68,17 @@ type IPFIXStats struct {
 	UDPCount       uint64
 	DecodedCount   uint64
 	MQErrorCount   uint64
+	MQDropCount    uint64
 	Workers        int32
+	Sequences      []sequence.Stats `json:",omitempty"`
+	Mirror         []mirror.Stats   `json:",omitempty"`
+	Sinks          []SinkStats      `json:",omitempty"`
 }
 
 var (
 	ipfixUDPCh         = make(chan IPFIXUDPMsg, 1000)
 	ipfixMCh           = make(chan IPFIXUDPMsg, 1000)
-	ipfixMQCh          = make(chan []byte, 1000)
+	ipfixMQCh          = make(chan producer.Message, 1000)
 	ipfixMirrorEnabled bool
 
 	// templates memory cache
@@ -82,9 +95,14 @@ var (
 // NewIPFIX constructs IPFIX
 func NewIPFIX() *IPFIX {
 	return &IPFIX{
+		stopped: make(chan struct{}),
+		quit:    make(chan struct{}),
 		port:    opts.IPFIXPort,
 		addr:    opts.IPFIXAddr,
 		workers: opts.IPFIXWorkers,
+		// the ipfix sequence number counts the data records
+		seq:   sequence.NewTracker(1 << 20),
+		sinks: newSinks("ipfix", opts.IPFIXTopic),
 	}
 }
 
@@ -107,7 +125,9 @@ func (i *IPFIX) run() {
 
 	atomic.AddInt32(&i.stats.Workers, int32(i.workers))
 	for n := 0; n < i.workers; n++ {
+		i.wg.Add(1)
 		go func() {
+			defer i.wg.Done()
 			wQuit := make(chan struct{})
 			i.pool <- wQuit
 			i.ipfixWorker(wQuit)
@@ -127,26 +147,18 @@ func (i *IPFIX) run() {
 		Logger:  logger,
 	})
 
-	go mirrorIPFIXDispatcher(ipfixMCh)
-
+	i.mirrorWG.Add(1)
 	go func() {
-		if !opts.ProducerEnabled {
-			return
-		}
-
-		p := producer.NewProducer(opts.MQName)
-		p.MQConfigFile = path.Join(opts.VFlowConfigPath, opts.MQConfigFile)
-		p.MQErrorCount = &i.stats.MQErrorCount
-		p.Logger = logger
-		p.Chan = ipfixMQCh
-		p.Topic = opts.IPFIXTopic
-
-		if err := p.Run(); err != nil {
-			logger.Fatal(err)
-		}
+		defer i.mirrorWG.Done()
+		mirrorIPFIXDispatcher(ipfixMCh)
 	}()
 
+	i.sinks.start(ipfixMQCh)
+
+	i.dynWG.Add(1)
 	go func() {
+		defer i.dynWG.Done()
+
 		if !opts.DynWorkers {
 			logger.Println("IPFIX dynamic worker disabled")
 			return
@@ -155,7 +167,7 @@ func (i *IPFIX) run() {
 		i.dynWorkers()
 	}()
 
-	for !i.stop {
+	for atomic.LoadInt32(&i.stop) == 0 {
 		b := ipfixBuffer.Get().([]byte)
 		conn.SetReadDeadline(time.Now().Add(1e9))
 		n, raddr, err := conn.ReadFromUDP(b)
@@ -166,27 +178,50 @@ func (i *IPFIX) run() {
 		ipfixUDPCh <- IPFIXUDPMsg{raddr, b[:n]}
 	}
 
+	conn.Close()
+	close(i.stopped)
 }
 
-func (i *IPFIX) shutdown() {
+func (i *IPFIX) shutdown(ctx context.Context) {
 	// exit if the ipfix is disabled
 	if !opts.IPFIXEnabled {
 		return
 	}
 
 	// stop reading from UDP listener
-	i.stop = true
+	atomic.StoreInt32(&i.stop, 1)
 	logger.Println("stopping ipfix service gracefully ...")
-	time.Sleep(1 * time.Second)
+	i.sinks.mark()
+	<-i.stopped
+
+	// the dynamic workers stop before waiting for the workers
+	close(i.quit)
+	i.dynWG.Wait()
+
+	// drain the UDP queue, the message queue channel is
+	// closed once the workers don't send any message
+	close(ipfixUDPCh)
+	if wait(ctx, &i.wg) {
+		close(ipfixMQCh)
+		close(ipfixMCh)
+	} else {
+		logger.Printf("ipfix workers haven't been drained, udp queue: %d", len(ipfixUDPCh))
+	}
+
+	// the mirror closes its replicator once the mirrored packets are sent
+	if !wait(ctx, &i.mirrorWG) {
+		logger.Println("ipfix mirror hasn't been drained")
+	}
 
 	// dump the templates to storage
 	if err := mCache.Dump(opts.IPFIXTplCacheFile); err != nil {
 		logger.Println("couldn't not dump template", err)
 	}
 
-	// logging and close UDP channel
-	logger.Println("ipfix has been shutdown")
-	close(ipfixUDPCh)
+	// flush and close the message queues
+	i.sinks.shutdown(ctx, "ipfix")
+
+	logger.Printf("ipfix has been shutdown, dropped %d", atomic.LoadUint64(&i.stats.MQDropCount))
 }
 
 func (i *IPFIX) ipfixWorker(wQuit chan struct{}) {
@@ -242,6 +277,14 @@ LOOP:
 
 		atomic.AddUint64(&i.stats.DecodedCount, 1)
 
+		// the number of data records is unknown if a set couldn't decode
+		if err != nil {
+			i.seq.Resync(decodedMsg.AgentID, uint64(decodedMsg.Header.DomainID), decodedMsg.Header.SequenceNo)
+		} else {
+			i.seq.Update(decodedMsg.AgentID, uint64(decodedMsg.Header.DomainID), decodedMsg.Header.SequenceNo,
+				uint32(len(decodedMsg.DataSets)))
+		}
+
 		if len(decodedMsg.DataSets) > 0 {
 			b, err = decodedMsg.JSONMarshal(buf)
 			if err != nil {
@@ -250,8 +293,13 @@ LOOP:
 			}
 
 			select {
-			case ipfixMQCh <- append([]byte{}, b...):
+			case ipfixMQCh <- producer.Message{
+				Value:    append([]byte{}, b...),
+				Exporter: decodedMsg.AgentID,
+				Domain:   uint64(decodedMsg.Header.DomainID),
+			}:
 			default:
+				atomic.AddUint64(&i.stats.MQDropCount, 1)
 			}
 
 			if opts.Verbose {
@@ -269,7 +317,8 @@ func (i *IPFIX) status() *IPFIXStats {
 		MessageQueue:   len(ipfixMQCh),
 		UDPCount:       atomic.LoadUint64(&i.stats.UDPCount),
 		DecodedCount:   atomic.LoadUint64(&i.stats.DecodedCount),
-		MQErrorCount:   atomic.LoadUint64(&i.stats.MQErrorCount),
+		MQErrorCount:   i.sinks.errors(),
+		MQDropCount:    atomic.LoadUint64(&i.stats.MQDropCount),
 		Workers:        atomic.LoadInt32(&i.stats.Workers),
 	}
 }
@@ -277,14 +326,24 @@ func (i *IPFIX) status() *IPFIXStats {
 func (i *IPFIX) dynWorkers() {
 	var load, nSeq, newWorkers, workers, n int
 
-	tick := time.Tick(120 * time.Second)
+	tick := time.NewTicker(120 * time.Second)
+	defer tick.Stop()
 
 	for {
-		<-tick
+		select {
+		case <-tick.C:
+		case <-i.quit:
+			return
+		}
+
 		load = 0
 
 		for n = 0; n < 30; n++ {
-			time.Sleep(1 * time.Second)
+			select {
+			case <-time.After(time.Second):
+			case <-i.quit:
+				return
+			}
 			load += len(ipfixUDPCh)
 		}
 
@@ -308,7 +367,9 @@ func (i *IPFIX) dynWorkers() {
 			}
 
 			for n = 0; n < newWorkers; n++ {
+				i.wg.Add(1)
 				go func() {
+					defer i.wg.Done()
 					atomic.AddInt32(&i.stats.Workers, 1)
 					wQuit := make(chan struct{})
 					i.pool <- wQuit
@@ -24,9 +24,12 @@ package main
 
 import (
 	"net"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/EdgeCast/vflow/mirror"
 )
 
 func init() {
@@ -37,12 +40,13 @@ func TestMirrorIPFIX(t *testing.T) {
 	var (
 		msg   = make(chan IPFIXUDPMsg, 1)
 		fb    = make(chan IPFIXUDPMsg)
-		dst   = net.ParseIP("127.0.0.1")
 		ready = make(chan struct{})
 	)
 
 	go func() {
-		err := mirrorIPFIX(dst, 10024, msg)
+		r, err := mirror.NewReplicator(mirror.Config{
+			Destinations: []mirror.Destination{{Addr: "127.0.0.1", Port: 10024}},
+		})
 		if err != nil {
 			if strings.Contains(err.Error(), "not permitted") {
 				t.Log(err)
@@ -50,7 +54,10 @@ func TestMirrorIPFIX(t *testing.T) {
 			} else {
 				t.Fatal("unexpected error", err)
 			}
+			return
 		}
+
+		mirrorIPFIX(r, msg)
 	}()
 
 	time.Sleep(2 * time.Second)
@@ -74,14 +81,19 @@ func TestMirrorIPFIX(t *testing.T) {
 			t.Error("unexpected error", err)
 		}
 
-		host, _, err := net.SplitHostPort(raddr.String())
+		host, portStr, err := net.SplitHostPort(raddr.String())
+		if err != nil {
+			t.Error("unexpected error", err)
+		}
+
+		port, err := strconv.Atoi(portStr)
 		if err != nil {
 			t.Error("unexpected error", err)
 		}
 
 		fb <- IPFIXUDPMsg{
 			body:  b[:n],
-			raddr: &net.UDPAddr{IP: net.ParseIP(host)},
+			raddr: &net.UDPAddr{IP: net.ParseIP(host), Port: port},
 		}
 
 	}()
@@ -96,7 +108,8 @@ func TestMirrorIPFIX(t *testing.T) {
 	msg <- IPFIXUDPMsg{
 		body: body,
 		raddr: &net.UDPAddr{
-			IP: net.ParseIP("192.1.1.1"),
+			IP:   net.ParseIP("192.1.1.1"),
+			Port: 9995,
 		},
 	}
 
@@ -109,4 +122,8 @@ func TestMirrorIPFIX(t *testing.T) {
 	if feedback.raddr.IP.String() != "192.1.1.1" {
 		t.Error("expect raddr is 192.1.1.1, got", feedback.raddr.IP.String())
 	}
+
+	if feedback.raddr.Port != 9995 {
+		t.Error("expect raddr port is 9995, got", feedback.raddr.Port)
+	}
 }
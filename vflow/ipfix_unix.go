@@ -22,101 +22,32 @@
 
 package main
 
-import (
-	"github.com/EdgeCast/vflow/mirror"
-
-	"net"
-)
+import "github.com/EdgeCast/vflow/mirror"
 
 func mirrorIPFIXDispatcher(ch chan IPFIXUDPMsg) {
-	var (
-		ch4 = make(chan IPFIXUDPMsg, 1000)
-		ch6 = make(chan IPFIXUDPMsg, 1000)
-		msg IPFIXUDPMsg
-	)
-
-	if opts.IPFIXMirrorAddr == "" {
+	r, err := newReplicator("ipfix", opts.IPFIXMirrorAddr,
+		opts.IPFIXMirrorPort, opts.IPFIXMirrorWorkers)
+	if err != nil {
+		logger.Println("ipfix mirror:", err)
 		return
 	}
 
-	for w := 0; w < opts.IPFIXMirrorWorkers; w++ {
-		dst := net.ParseIP(opts.IPFIXMirrorAddr)
-
-		if dst.To4() != nil {
-			go mirrorIPFIX(dst, opts.IPFIXMirrorPort, ch4)
-		} else {
-			go mirrorIPFIX(dst, opts.IPFIXMirrorPort, ch6)
-		}
+	if r == nil {
+		return
 	}
 
 	ipfixMirrorEnabled = true
-	logger.Printf("ipfix mirror service is running (workers#: %d) ...", opts.IPFIXMirrorWorkers)
+	logger.Printf("ipfix mirror service is running (destinations#: %d) ...", len(r.Stats()))
 
-	for {
-		msg = <-ch
-		if msg.raddr.IP.To4() != nil {
-			ch4 <- msg
-		} else {
-			ch6 <- msg
-		}
-	}
-}
-
-func mirrorIPFIX(dst net.IP, port int, ch chan IPFIXUDPMsg) error {
-	var (
-		packet = make([]byte, opts.IPFIXUDPSize)
-		msg    IPFIXUDPMsg
-		pLen   int
-		err    error
-		ipHdr  []byte
-		ipHLen int
-		ipv4   bool
-		ip     mirror.IP
-	)
-
-	conn, err := mirror.NewRawConn(dst)
-	if err != nil {
-		return err
-	}
+	mirrorIPFIX(r, ch)
 
-	udp := mirror.UDP{55117, port, 0, 0}
-	udpHdr := udp.Marshal()
-
-	if dst.To4() != nil {
-		ipv4 = true
-	}
-
-	if ipv4 {
-		ip = mirror.NewIPv4HeaderTpl(mirror.UDPProto)
-		ipHdr = ip.Marshal()
-		ipHLen = mirror.IPv4HLen
-	} else {
-		ip = mirror.NewIPv6HeaderTpl(mirror.UDPProto)
-		ipHdr = ip.Marshal()
-		ipHLen = mirror.IPv6HLen
-	}
-
-	for {
-		msg = <-ch
-		pLen = len(msg.body)
-
-		ip.SetAddrs(ipHdr, msg.raddr.IP, dst)
-		ip.SetLen(ipHdr, pLen+mirror.UDPHLen)
-
-		udp.SetLen(udpHdr, pLen)
-		// IPv6 checksum mandatory
-		if !ipv4 {
-			udp.SetChecksum()
-		}
-
-		copy(packet[0:ipHLen], ipHdr)
-		copy(packet[ipHLen:ipHLen+8], udpHdr)
-		copy(packet[ipHLen+8:], msg.body)
+	// the mirror channel has been closed by the shutdown
+	r.Close()
+}
 
+func mirrorIPFIX(r *mirror.Replicator, ch chan IPFIXUDPMsg) {
+	for msg := range ch {
+		r.Replicate(msg.raddr, msg.body)
 		ipfixBuffer.Put(msg.body[:opts.IPFIXUDPSize])
-
-		if err = conn.Send(packet[0 : ipHLen+8+pLen]); err != nil {
-			return err
-		}
 	}
 }
@@ -0,0 +1,152 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    mirror.go
+//: details: UDP mirror replicators
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/EdgeCast/vflow/mirror"
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	// the mirror configuration per protocol
+	mirrorConfig     map[string]mirror.Config
+	mirrorConfigOnce sync.Once
+
+	// the running replicators per protocol
+	mirrorReplicators sync.Map
+)
+
+// loadMirrorConfig loads the mirror configuration file once,
+// the file is optional and the protocols are the top keys:
+//
+//	ipfix:
+//	  fan-out: hash
+//	  destinations:
+//	    - addr: 192.0.2.10
+//	      port: 4739
+//	      exporters: [10.0.0.0/8]
+//	      sample: 10
+func loadMirrorConfig() map[string]mirror.Config {
+	mirrorConfigOnce.Do(func() {
+		file := path.Join(opts.VFlowConfigPath, opts.MirrorConfigFile)
+
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				logger.Println(err)
+			}
+			return
+		}
+
+		err = yaml.Unmarshal(b, &mirrorConfig)
+		if err != nil {
+			logger.Println(err)
+		}
+	})
+
+	return mirrorConfig
+}
+
+// newReplicator constructs the protocol replicator from the mirror
+// configuration file and the protocol mirror options, it returns
+// nil if there isn't any destination for the protocol
+func newReplicator(name, addr string, port, workers int) (*mirror.Replicator, error) {
+	cfg := loadMirrorConfig()[name]
+
+	if addr != "" {
+		cfg.Destinations = append(cfg.Destinations, mirror.Destination{
+			Addr: addr,
+			Port: port,
+		})
+	}
+
+	if len(cfg.Destinations) == 0 {
+		return nil, nil
+	}
+
+	if cfg.Workers == 0 {
+		cfg.Workers = workers
+	}
+
+	r, err := mirror.NewReplicator(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	mirrorReplicators.Store(name, r)
+
+	return r, nil
+}
+
+// mirrorStats returns the protocol mirror destinations stats
+func mirrorStats(name string) []mirror.Stats {
+	if r, ok := mirrorReplicators.Load(name); ok {
+		return r.(*mirror.Replicator).Stats()
+	}
+
+	return nil
+}
+
+// mirrorCollector exposes the mirror stats per protocol and destination
+type mirrorCollector struct {
+	sent         *prometheus.Desc
+	dropped      *prometheus.Desc
+	unmirrorable *prometheus.Desc
+}
+
+func newMirrorCollector() *mirrorCollector {
+	labels := []string{"protocol", "destination"}
+
+	return &mirrorCollector{
+		sent: prometheus.NewDesc("vflow_mirror_sent_packets",
+			"number of mirrored packets", labels, nil),
+		dropped: prometheus.NewDesc("vflow_mirror_dropped_packets",
+			"number of packets which couldn't be queued or sent", labels, nil),
+		unmirrorable: prometheus.NewDesc("vflow_mirror_unmirrorable_packets",
+			"number of packets which can't be built for the destination", labels, nil),
+	}
+}
+
+func (c *mirrorCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.sent
+	ch <- c.dropped
+	ch <- c.unmirrorable
+}
+
+func (c *mirrorCollector) Collect(ch chan<- prometheus.Metric) {
+	mirrorReplicators.Range(func(k, v interface{}) bool {
+		for _, s := range v.(*mirror.Replicator).Stats() {
+			ch <- prometheus.MustNewConstMetric(c.sent, prometheus.CounterValue,
+				float64(s.Sent), k.(string), s.Destination)
+			ch <- prometheus.MustNewConstMetric(c.dropped, prometheus.CounterValue,
+				float64(s.Dropped), k.(string), s.Destination)
+			ch <- prometheus.MustNewConstMetric(c.unmirrorable, prometheus.CounterValue,
+				float64(s.Unmirrorable), k.(string), s.Destination)
+		}
+		return true
+	})
+}
@@ -24,25 +24,34 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"net"
-	"path"
 	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/EdgeCast/vflow/mirror"
 	netflow5 "github.com/EdgeCast/vflow/netflow/v5"
 	"github.com/EdgeCast/vflow/producer"
+	"github.com/EdgeCast/vflow/sequence"
 )
 
 // NetflowV5 represents netflow v5 collector
 type NetflowV5 struct {
-	port    int
-	addr    string
-	workers int
-	stop    bool
-	stats   NetflowV5Stats
-	pool    chan chan struct{}
+	port     int
+	addr     string
+	workers  int
+	stop     int32
+	stopped  chan struct{}
+	quit     chan struct{}
+	dynWG    sync.WaitGroup
+	wg       sync.WaitGroup
+	mirrorWG sync.WaitGroup
+	stats    NetflowV5Stats
+	pool     chan chan struct{}
+	seq      *sequence.Tracker
+	sinks    *sinks
 }
 
 // NetflowV5UDPMsg represents netflow v5 UDP data
@@ -53,17 +62,24 @@ type NetflowV5UDPMsg struct {
 
 // NetflowV5Stats represents netflow v5 stats
 type NetflowV5Stats struct {
-	UDPQueue     int
-	MessageQueue int
-	UDPCount     uint64
-	DecodedCount uint64
-	MQErrorCount uint64
-	Workers      int32
+	UDPQueue       int
+	UDPMirrorQueue int
+	MessageQueue   int
+	UDPCount       uint64
+	DecodedCount   uint64
+	MQErrorCount   uint64
+	MQDropCount    uint64
+	Workers        int32
+	Sequences      []sequence.Stats `json:",omitempty"`
+	Mirror         []mirror.Stats   `json:",omitempty"`
+	Sinks          []SinkStats      `json:",omitempty"`
 }
 
 var (
-	netflowV5UDPCh = make(chan NetflowV5UDPMsg, 1000)
-	netflowV5MQCh  = make(chan []byte, 1000)
+	netflowV5UDPCh         = make(chan NetflowV5UDPMsg, 1000)
+	netflowV5MCh           = make(chan NetflowV5UDPMsg, 1000)
+	netflowV5MQCh          = make(chan producer.Message, 1000)
+	netflowV5MirrorEnabled atomic.Bool
 
 	// ipfix udp payload pool
 	netflowV5Buffer = &sync.Pool{
@@ -76,9 +92,14 @@ var (
 // NewNetflowV5 constructs NetflowV5
 func NewNetflowV5() *NetflowV5 {
 	return &NetflowV5{
+		stopped: make(chan struct{}),
+		quit:    make(chan struct{}),
 		port:    opts.NetflowV5Port,
 		addr:    opts.NetflowV5Addr,
 		workers: opts.NetflowV5Workers,
+		// the netflow v5 sequence number counts the flows
+		seq:   sequence.NewTracker(1 << 20),
+		sinks: newSinks("netflow5", opts.NetflowV5Topic),
 	}
 }
 
@@ -101,7 +122,9 @@ func (i *NetflowV5) run() {
 
 	atomic.AddInt32(&i.stats.Workers, int32(i.workers))
 	for n := 0; n < i.workers; n++ {
+		i.wg.Add(1)
 		go func() {
+			defer i.wg.Done()
 			wQuit := make(chan struct{})
 			i.pool <- wQuit
 			i.netflowV5Worker(wQuit)
@@ -110,24 +133,18 @@ func (i *NetflowV5) run() {
 
 	logger.Printf("netflow v5 is running (UDP: listening on [::]:%d workers#: %d)", i.port, i.workers)
 
+	i.mirrorWG.Add(1)
 	go func() {
-		if !opts.ProducerEnabled {
-			return
-		}
-
-		p := producer.NewProducer(opts.MQName)
-		p.MQConfigFile = path.Join(opts.VFlowConfigPath, opts.MQConfigFile)
-		p.MQErrorCount = &i.stats.MQErrorCount
-		p.Logger = logger
-		p.Chan = netflowV5MQCh
-		p.Topic = opts.NetflowV5Topic
-
-		if err := p.Run(); err != nil {
-			logger.Fatal(err)
-		}
+		defer i.mirrorWG.Done()
+		mirrorNetflowV5Dispatcher(netflowV5MCh)
 	}()
 
+	i.sinks.start(netflowV5MQCh)
+
+	i.dynWG.Add(1)
 	go func() {
+		defer i.dynWG.Done()
+
 		if !opts.DynWorkers {
 			logger.Println("netflow v5 dynamic worker disabled")
 			return
@@ -136,7 +153,7 @@ func (i *NetflowV5) run() {
 		i.dynWorkers()
 	}()
 
-	for !i.stop {
+	for atomic.LoadInt32(&i.stop) == 0 {
 		b := netflowV5Buffer.Get().([]byte)
 		conn.SetReadDeadline(time.Now().Add(1e9))
 		n, raddr, err := conn.ReadFromUDP(b)
@@ -147,27 +164,51 @@ func (i *NetflowV5) run() {
 		netflowV5UDPCh <- NetflowV5UDPMsg{raddr, b[:n]}
 	}
 
+	conn.Close()
+	close(i.stopped)
 }
 
-func (i *NetflowV5) shutdown() {
+func (i *NetflowV5) shutdown(ctx context.Context) {
 	// exit if the netflow v5 is disabled
 	if !opts.NetflowV5Enabled {
 		return
 	}
 
 	// stop reading from UDP listener
-	i.stop = true
+	atomic.StoreInt32(&i.stop, 1)
 	logger.Println("stopping netflow v5 service gracefully ...")
-	time.Sleep(1 * time.Second)
+	i.sinks.mark()
+	<-i.stopped
 
-	// logging and close UDP channel
-	logger.Println("netflow v5 has been shutdown")
+	// the dynamic workers stop before waiting for the workers
+	close(i.quit)
+	i.dynWG.Wait()
+
+	// drain the UDP queue, the message queue channel is
+	// closed once the workers don't send any message
 	close(netflowV5UDPCh)
+	if wait(ctx, &i.wg) {
+		close(netflowV5MQCh)
+		close(netflowV5MCh)
+	} else {
+		logger.Printf("netflow v5 workers haven't been drained, udp queue: %d", len(netflowV5UDPCh))
+	}
+
+	// the mirror closes its replicator once the mirrored packets are sent
+	if !wait(ctx, &i.mirrorWG) {
+		logger.Println("netflow v5 mirror hasn't been drained")
+	}
+
+	// flush and close the message queues
+	i.sinks.shutdown(ctx, "netflow v5")
+
+	logger.Printf("netflow v5 has been shutdown, dropped %d", atomic.LoadUint64(&i.stats.MQDropCount))
 }
 
 func (i *NetflowV5) netflowV5Worker(wQuit chan struct{}) {
 	var (
 		decodedMsg *netflow5.Message
+		mirror     NetflowV5UDPMsg
 		msg        = NetflowV5UDPMsg{body: netflowV5Buffer.Get().([]byte)}
 		buf        = new(bytes.Buffer)
 		err        error
@@ -195,6 +236,17 @@ LOOP:
 				msg.raddr, len(msg.body))
 		}
 
+		if netflowV5MirrorEnabled.Load() {
+			mirror.body = netflowV5Buffer.Get().([]byte)
+			mirror.raddr = msg.raddr
+			mirror.body = append(mirror.body[:0], msg.body...)
+
+			select {
+			case netflowV5MCh <- mirror:
+			default:
+			}
+		}
+
 		d := netflow5.NewDecoder(msg.raddr.IP, msg.body)
 		if decodedMsg, err = d.Decode(); err != nil {
 			logger.Println(err)
@@ -205,6 +257,10 @@ LOOP:
 
 		atomic.AddUint64(&i.stats.DecodedCount, 1)
 
+		// the flows are identified by the engine type and id
+		domain := uint64(decodedMsg.Header.EngType)<<8 | uint64(decodedMsg.Header.EngID)
+		i.seq.Update(decodedMsg.AgentID, domain, decodedMsg.Header.SeqNum, uint32(decodedMsg.Header.Count))
+
 		if decodedMsg.Flows != nil {
 			b, err = decodedMsg.JSONMarshal(buf)
 			if err != nil {
@@ -213,8 +269,13 @@ LOOP:
 			}
 
 			select {
-			case netflowV5MQCh <- append([]byte{}, b...):
+			case netflowV5MQCh <- producer.Message{
+				Value:    append([]byte{}, b...),
+				Exporter: decodedMsg.AgentID,
+				Domain:   domain,
+			}:
 			default:
+				atomic.AddUint64(&i.stats.MQDropCount, 1)
 			}
 		}
 
@@ -228,12 +289,14 @@ LOOP:
 
 func (i *NetflowV5) status() *NetflowV5Stats {
 	return &NetflowV5Stats{
-		UDPQueue:     len(netflowV5UDPCh),
-		MessageQueue: len(netflowV5MQCh),
-		UDPCount:     atomic.LoadUint64(&i.stats.UDPCount),
-		DecodedCount: atomic.LoadUint64(&i.stats.DecodedCount),
-		MQErrorCount: atomic.LoadUint64(&i.stats.MQErrorCount),
-		Workers:      atomic.LoadInt32(&i.stats.Workers),
+		UDPQueue:       len(netflowV5UDPCh),
+		UDPMirrorQueue: len(netflowV5MCh),
+		MessageQueue:   len(netflowV5MQCh),
+		UDPCount:       atomic.LoadUint64(&i.stats.UDPCount),
+		DecodedCount:   atomic.LoadUint64(&i.stats.DecodedCount),
+		MQErrorCount:   i.sinks.errors(),
+		MQDropCount:    atomic.LoadUint64(&i.stats.MQDropCount),
+		Workers:        atomic.LoadInt32(&i.stats.Workers),
 	}
 
 }
@@ -241,14 +304,24 @@ func (i *NetflowV5) status() *NetflowV5Stats {
 func (i *NetflowV5) dynWorkers() {
 	var load, nSeq, newWorkers, workers, n int
 
-	tick := time.Tick(120 * time.Second)
+	tick := time.NewTicker(120 * time.Second)
+	defer tick.Stop()
 
 	for {
-		<-tick
+		select {
+		case <-tick.C:
+		case <-i.quit:
+			return
+		}
+
 		load = 0
 
 		for n = 0; n < 30; n++ {
-			time.Sleep(1 * time.Second)
+			select {
+			case <-time.After(time.Second):
+			case <-i.quit:
+				return
+			}
 			load += len(netflowV5UDPCh)
 		}
 
@@ -272,7 +345,9 @@ func (i *NetflowV5) dynWorkers() {
 			}
 
 			for n = 0; n < newWorkers; n++ {
+				i.wg.Add(1)
 				go func() {
+					defer i.wg.Done()
 					atomic.AddInt32(&i.stats.Workers, 1)
 					wQuit := make(chan struct{})
 					i.pool <- wQuit
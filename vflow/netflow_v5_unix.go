@@ -0,0 +1,53 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    netflow_v5_unix.go
+//: details: netflow v5 UDP mirror
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+//go:build !windows
+// +build !windows
+
+package main
+
+import "github.com/EdgeCast/vflow/mirror"
+
+func mirrorNetflowV5Dispatcher(ch chan NetflowV5UDPMsg) {
+	r, err := newReplicator("netflow5", opts.NetflowV5MirrorAddr,
+		opts.NetflowV5MirrorPort, opts.NetflowV5MirrorWorkers)
+	if err != nil {
+		logger.Println("netflow v5 mirror:", err)
+		return
+	}
+
+	if r == nil {
+		return
+	}
+
+	netflowV5MirrorEnabled.Store(true)
+	logger.Printf("netflow v5 mirror service is running (destinations#: %d) ...", len(r.Stats()))
+
+	mirrorNetflowV5(r, ch)
+
+	// the mirror channel has been closed by the shutdown
+	r.Close()
+}
+
+func mirrorNetflowV5(r *mirror.Replicator, ch chan NetflowV5UDPMsg) {
+	for msg := range ch {
+		r.Replicate(msg.raddr, msg.body)
+		netflowV5Buffer.Put(msg.body[:opts.NetflowV5UDPSize])
+	}
+}
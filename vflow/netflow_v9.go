@@ -24,25 +24,34 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"net"
-	"path"
 	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/EdgeCast/vflow/mirror"
 	netflow9 "github.com/EdgeCast/vflow/netflow/v9"
 	"github.com/EdgeCast/vflow/producer"
+	"github.com/EdgeCast/vflow/sequence"
 )
 
 // NetflowV9 represents netflow v9 collector
 type NetflowV9 struct {
-	port    int
-	addr    string
-	workers int
-	stop    bool
-	stats   NetflowV9Stats
-	pool    chan chan struct{}
+	port     int
+	addr     string
+	workers  int
+	stop     int32
+	stopped  chan struct{}
+	quit     chan struct{}
+	dynWG    sync.WaitGroup
+	wg       sync.WaitGroup
+	mirrorWG sync.WaitGroup
+	stats    NetflowV9Stats
+	pool     chan chan struct{}
+	seq      *sequence.Tracker
+	sinks    *sinks
 }
 
 // NetflowV9UDPMsg represents netflow v9 UDP data
@@ -53,17 +62,24 @@ type NetflowV9UDPMsg struct {
 
 // NetflowV9Stats represents netflow v9 stats
 type NetflowV9Stats struct {
-	UDPQueue     int
-	MessageQueue int
-	UDPCount     uint64
-	DecodedCount uint64
-	MQErrorCount uint64
-	Workers      int32
+	UDPQueue       int
+	UDPMirrorQueue int
+	MessageQueue   int
+	UDPCount       uint64
+	DecodedCount   uint64
+	MQErrorCount   uint64
+	MQDropCount    uint64
+	Workers        int32
+	Sequences      []sequence.Stats `json:",omitempty"`
+	Mirror         []mirror.Stats   `json:",omitempty"`
+	Sinks          []SinkStats      `json:",omitempty"`
 }
 
 var (
-	netflowV9UDPCh = make(chan NetflowV9UDPMsg, 1000)
-	netflowV9MQCh  = make(chan []byte, 1000)
+	netflowV9UDPCh         = make(chan NetflowV9UDPMsg, 1000)
+	netflowV9MCh           = make(chan NetflowV9UDPMsg, 1000)
+	netflowV9MQCh          = make(chan producer.Message, 1000)
+	netflowV9MirrorEnabled atomic.Bool
 
 	mCacheNF9 netflow9.MemCache
 
@@ -78,9 +94,14 @@ var (
 // NewNetflowV9 constructs NetflowV9
 func NewNetflowV9() *NetflowV9 {
 	return &NetflowV9{
+		stopped: make(chan struct{}),
+		quit:    make(chan struct{}),
 		port:    opts.NetflowV9Port,
 		addr:    opts.NetflowV9Addr,
 		workers: opts.NetflowV9Workers,
+		// the netflow v9 sequence number counts the export packets
+		seq:   sequence.NewTracker(1 << 16),
+		sinks: newSinks("netflow9", opts.NetflowV9Topic),
 	}
 }
 
@@ -103,7 +124,9 @@ func (i *NetflowV9) run() {
 
 	atomic.AddInt32(&i.stats.Workers, int32(i.workers))
 	for n := 0; n < i.workers; n++ {
+		i.wg.Add(1)
 		go func() {
+			defer i.wg.Done()
 			wQuit := make(chan struct{})
 			i.pool <- wQuit
 			i.netflowV9Worker(wQuit)
@@ -114,24 +137,18 @@ func (i *NetflowV9) run() {
 
 	mCacheNF9 = netflow9.GetCache(opts.NetflowV9TplCacheFile)
 
+	i.mirrorWG.Add(1)
 	go func() {
-		if !opts.ProducerEnabled {
-			return
-		}
-
-		p := producer.NewProducer(opts.MQName)
-		p.MQConfigFile = path.Join(opts.VFlowConfigPath, opts.MQConfigFile)
-		p.MQErrorCount = &i.stats.MQErrorCount
-		p.Logger = logger
-		p.Chan = netflowV9MQCh
-		p.Topic = opts.NetflowV9Topic
-
-		if err := p.Run(); err != nil {
-			logger.Fatal(err)
-		}
+		defer i.mirrorWG.Done()
+		mirrorNetflowV9Dispatcher(netflowV9MCh)
 	}()
 
+	i.sinks.start(netflowV9MQCh)
+
+	i.dynWG.Add(1)
 	go func() {
+		defer i.dynWG.Done()
+
 		if !opts.DynWorkers {
 			logger.Println("netflow v9 dynamic worker disabled")
 			return
@@ -140,7 +157,7 @@ func (i *NetflowV9) run() {
 		i.dynWorkers()
 	}()
 
-	for !i.stop {
+	for atomic.LoadInt32(&i.stop) == 0 {
 		b := netflowV9Buffer.Get().([]byte)
 		conn.SetReadDeadline(time.Now().Add(1e9))
 		n, raddr, err := conn.ReadFromUDP(b)
@@ -151,32 +168,56 @@ func (i *NetflowV9) run() {
 		netflowV9UDPCh <- NetflowV9UDPMsg{raddr, b[:n]}
 	}
 
+	conn.Close()
+	close(i.stopped)
 }
 
-func (i *NetflowV9) shutdown() {
+func (i *NetflowV9) shutdown(ctx context.Context) {
 	// exit if the netflow v9 is disabled
 	if !opts.NetflowV9Enabled {
 		return
 	}
 
 	// stop reading from UDP listener
-	i.stop = true
+	atomic.StoreInt32(&i.stop, 1)
 	logger.Println("stopping netflow v9 service gracefully ...")
-	time.Sleep(1 * time.Second)
+	i.sinks.mark()
+	<-i.stopped
+
+	// the dynamic workers stop before waiting for the workers
+	close(i.quit)
+	i.dynWG.Wait()
+
+	// drain the UDP queue, the message queue channel is
+	// closed once the workers don't send any message
+	close(netflowV9UDPCh)
+	if wait(ctx, &i.wg) {
+		close(netflowV9MQCh)
+		close(netflowV9MCh)
+	} else {
+		logger.Printf("netflow v9 workers haven't been drained, udp queue: %d", len(netflowV9UDPCh))
+	}
+
+	// the mirror closes its replicator once the mirrored packets are sent
+	if !wait(ctx, &i.mirrorWG) {
+		logger.Println("netflow v9 mirror hasn't been drained")
+	}
 
 	// dump the templates to storage
 	if err := mCacheNF9.Dump(opts.NetflowV9TplCacheFile); err != nil {
 		logger.Println("couldn't not dump template", err)
 	}
 
-	// logging and close UDP channel
-	logger.Println("netflow v9 has been shutdown")
-	close(netflowV9UDPCh)
+	// flush and close the message queues
+	i.sinks.shutdown(ctx, "netflow v9")
+
+	logger.Printf("netflow v9 has been shutdown, dropped %d", atomic.LoadUint64(&i.stats.MQDropCount))
 }
 
 func (i *NetflowV9) netflowV9Worker(wQuit chan struct{}) {
 	var (
 		decodedMsg *netflow9.Message
+		mirror     NetflowV9UDPMsg
 		msg        = NetflowV9UDPMsg{body: netflowV9Buffer.Get().([]byte)}
 		buf        = new(bytes.Buffer)
 		err        error
@@ -204,6 +245,17 @@ LOOP:
 				msg.raddr, len(msg.body))
 		}
 
+		if netflowV9MirrorEnabled.Load() {
+			mirror.body = netflowV9Buffer.Get().([]byte)
+			mirror.raddr = msg.raddr
+			mirror.body = append(mirror.body[:0], msg.body...)
+
+			select {
+			case netflowV9MCh <- mirror:
+			default:
+			}
+		}
+
 		d := netflow9.NewDecoder(msg.raddr.IP, msg.body)
 		if decodedMsg, err = d.Decode(mCacheNF9); err != nil {
 			logger.Println(err)
@@ -214,6 +266,8 @@ LOOP:
 
 		atomic.AddUint64(&i.stats.DecodedCount, 1)
 
+		i.seq.Update(decodedMsg.AgentID, uint64(decodedMsg.Header.SrcID), decodedMsg.Header.SeqNum, 1)
+
 		if decodedMsg.DataSets != nil {
 			b, err = decodedMsg.JSONMarshal(buf)
 			if err != nil {
@@ -222,8 +276,13 @@ LOOP:
 			}
 
 			select {
-			case netflowV9MQCh <- append([]byte{}, b...):
+			case netflowV9MQCh <- producer.Message{
+				Value:    append([]byte{}, b...),
+				Exporter: decodedMsg.AgentID,
+				Domain:   uint64(decodedMsg.Header.SrcID),
+			}:
 			default:
+				atomic.AddUint64(&i.stats.MQDropCount, 1)
 			}
 		}
 
@@ -237,12 +296,14 @@ LOOP:
 
 func (i *NetflowV9) status() *NetflowV9Stats {
 	return &NetflowV9Stats{
-		UDPQueue:     len(netflowV9UDPCh),
-		MessageQueue: len(netflowV9MQCh),
-		UDPCount:     atomic.LoadUint64(&i.stats.UDPCount),
-		DecodedCount: atomic.LoadUint64(&i.stats.DecodedCount),
-		MQErrorCount: atomic.LoadUint64(&i.stats.MQErrorCount),
-		Workers:      atomic.LoadInt32(&i.stats.Workers),
+		UDPQueue:       len(netflowV9UDPCh),
+		UDPMirrorQueue: len(netflowV9MCh),
+		MessageQueue:   len(netflowV9MQCh),
+		UDPCount:       atomic.LoadUint64(&i.stats.UDPCount),
+		DecodedCount:   atomic.LoadUint64(&i.stats.DecodedCount),
+		MQErrorCount:   i.sinks.errors(),
+		MQDropCount:    atomic.LoadUint64(&i.stats.MQDropCount),
+		Workers:        atomic.LoadInt32(&i.stats.Workers),
 	}
 
 }
@@ -250,14 +311,24 @@ func (i *NetflowV9) status() *NetflowV9Stats {
 func (i *NetflowV9) dynWorkers() {
 	var load, nSeq, newWorkers, workers, n int
 
-	tick := time.Tick(120 * time.Second)
+	tick := time.NewTicker(120 * time.Second)
+	defer tick.Stop()
 
 	for {
-		<-tick
+		select {
+		case <-tick.C:
+		case <-i.quit:
+			return
+		}
+
 		load = 0
 
 		for n = 0; n < 30; n++ {
-			time.Sleep(1 * time.Second)
+			select {
+			case <-time.After(time.Second):
+			case <-i.quit:
+				return
+			}
 			load += len(netflowV9UDPCh)
 		}
 
@@ -281,7 +352,9 @@ func (i *NetflowV9) dynWorkers() {
 			}
 
 			for n = 0; n < newWorkers; n++ {
+				i.wg.Add(1)
 				go func() {
+					defer i.wg.Done()
 					atomic.AddInt32(&i.stats.Workers, 1)
 					wQuit := make(chan struct{})
 					i.pool <- wQuit
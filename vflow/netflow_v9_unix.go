@@ -0,0 +1,53 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    netflow_v9_unix.go
+//: details: netflow v9 UDP mirror
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+//go:build !windows
+// +build !windows
+
+package main
+
+import "github.com/EdgeCast/vflow/mirror"
+
+func mirrorNetflowV9Dispatcher(ch chan NetflowV9UDPMsg) {
+	r, err := newReplicator("netflow9", opts.NetflowV9MirrorAddr,
+		opts.NetflowV9MirrorPort, opts.NetflowV9MirrorWorkers)
+	if err != nil {
+		logger.Println("netflow v9 mirror:", err)
+		return
+	}
+
+	if r == nil {
+		return
+	}
+
+	netflowV9MirrorEnabled.Store(true)
+	logger.Printf("netflow v9 mirror service is running (destinations#: %d) ...", len(r.Stats()))
+
+	mirrorNetflowV9(r, ch)
+
+	// the mirror channel has been closed by the shutdown
+	r.Close()
+}
+
+func mirrorNetflowV9(r *mirror.Replicator, ch chan NetflowV9UDPMsg) {
+	for msg := range ch {
+		r.Replicate(msg.raddr, msg.body)
+		netflowV9Buffer.Put(msg.body[:opts.NetflowV9UDPSize])
+	}
+}
@@ -35,6 +35,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/EdgeCast/vflow/spool"
 	"gopkg.in/yaml.v2"
 )
 
@@ -69,10 +70,14 @@ type Options struct {
 	SFlowUDPSize       int            `yaml:"sflow-udp-size"`
 	SFlowWorkers       int            `yaml:"sflow-workers"`
 	SFlowTopic         string         `yaml:"sflow-topic"`
+	SFlowDiscardTopic  string         `yaml:"sflow-discard-topic"`
 	SFlowMirrorAddr    string         `yaml:"sflow-mirror-addr"`
 	SFlowMirrorPort    int            `yaml:"sflow-mirror-port"`
 	SFlowMirrorWorkers int            `yaml:"sflow-mirror-workers"`
 	SFlowTypeFilter    arrUInt32Flags `yaml:"sflow-type-filter"`
+	SFlowRecordsMap    bool           `yaml:"sflow-records-map"`
+	SFlowDecap         bool           `yaml:"sflow-decap"`
+	SFlowL7            bool           `yaml:"sflow-l7"`
 
 	// IPFIX options
 	IPFIXEnabled       bool   `yaml:"ipfix-enabled"`
@@ -88,26 +93,43 @@ type Options struct {
 	IPFIXTplCacheFile  string `yaml:"ipfix-tpl-cache-file"`
 
 	// Netflow V5
-	NetflowV5Enabled bool   `yaml:"netflow5-enabled"`
-	NetflowV5Port    int    `yaml:"netflow5-port"`
-	NetflowV5Addr    string `yaml:"netflow5-addr"`
-	NetflowV5UDPSize int    `yaml:"netflow5-udp-size"`
-	NetflowV5Workers int    `yaml:"netflow5-workers"`
-	NetflowV5Topic   string `yaml:"netflow5-topic"`
+	NetflowV5Enabled       bool   `yaml:"netflow5-enabled"`
+	NetflowV5Port          int    `yaml:"netflow5-port"`
+	NetflowV5Addr          string `yaml:"netflow5-addr"`
+	NetflowV5UDPSize       int    `yaml:"netflow5-udp-size"`
+	NetflowV5Workers       int    `yaml:"netflow5-workers"`
+	NetflowV5Topic         string `yaml:"netflow5-topic"`
+	NetflowV5MirrorAddr    string `yaml:"netflow5-mirror-addr"`
+	NetflowV5MirrorPort    int    `yaml:"netflow5-mirror-port"`
+	NetflowV5MirrorWorkers int    `yaml:"netflow5-mirror-workers"`
 
 	// Netflow
-	NetflowV9Enabled      bool   `yaml:"netflow9-enabled"`
-	NetflowV9Port         int    `yaml:"netflow9-port"`
-	NetflowV9Addr         string `yaml:"netflow9-addr"`
-	NetflowV9UDPSize      int    `yaml:"netflow9-udp-size"`
-	NetflowV9Workers      int    `yaml:"netflow9-workers"`
-	NetflowV9Topic        string `yaml:"netflow9-topic"`
-	NetflowV9TplCacheFile string `yaml:"netflow9-tpl-cache-file"`
+	NetflowV9Enabled       bool   `yaml:"netflow9-enabled"`
+	NetflowV9Port          int    `yaml:"netflow9-port"`
+	NetflowV9Addr          string `yaml:"netflow9-addr"`
+	NetflowV9UDPSize       int    `yaml:"netflow9-udp-size"`
+	NetflowV9Workers       int    `yaml:"netflow9-workers"`
+	NetflowV9Topic         string `yaml:"netflow9-topic"`
+	NetflowV9TplCacheFile  string `yaml:"netflow9-tpl-cache-file"`
+	NetflowV9MirrorAddr    string `yaml:"netflow9-mirror-addr"`
+	NetflowV9MirrorPort    int    `yaml:"netflow9-mirror-port"`
+	NetflowV9MirrorWorkers int    `yaml:"netflow9-mirror-workers"`
+
+	// mirror
+	MirrorConfigFile string `yaml:"mirror-config-file"`
 
 	// producer
 	ProducerEnabled bool   `yaml:"producer-enabled"`
 	MQName          string `yaml:"mq-name"`
 	MQConfigFile    string `yaml:"mq-config-file"`
+	Sinks           []Sink `yaml:"sinks"`
+
+	// spool
+	SpoolDir     string `yaml:"spool-dir"`
+	SpoolMaxSize int    `yaml:"spool-max-size"`
+	SpoolPolicy  string `yaml:"spool-policy"`
+
+	ShutdownTimeout int `yaml:"shutdown-timeout"`
 
 	VFlowConfigPath string
 }
@@ -155,10 +177,14 @@ func NewOptions() *Options {
 		SFlowUDPSize:       1500,
 		SFlowWorkers:       200,
 		SFlowTopic:         "vflow.sflow",
+		SFlowDiscardTopic:  "",
 		SFlowMirrorAddr:    "",
 		SFlowMirrorPort:    4171,
 		SFlowMirrorWorkers: 5,
 		SFlowTypeFilter:    []uint32{},
+		SFlowRecordsMap:    false,
+		SFlowDecap:         false,
+		SFlowL7:            false,
 
 		IPFIXEnabled:       true,
 		IPFIXRPCEnabled:    true,
@@ -171,23 +197,37 @@ func NewOptions() *Options {
 		IPFIXMirrorWorkers: 5,
 		IPFIXTplCacheFile:  "/tmp/vflow.templates",
 
-		NetflowV5Enabled: true,
-		NetflowV5Port:    9996,
-		NetflowV5UDPSize: 1500,
-		NetflowV5Workers: 200,
-		NetflowV5Topic:   "vflow.netflow5",
-
-		NetflowV9Enabled:      true,
-		NetflowV9Port:         4729,
-		NetflowV9UDPSize:      1500,
-		NetflowV9Workers:      200,
-		NetflowV9Topic:        "vflow.netflow9",
-		NetflowV9TplCacheFile: "/tmp/netflowv9.templates",
+		NetflowV5Enabled:       true,
+		NetflowV5Port:          9996,
+		NetflowV5UDPSize:       1500,
+		NetflowV5Workers:       200,
+		NetflowV5Topic:         "vflow.netflow5",
+		NetflowV5MirrorAddr:    "",
+		NetflowV5MirrorPort:    4173,
+		NetflowV5MirrorWorkers: 5,
+
+		NetflowV9Enabled:       true,
+		NetflowV9Port:          4729,
+		NetflowV9UDPSize:       1500,
+		NetflowV9Workers:       200,
+		NetflowV9Topic:         "vflow.netflow9",
+		NetflowV9TplCacheFile:  "/tmp/netflowv9.templates",
+		NetflowV9MirrorAddr:    "",
+		NetflowV9MirrorPort:    4174,
+		NetflowV9MirrorWorkers: 5,
+
+		MirrorConfigFile: "mirror.conf",
 
 		ProducerEnabled: true,
 		MQName:          "kafka",
 		MQConfigFile:    "mq.conf",
 
+		SpoolDir:     "",
+		SpoolMaxSize: 1024,
+		SpoolPolicy:  spool.PolicyDropOldest,
+
+		ShutdownTimeout: 30,
+
 		VFlowConfigPath: "/etc/vflow",
 	}
 }
@@ -328,7 +368,11 @@ func (opts *Options) flagSet() {
 	flag.IntVar(&opts.SFlowUDPSize, "sflow-max-udp-size", opts.SFlowUDPSize, "sflow maximum UDP size")
 	flag.IntVar(&opts.SFlowWorkers, "sflow-workers", opts.SFlowWorkers, "sflow workers number")
 	flag.StringVar(&opts.SFlowTopic, "sflow-topic", opts.SFlowTopic, "sflow topic name")
+	flag.StringVar(&opts.SFlowDiscardTopic, "sflow-discard-topic", opts.SFlowDiscardTopic, "sflow discarded packets topic name")
 	flag.Var(&opts.SFlowTypeFilter, "sflow-type-filter", "sflow type filter")
+	flag.BoolVar(&opts.SFlowRecordsMap, "sflow-records-map", opts.SFlowRecordsMap, "sflow records keyed by name (former output format)")
+	flag.BoolVar(&opts.SFlowDecap, "sflow-decap", opts.SFlowDecap, "sflow sampled header tunnels decapsulation")
+	flag.BoolVar(&opts.SFlowL7, "sflow-l7", opts.SFlowL7, "sflow sampled header DNS, TLS and HTTP decoding")
 	flag.StringVar(&opts.SFlowMirrorAddr, "sflow-mirror-addr", opts.SFlowMirrorAddr, "sflow mirror destination address")
 	flag.IntVar(&opts.SFlowMirrorPort, "sflow-mirror-port", opts.SFlowMirrorPort, "sflow mirror destination port number")
 	flag.IntVar(&opts.SFlowMirrorWorkers, "sflow-mirror-workers", opts.SFlowMirrorWorkers, "sflow mirror workers number")
@@ -353,6 +397,9 @@ func (opts *Options) flagSet() {
 	flag.IntVar(&opts.NetflowV5UDPSize, "netflow5-max-udp-size", opts.NetflowV5UDPSize, "Netflow version 5 maximum UDP size")
 	flag.IntVar(&opts.NetflowV5Workers, "netflow5-workers", opts.NetflowV5Workers, "Netflow version 5 workers number")
 	flag.StringVar(&opts.NetflowV5Topic, "netflow5-topic", opts.NetflowV5Topic, "Netflow version 5 topic name")
+	flag.StringVar(&opts.NetflowV5MirrorAddr, "netflow5-mirror-addr", opts.NetflowV5MirrorAddr, "Netflow version 5 mirror destination address")
+	flag.IntVar(&opts.NetflowV5MirrorPort, "netflow5-mirror-port", opts.NetflowV5MirrorPort, "Netflow version 5 mirror destination port number")
+	flag.IntVar(&opts.NetflowV5MirrorWorkers, "netflow5-mirror-workers", opts.NetflowV5MirrorWorkers, "Netflow version 5 mirror workers number")
 
 	// netflow version 9
 	flag.BoolVar(&opts.NetflowV9Enabled, "netflow9-enabled", opts.NetflowV9Enabled, "enable/disable netflow version 9 listener")
@@ -362,12 +409,25 @@ func (opts *Options) flagSet() {
 	flag.IntVar(&opts.NetflowV9Workers, "netflow9-workers", opts.NetflowV9Workers, "Netflow version 9 workers number")
 	flag.StringVar(&opts.NetflowV9Topic, "netflow9-topic", opts.NetflowV9Topic, "Netflow version 9 topic name")
 	flag.StringVar(&opts.NetflowV9TplCacheFile, "netflow9-tpl-cache-file", opts.NetflowV9TplCacheFile, "Netflow version 9 template cache file")
+	flag.StringVar(&opts.NetflowV9MirrorAddr, "netflow9-mirror-addr", opts.NetflowV9MirrorAddr, "Netflow version 9 mirror destination address")
+	flag.IntVar(&opts.NetflowV9MirrorPort, "netflow9-mirror-port", opts.NetflowV9MirrorPort, "Netflow version 9 mirror destination port number")
+	flag.IntVar(&opts.NetflowV9MirrorWorkers, "netflow9-mirror-workers", opts.NetflowV9MirrorWorkers, "Netflow version 9 mirror workers number")
+
+	// mirror options
+	flag.StringVar(&opts.MirrorConfigFile, "mirror-conf", opts.MirrorConfigFile, "mirror destinations configuration file")
 
 	// producer options
 	flag.BoolVar(&opts.ProducerEnabled, "producer-enabled", opts.ProducerEnabled, "enable/disable producer message queue")
 	flag.StringVar(&opts.MQName, "mqueue", opts.MQName, "producer message queue name")
 	flag.StringVar(&opts.MQConfigFile, "mqueue-conf", opts.MQConfigFile, "producer message queue configuration file")
 
+	// spool options
+	flag.StringVar(&opts.SpoolDir, "spool-dir", opts.SpoolDir, "message queue spillover directory, disabled if it's empty")
+	flag.IntVar(&opts.SpoolMaxSize, "spool-max-size", opts.SpoolMaxSize, "message queue spillover maximum size per sink topic in megabytes")
+	flag.StringVar(&opts.SpoolPolicy, "spool-policy", opts.SpoolPolicy, "message queue spillover overflow policy: drop-oldest or drop-newest")
+
+	flag.IntVar(&opts.ShutdownTimeout, "shutdown-timeout", opts.ShutdownTimeout, "graceful shutdown deadline in seconds to drain the queues and flush the message queues")
+
 	flag.Usage = func() {
 		flag.PrintDefaults()
 		fmt.Fprintf(os.Stderr, `
@@ -24,15 +24,18 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net"
-	"path"
 	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/EdgeCast/vflow/mirror"
+	"github.com/EdgeCast/vflow/packet"
 	"github.com/EdgeCast/vflow/producer"
+	"github.com/EdgeCast/vflow/sequence"
 	"github.com/EdgeCast/vflow/sflow"
 )
 
@@ -44,13 +47,29 @@ type SFUDPMsg struct {
 
 // SFlow represents sFlow collector
 type SFlow struct {
-	port    int
-	addr    string
-	workers int
-	stop    bool
-	stats   SFlowStats
-	conn    *net.UDPConn
-	pool    chan chan struct{}
+	port     int
+	addr     string
+	workers  int
+	stop     int32
+	stopped  chan struct{}
+	quit     chan struct{}
+	dynWG    sync.WaitGroup
+	wg       sync.WaitGroup
+	mirrorWG sync.WaitGroup
+	stats    SFlowStats
+	conn     *net.UDPConn
+	pool     chan chan struct{}
+
+	// datagrams sequence per agent and sub agent, and the flow,
+	// counter and discard samples sequence per agent and source id
+	seq        *sequence.Tracker
+	sampleSeq  *sequence.Tracker
+	counterSeq *sequence.Tracker
+	discardSeq *sequence.Tracker
+
+	// the sinks of the decoded and the discarded packets
+	sinks        *sinks
+	discardSinks *sinks
 }
 
 // SFlowStats represents sflow stats
@@ -60,13 +79,28 @@ type SFlowStats struct {
 	UDPCount     uint64
 	DecodedCount uint64
 	MQErrorCount uint64
+	MQDropCount  uint64
 	Workers      int32
+
+	DiscardMQDropCount uint64
+	EnterpriseErrors   uint64
+
+	Sequences        []sequence.Stats `json:",omitempty"`
+	SampleSequences  []sequence.Stats `json:",omitempty"`
+	CounterSequences []sequence.Stats `json:",omitempty"`
+	DiscardSequences []sequence.Stats `json:",omitempty"`
+	Mirror           []mirror.Stats   `json:",omitempty"`
+	Sinks            []SinkStats      `json:",omitempty"`
 }
 
 var (
 	sFlowUDPCh = make(chan SFUDPMsg, 1000)
 	sFlowMCh   = make(chan SFUDPMsg, 1000)
-	sFlowMQCh  = make(chan []byte, 1000)
+	sFlowMQCh  = make(chan producer.Message, 1000)
+
+	// discarded packets are routed to this channel
+	// if the sflow discard topic has been set
+	sFlowDiscardMQCh = make(chan producer.Message, 1000)
 
 	sFlowMirrorEnabled bool
 
@@ -80,11 +114,24 @@ var (
 
 // NewSFlow constructs sFlow collector
 func NewSFlow() *SFlow {
-	return &SFlow{
-		port:    opts.SFlowPort,
-		addr:    opts.SFlowAddr,
-		workers: opts.SFlowWorkers,
+	s := &SFlow{
+		stopped:    make(chan struct{}),
+		quit:       make(chan struct{}),
+		port:       opts.SFlowPort,
+		addr:       opts.SFlowAddr,
+		workers:    opts.SFlowWorkers,
+		seq:        sequence.NewTracker(1 << 16),
+		sampleSeq:  sequence.NewTracker(1 << 16),
+		counterSeq: sequence.NewTracker(1 << 16),
+		discardSeq: sequence.NewTracker(1 << 16),
+		sinks:      newSinks("sflow", opts.SFlowTopic),
+	}
+
+	if opts.SFlowDiscardTopic != "" {
+		s.discardSinks = newSinks("sflow", opts.SFlowDiscardTopic)
 	}
+
+	return s
 }
 
 func (s *SFlow) run() {
@@ -97,6 +144,11 @@ func (s *SFlow) run() {
 
 	s.pool = make(chan chan struct{}, maxWorkers)
 
+	sflow.SetPacketOptions(packet.Options{
+		Decap: opts.SFlowDecap,
+		L7:    opts.SFlowL7,
+	})
+
 	hostPort := net.JoinHostPort(s.addr, strconv.Itoa(s.port))
 	udpAddr, _ := net.ResolveUDPAddr("udp", hostPort)
 
@@ -107,35 +159,30 @@ func (s *SFlow) run() {
 
 	atomic.AddInt32(&s.stats.Workers, int32(s.workers))
 	for i := 0; i < s.workers; i++ {
+		s.wg.Add(1)
 		go func() {
+			defer s.wg.Done()
 			wQuit := make(chan struct{})
 			s.pool <- wQuit
 			s.sFlowWorker(wQuit)
 		}()
 	}
 
-	go mirrorSFlowDispatcher(sFlowMCh)
-
-	logger.Printf("sFlow is running (UDP: listening on [::]:%d workers#: %d)", s.port, s.workers)
-
+	s.mirrorWG.Add(1)
 	go func() {
-		if !opts.ProducerEnabled {
-			return
-		}
+		defer s.mirrorWG.Done()
+		mirrorSFlowDispatcher(sFlowMCh)
+	}()
 
-		p := producer.NewProducer(opts.MQName)
-		p.MQConfigFile = path.Join(opts.VFlowConfigPath, opts.MQConfigFile)
-		p.MQErrorCount = &s.stats.MQErrorCount
-		p.Logger = logger
-		p.Chan = sFlowMQCh
-		p.Topic = opts.SFlowTopic
+	logger.Printf("sFlow is running (UDP: listening on [::]:%d workers#: %d)", s.port, s.workers)
 
-		if err := p.Run(); err != nil {
-			logger.Fatal(err)
-		}
-	}()
+	s.sinks.start(sFlowMQCh)
+	s.discardSinks.start(sFlowDiscardMQCh)
 
+	s.dynWG.Add(1)
 	go func() {
+		defer s.dynWG.Done()
+
 		if !opts.DynWorkers {
 			logger.Println("sFlow dynamic worker disabled")
 			return
@@ -144,7 +191,7 @@ func (s *SFlow) run() {
 		s.dynWorkers()
 	}()
 
-	for !s.stop {
+	for atomic.LoadInt32(&s.stop) == 0 {
 		b := sFlowBuffer.Get().([]byte)
 		s.conn.SetReadDeadline(time.Now().Add(1e9))
 		n, raddr, err := s.conn.ReadFromUDP(b)
@@ -155,26 +202,54 @@ func (s *SFlow) run() {
 		atomic.AddUint64(&s.stats.UDPCount, 1)
 		sFlowUDPCh <- SFUDPMsg{raddr, b[:n]}
 	}
+
+	s.conn.Close()
+	close(s.stopped)
 }
 
-func (s *SFlow) shutdown() {
+func (s *SFlow) shutdown(ctx context.Context) {
 	// exit if the sFlow v5 is disabled
 	if !opts.SFlowEnabled {
 		return
 	}
 
 	// stop reading from UDP listener
-	s.stop = true
+	atomic.StoreInt32(&s.stop, 1)
 	logger.Println("stopping sflow service gracefully ...")
-	time.Sleep(1 * time.Second)
-	s.conn.Close()
-	logger.Println("sFlow has been shutdown")
+	s.sinks.mark()
+	s.discardSinks.mark()
+	<-s.stopped
+
+	// the dynamic workers stop before waiting for the workers
+	close(s.quit)
+	s.dynWG.Wait()
+
+	// drain the UDP queue, the message queue channels are
+	// closed once the workers don't send any message
 	close(sFlowUDPCh)
+	if wait(ctx, &s.wg) {
+		close(sFlowMQCh)
+		close(sFlowDiscardMQCh)
+		close(sFlowMCh)
+	} else {
+		logger.Printf("sflow workers haven't been drained, udp queue: %d", len(sFlowUDPCh))
+	}
+
+	// the mirror closes its replicator once the mirrored packets are sent
+	if !wait(ctx, &s.mirrorWG) {
+		logger.Println("sflow mirror hasn't been drained")
+	}
+
+	// flush and close the message queues
+	s.sinks.shutdown(ctx, "sflow")
+	s.discardSinks.shutdown(ctx, "sflow discard")
+
+	logger.Printf("sFlow has been shutdown, dropped %d", atomic.LoadUint64(&s.stats.MQDropCount))
 }
 
 func (s *SFlow) sFlowWorker(wQuit chan struct{}) {
 	var (
-		reader *bytes.Reader
+		buf    = new(bytes.Buffer)
 		msg    SFUDPMsg
 		mirror SFUDPMsg
 		ok     bool
@@ -209,15 +284,37 @@ LOOP:
 			}
 		}
 
-		reader = bytes.NewReader(msg.body)
-		d := sflow.NewSFDecoder(reader, opts.SFlowTypeFilter)
+		d := sflow.NewSFDecoder(msg.body, opts.SFlowTypeFilter)
 		datagram, err := d.SFDecode()
-		if err != nil || (len(datagram.Counters) < 1 && len(datagram.Samples) < 1) {
+		if err != nil || (len(datagram.Counters) < 1 && len(datagram.Samples) < 1 &&
+			len(datagram.Discards) < 1) {
+			datagram.Release()
 			sFlowBuffer.Put(msg.body[:opts.SFlowUDPSize])
 			continue
 		}
 
-		b, err = json.Marshal(datagram)
+		// the messages are keyed by the datagram sequence domain
+		m := producer.Message{
+			Exporter: datagram.IPAddress.String(),
+			Domain:   uint64(datagram.AgentSubID),
+		}
+
+		s.trackSequences(datagram, m.Exporter)
+
+		if opts.SFlowDiscardTopic != "" && len(datagram.Discards) > 0 {
+			s.routeDiscards(datagram, m, buf)
+
+			if len(datagram.Counters) < 1 && len(datagram.Samples) < 1 {
+				datagram.Release()
+				sFlowBuffer.Put(msg.body[:opts.SFlowUDPSize])
+				continue
+			}
+		}
+
+		// the datagram refers to the udp payload so it
+		// should be released before the payload
+		b, err = sFlowMarshal(datagram, buf)
+		datagram.Release()
 		if err != nil {
 			sFlowBuffer.Put(msg.body[:opts.SFlowUDPSize])
 			logger.Println(err)
@@ -230,9 +327,12 @@ LOOP:
 			logger.Println(string(b))
 		}
 
+		m.Value = append([]byte{}, b...)
+
 		select {
-		case sFlowMQCh <- append([]byte{}, b...):
+		case sFlowMQCh <- m:
 		default:
+			atomic.AddUint64(&s.stats.MQDropCount, 1)
 		}
 
 		sFlowBuffer.Put(msg.body[:opts.SFlowUDPSize])
@@ -245,22 +345,36 @@ func (s *SFlow) status() *SFlowStats {
 		MessageQueue: len(sFlowMQCh),
 		UDPCount:     atomic.LoadUint64(&s.stats.UDPCount),
 		DecodedCount: atomic.LoadUint64(&s.stats.DecodedCount),
-		MQErrorCount: atomic.LoadUint64(&s.stats.MQErrorCount),
+		MQErrorCount: s.sinks.errors() + s.discardSinks.errors(),
+		MQDropCount:  atomic.LoadUint64(&s.stats.MQDropCount),
 		Workers:      atomic.LoadInt32(&s.stats.Workers),
+
+		DiscardMQDropCount: atomic.LoadUint64(&s.stats.DiscardMQDropCount),
+		EnterpriseErrors:   sflow.EnterpriseErrors(),
 	}
 }
 
 func (s *SFlow) dynWorkers() {
 	var load, nSeq, newWorkers, workers, n int
 
-	tick := time.Tick(120 * time.Second)
+	tick := time.NewTicker(120 * time.Second)
+	defer tick.Stop()
 
 	for {
-		<-tick
+		select {
+		case <-tick.C:
+		case <-s.quit:
+			return
+		}
+
 		load = 0
 
 		for n = 0; n < 30; n++ {
-			time.Sleep(1 * time.Second)
+			select {
+			case <-time.After(time.Second):
+			case <-s.quit:
+				return
+			}
 			load += len(sFlowUDPCh)
 		}
 
@@ -284,7 +398,9 @@ func (s *SFlow) dynWorkers() {
 			}
 
 			for n = 0; n < newWorkers; n++ {
+				s.wg.Add(1)
 				go func() {
+					defer s.wg.Done()
 					atomic.AddInt32(&s.stats.Workers, 1)
 					wQuit := make(chan struct{})
 					s.pool <- wQuit
@@ -314,3 +430,79 @@ func (s *SFlow) dynWorkers() {
 		}
 	}
 }
+
+// trackSequences tracks the datagram and the flow, counter and discard
+// samples sequence numbers, each sample type has its own sequence per
+// source id, the samples of the registered decoders aren't tracked.
+func (s *SFlow) trackSequences(datagram *sflow.SFDatagram, agent string) {
+	s.seq.Update(agent, uint64(datagram.AgentSubID), datagram.SequenceNo, 1)
+
+	for _, sample := range datagram.Samples {
+		fs, ok := sample.(*sflow.FlowSample)
+		if !ok {
+			continue
+		}
+
+		sourceID := sFlowSourceID(fs.SourceID, fs.SourceIDIdx)
+		s.sampleSeq.Update(agent, sourceID, fs.SequenceNo, 1)
+		s.sampleSeq.SetDrops(agent, sourceID, fs.Drops)
+	}
+
+	for _, counter := range datagram.Counters {
+		cs, ok := counter.(*sflow.CounterSample)
+		if !ok {
+			continue
+		}
+
+		s.counterSeq.Update(agent, sFlowSourceID(cs.SourceIDType, cs.SourceIDIdx), cs.SequenceNo, 1)
+	}
+
+	for _, ds := range datagram.Discards {
+		sourceID := sFlowSourceID(ds.SourceIDType, ds.SourceIDIdx)
+		s.discardSeq.Update(agent, sourceID, ds.SequenceNo, 1)
+		s.discardSeq.SetDrops(agent, sourceID, ds.Drops)
+	}
+}
+
+// sFlowSourceID returns the source id type and index as a domain, the
+// index is 24 bits in the compact samples and 32 bits in the expanded
+func sFlowSourceID(sourceType, index uint32) uint64 {
+	return uint64(sourceType)<<32 | uint64(index)
+}
+
+// routeDiscards sends the discarded packet samples as a separate
+// datagram to the sflow discard topic
+func (s *SFlow) routeDiscards(datagram *sflow.SFDatagram, m producer.Message, buf *bytes.Buffer) {
+	discards := *datagram
+	discards.Samples = []sflow.Sample{}
+	discards.Counters = []sflow.Counter{}
+
+	b, err := sFlowMarshal(&discards, buf)
+	datagram.ReleaseDiscards()
+	if err != nil {
+		logger.Println(err)
+		return
+	}
+
+	if opts.Verbose {
+		logger.Println(string(b))
+	}
+
+	m.Value = append([]byte{}, b...)
+
+	select {
+	case sFlowDiscardMQCh <- m:
+	default:
+		atomic.AddUint64(&s.stats.DiscardMQDropCount, 1)
+	}
+}
+
+func sFlowMarshal(datagram *sflow.SFDatagram, buf *bytes.Buffer) ([]byte, error) {
+	if opts.SFlowRecordsMap {
+		return json.Marshal(datagram.RecordsMap())
+	}
+
+	buf.Reset()
+
+	return datagram.JSONMarshal(buf)
+}
@@ -0,0 +1,78 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    sflow_test.go
+//: details: TODO
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package main
+
+import (
+	"net"
+	"testing"
+
+	"github.com/EdgeCast/vflow/sequence"
+	"github.com/EdgeCast/vflow/sflow"
+)
+
+func TestSFlowTrackSequences(t *testing.T) {
+	s := &SFlow{
+		seq:        sequence.NewTracker(1 << 16),
+		sampleSeq:  sequence.NewTracker(1 << 16),
+		counterSeq: sequence.NewTracker(1 << 16),
+		discardSeq: sequence.NewTracker(1 << 16),
+	}
+
+	for i := uint32(0); i < 3; i++ {
+		s.trackSequences(&sflow.SFDatagram{
+			IPAddress:  net.ParseIP("192.0.2.1"),
+			SequenceNo: i + 1,
+			// the expanded samples index would collide
+			// with the type if it's packed in 32 bits
+			Samples: []sflow.Sample{
+				&sflow.FlowSample{SequenceNo: 10 + i, SourceIDIdx: 1<<24 | 1},
+				&sflow.FlowSample{SequenceNo: 20 + i, SourceID: 1, SourceIDIdx: 1},
+			},
+			Counters: []sflow.Counter{
+				&sflow.CounterSample{SequenceNo: 30 + i, SourceIDIdx: 1},
+			},
+			Discards: []*sflow.DiscardSample{
+				{SequenceNo: 40 + i, SourceIDIdx: 1, Drops: 5},
+			},
+		}, "192.0.2.1")
+	}
+
+	samples := s.sampleSeq.Stats()
+	if len(samples) != 2 {
+		t.Fatalf("expect 2 flow sample sources, got %d", len(samples))
+	}
+
+	for _, st := range samples {
+		if st.Received != 3 || st.Gaps != 0 || st.Resets != 0 {
+			t.Errorf("flow sample source %d: unexpected stats %+v", st.Domain, st)
+		}
+	}
+
+	counters := s.counterSeq.Stats()
+	if len(counters) != 1 || counters[0].Received != 3 || counters[0].Gaps != 0 {
+		t.Errorf("unexpected counter sample stats %+v", counters)
+	}
+
+	discards := s.discardSeq.Stats()
+	if len(discards) != 1 || discards[0].Received != 3 || discards[0].Drops != 5 {
+		t.Errorf("unexpected discard sample stats %+v", discards)
+	}
+}
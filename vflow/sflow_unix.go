@@ -22,101 +22,32 @@
 
 package main
 
-import (
-	"net"
-
-	"github.com/EdgeCast/vflow/mirror"
-)
+import "github.com/EdgeCast/vflow/mirror"
 
 func mirrorSFlowDispatcher(ch chan SFUDPMsg) {
-	var (
-		ch4 = make(chan SFUDPMsg, 1000)
-		ch6 = make(chan SFUDPMsg, 1000)
-		msg SFUDPMsg
-	)
-
-	if opts.SFlowMirrorAddr == "" {
+	r, err := newReplicator("sflow", opts.SFlowMirrorAddr,
+		opts.SFlowMirrorPort, opts.SFlowMirrorWorkers)
+	if err != nil {
+		logger.Println("sflow mirror:", err)
 		return
 	}
 
-	for w := 0; w < opts.SFlowMirrorWorkers; w++ {
-		dst := net.ParseIP(opts.SFlowMirrorAddr)
-
-		if dst.To4() != nil {
-			go mirrorSFlow(dst, opts.SFlowMirrorPort, ch4)
-		} else {
-			go mirrorSFlow(dst, opts.SFlowMirrorPort, ch6)
-		}
+	if r == nil {
+		return
 	}
 
 	sFlowMirrorEnabled = true
-	logger.Printf("sflow mirror service is running (workers#: %d) ...", opts.SFlowMirrorWorkers)
+	logger.Printf("sflow mirror service is running (destinations#: %d) ...", len(r.Stats()))
 
-	for {
-		msg = <-ch
-		if msg.raddr.IP.To4() != nil {
-			ch4 <- msg
-		} else {
-			ch6 <- msg
-		}
-	}
-}
-
-func mirrorSFlow(dst net.IP, port int, ch chan SFUDPMsg) error {
-	var (
-		packet = make([]byte, opts.SFlowUDPSize)
-		msg    SFUDPMsg
-		pLen   int
-		err    error
-		ipHdr  []byte
-		ipHLen int
-		ipv4   bool
-		ip     mirror.IP
-	)
-
-	conn, err := mirror.NewRawConn(dst)
-	if err != nil {
-		return err
-	}
+	mirrorSFlow(r, ch)
 
-	udp := mirror.UDP{SrcPort: 55118, DstPort: port, Length: 0, Checksum: 0}
-	udpHdr := udp.Marshal()
-
-	if dst.To4() != nil {
-		ipv4 = true
-	}
-
-	if ipv4 {
-		ip = mirror.NewIPv4HeaderTpl(mirror.UDPProto)
-		ipHdr = ip.Marshal()
-		ipHLen = mirror.IPv4HLen
-	} else {
-		ip = mirror.NewIPv6HeaderTpl(mirror.UDPProto)
-		ipHdr = ip.Marshal()
-		ipHLen = mirror.IPv6HLen
-	}
-
-	for {
-		msg = <-ch
-		pLen = len(msg.body)
-
-		ip.SetAddrs(ipHdr, msg.raddr.IP, dst)
-		ip.SetLen(ipHdr, pLen+mirror.UDPHLen)
-
-		udp.SetLen(udpHdr, pLen)
-		// IPv6 checksum mandatory
-		if !ipv4 {
-			udp.SetChecksum()
-		}
-
-		copy(packet[0:ipHLen], ipHdr)
-		copy(packet[ipHLen:ipHLen+8], udpHdr)
-		copy(packet[ipHLen+8:], msg.body)
+	// the mirror channel has been closed by the shutdown
+	r.Close()
+}
 
+func mirrorSFlow(r *mirror.Replicator, ch chan SFUDPMsg) {
+	for msg := range ch {
+		r.Replicate(msg.raddr, msg.body)
 		sFlowBuffer.Put(msg.body[:opts.SFlowUDPSize])
-
-		if err = conn.Send(packet[0 : ipHLen+8+pLen]); err != nil {
-			return err
-		}
 	}
 }
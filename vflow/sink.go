@@ -0,0 +1,603 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    sink.go
+//: details: message queue sinks
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"path"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/EdgeCast/vflow/producer"
+	"github.com/EdgeCast/vflow/spool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Sink represents a message queue which the decoded messages of the sink
+// protocols are produced to, all the protocols are produced if the
+// protocols list is empty
+type Sink struct {
+	Name         string   `yaml:"name"`
+	MQName       string   `yaml:"mq-name"`
+	MQConfigFile string   `yaml:"mq-config-file"`
+	Protocols    []string `yaml:"protocols"`
+	QueueSize    int      `yaml:"queue-size"`
+}
+
+// SinkStats represents a sink stats for a protocol topic
+type SinkStats struct {
+	Name    string
+	MQName  string
+	Topic   string
+	Queue   int
+	Errors  uint64
+	Dropped uint64
+	Spool   *spool.Stats `json:",omitempty"`
+}
+
+// sinkProducer produces a protocol messages to a sink, the messages
+// spill over to the spool if it's enabled and the sink queue is full
+type sinkProducer struct {
+	sink    Sink
+	topic   string
+	ch      chan producer.Message
+	errors  uint64
+	dropped uint64
+	queued  uint64
+
+	// the counters at the beginning of the shutdown
+	markQueued  uint64
+	markDropped uint64
+	markErrors  uint64
+
+	spool     *spool.Queue
+	notify    chan struct{}
+	done      chan struct{}
+	replaying int32
+}
+
+// sinks fans out a protocol messages to the protocol sinks, each sink
+// has its own queue so a slow sink doesn't block the others
+type sinks struct {
+	proto     string
+	producers []*sinkProducer
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+var sinkProtocols = []string{"ipfix", "sflow", "netflow5", "netflow9"}
+
+var errSpoolMessage = errors.New("invalid spooled message")
+
+// getSinks returns the configured sinks or the default sink
+// which is configured by the mq-name and mq-config-file options
+func (opts *Options) getSinks() []Sink {
+	if len(opts.Sinks) == 0 {
+		return []Sink{{
+			Name:         "default",
+			MQName:       opts.MQName,
+			MQConfigFile: opts.MQConfigFile,
+			QueueSize:    1000,
+		}}
+	}
+
+	sinks := make([]Sink, 0, len(opts.Sinks))
+	for _, sink := range opts.Sinks {
+		if sink.MQName == "" {
+			opts.Logger.Fatalf("sink %s: mq-name is required", sink.Name)
+		}
+
+		if sink.Name == "" {
+			sink.Name = sink.MQName
+		}
+
+		if sink.MQConfigFile == "" {
+			sink.MQConfigFile = opts.MQConfigFile
+		}
+
+		if sink.QueueSize < 1 {
+			sink.QueueSize = 1000
+		}
+
+		for _, proto := range sink.Protocols {
+			if !sinkProtocol(proto) {
+				opts.Logger.Fatalf("sink %s: unknown protocol %s", sink.Name, proto)
+			}
+		}
+
+		sinks = append(sinks, sink)
+	}
+
+	return sinks
+}
+
+// newSinks constructs the protocol sinks for the topic,
+// the producers don't start until the sinks start
+func newSinks(proto, topic string) *sinks {
+	s := &sinks{proto: proto}
+
+	if !opts.ProducerEnabled || !opts.enabled(proto) {
+		return s
+	}
+
+	for _, sink := range opts.getSinks() {
+		if !sink.has(proto) {
+			continue
+		}
+
+		sp := &sinkProducer{
+			sink:  sink,
+			topic: topic,
+			ch:    make(chan producer.Message, sink.QueueSize),
+		}
+
+		if opts.SpoolDir != "" {
+			sp.openSpool()
+		}
+
+		s.producers = append(s.producers, sp)
+	}
+
+	return s
+}
+
+// openSpool opens the sink topic spool, the unread
+// messages of the previous run are replayed first
+func (sp *sinkProducer) openSpool() {
+	var err error
+
+	sp.spool, err = spool.Open(spool.Config{
+		Dir:     path.Join(opts.SpoolDir, sp.sink.Name, sp.topic),
+		MaxSize: int64(opts.SpoolMaxSize) << 20,
+		Policy:  opts.SpoolPolicy,
+	})
+	if err != nil {
+		opts.Logger.Fatalf("sink %s: spool: %v", sp.sink.Name, err)
+	}
+
+	sp.notify = make(chan struct{}, 1)
+	sp.done = make(chan struct{})
+}
+
+// start runs the sinks producers and fans out the channel messages
+func (s *sinks) start(ch chan producer.Message) {
+	if s == nil || len(s.producers) == 0 {
+		return
+	}
+
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+
+	for _, sp := range s.producers {
+		p, err := producer.NewProducer(sp.sink.MQName)
+		if err != nil {
+			logger.Fatalf("sink %s: %v", sp.sink.Name, err)
+		}
+
+		p.MQConfigFile = configFile(sp.sink.MQConfigFile)
+		p.MQErrorCount = &sp.errors
+		p.Logger = logger
+		p.Chan = sp.ch
+		p.Topic = sp.topic
+		p.Info = producer.Info{Protocol: s.proto, Version: version}
+
+		if sp.spool != nil {
+			s.wg.Add(1)
+			go func(sp *sinkProducer) {
+				defer s.wg.Done()
+				sp.replay(s.ctx)
+			}(sp)
+		}
+
+		s.wg.Add(1)
+		go func(name string) {
+			defer s.wg.Done()
+
+			// the producer is canceled if it can't flush before the shutdown deadline
+			err := p.Run(s.ctx)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				logger.Fatalf("sink %s: %v", name, err)
+			}
+		}(sp.sink.Name)
+	}
+
+	go s.fanOut(ch)
+}
+
+// fanOut sends the messages to the sinks queues, the message is
+// dropped for a sink if its queue is full and it doesn't have spool
+func (s *sinks) fanOut(ch chan producer.Message) {
+	for msg := range ch {
+		for _, sp := range s.producers {
+			sp.put(msg)
+		}
+	}
+
+	for _, sp := range s.producers {
+		if sp.spool != nil {
+			close(sp.done)
+		} else {
+			close(sp.ch)
+		}
+	}
+}
+
+// put sends the message to the sink queue, the message is spooled
+// if the queue is full or the spooled messages haven't been replayed
+// yet so the messages are produced in order
+func (sp *sinkProducer) put(msg producer.Message) {
+	if sp.spool == nil {
+		select {
+		case sp.ch <- msg:
+			atomic.AddUint64(&sp.queued, 1)
+		default:
+			atomic.AddUint64(&sp.dropped, 1)
+		}
+		return
+	}
+
+	if sp.spool.Len() == 0 && atomic.LoadInt32(&sp.replaying) == 0 {
+		select {
+		case sp.ch <- msg:
+			atomic.AddUint64(&sp.queued, 1)
+			return
+		default:
+		}
+	}
+
+	// the overflow policy drops are counted by the spool
+	err := sp.spool.Put(encodeSpool(msg))
+	if err != nil && err != spool.ErrFull {
+		logger.Printf("sink %s: spool: %v", sp.sink.Name, err)
+		atomic.AddUint64(&sp.dropped, 1)
+		return
+	}
+
+	select {
+	case sp.notify <- struct{}{}:
+	default:
+	}
+}
+
+// replay sends the spooled messages to the sink queue in order, it
+// blocks while the sink queue is full, e.g. the message queue is down.
+// It stops once the fan out is done and the rest stay in the spool
+// for the next run.
+func (sp *sinkProducer) replay(ctx context.Context) {
+	defer func() {
+		if err := sp.spool.Close(); err != nil {
+			logger.Printf("sink %s: spool: %v", sp.sink.Name, err)
+		}
+	}()
+
+	for {
+		select {
+		case <-sp.done:
+			close(sp.ch)
+			return
+		default:
+		}
+
+		// the replaying flag is set before the spool is read so the
+		// fan out doesn't send a newer message while one is in flight
+		atomic.StoreInt32(&sp.replaying, 1)
+
+		b, err := sp.spool.Get()
+		if err == nil {
+			msg, err := decodeSpool(b)
+			if err != nil {
+				logger.Printf("sink %s: spool: %v", sp.sink.Name, err)
+				atomic.AddUint64(&sp.dropped, 1)
+				continue
+			}
+
+			select {
+			case sp.ch <- msg:
+				atomic.AddUint64(&sp.queued, 1)
+			case <-ctx.Done():
+				atomic.AddUint64(&sp.dropped, 1)
+				return
+			}
+			continue
+		}
+
+		atomic.StoreInt32(&sp.replaying, 0)
+
+		if err != spool.ErrEmpty {
+			logger.Printf("sink %s: spool: %v", sp.sink.Name, err)
+		}
+
+		select {
+		case <-sp.notify:
+		case <-sp.done:
+			close(sp.ch)
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// encodeSpool encodes the message for the spool, the exporter
+// length and the exporter, the domain and then the value
+func encodeSpool(msg producer.Message) []byte {
+	exporter := msg.Exporter
+	if len(exporter) > 0xff {
+		exporter = exporter[:0xff]
+	}
+
+	b := make([]byte, 0, 9+len(exporter)+len(msg.Value))
+	b = append(b, byte(len(exporter)))
+	b = append(b, exporter...)
+	b = binary.BigEndian.AppendUint64(b, msg.Domain)
+
+	return append(b, msg.Value...)
+}
+
+// decodeSpool decodes the spooled message, the value refers to b
+func decodeSpool(b []byte) (producer.Message, error) {
+	if len(b) < 1 || len(b) < 9+int(b[0]) {
+		return producer.Message{}, errSpoolMessage
+	}
+
+	n := 1 + int(b[0])
+
+	return producer.Message{
+		Exporter: string(b[1:n]),
+		Domain:   binary.BigEndian.Uint64(b[n : n+8]),
+		Value:    b[n+8:],
+	}, nil
+}
+
+// mark keeps the sinks counters at the beginning of the shutdown
+func (s *sinks) mark() {
+	if s == nil {
+		return
+	}
+
+	for _, sp := range s.producers {
+		atomic.StoreUint64(&sp.markQueued, atomic.LoadUint64(&sp.queued)-uint64(len(sp.ch)))
+		atomic.StoreUint64(&sp.markDropped, atomic.LoadUint64(&sp.dropped))
+		atomic.StoreUint64(&sp.markErrors, atomic.LoadUint64(&sp.errors))
+	}
+}
+
+// shutdown waits for the producers to flush the sink queues and close
+// the message queues until the context is done, then the producers are
+// canceled and the queued messages are dropped. It logs the number of the
+// flushed and dropped messages since the mark and the spooled messages, the
+// messages which the producers failed since the mark are counted as dropped.
+func (s *sinks) shutdown(ctx context.Context, name string) {
+	if s == nil || s.cancel == nil {
+		return
+	}
+
+	if !wait(ctx, &s.wg) {
+		logger.Printf("%s sinks haven't been flushed before the deadline", name)
+	}
+
+	s.cancel()
+
+	// the canceled producers count their pending messages as failed
+	cctx, ccancel := context.WithTimeout(context.Background(), time.Second)
+	wait(cctx, &s.wg)
+	ccancel()
+
+	for _, sp := range s.producers {
+		var (
+			pending = uint64(len(sp.ch))
+			flushed = atomic.LoadUint64(&sp.queued) - pending - atomic.LoadUint64(&sp.markQueued)
+			dropped = atomic.LoadUint64(&sp.dropped) - atomic.LoadUint64(&sp.markDropped) + pending
+			failed  = atomic.LoadUint64(&sp.errors) - atomic.LoadUint64(&sp.markErrors)
+			spooled uint64
+		)
+
+		if failed > flushed {
+			failed = flushed
+		}
+		flushed -= failed
+		dropped += failed
+
+		if sp.spool != nil {
+			spooled = sp.spool.Stats().Depth
+		}
+
+		logger.Printf("%s sink %s (%s): flushed %d, dropped %d, spooled %d",
+			name, sp.sink.Name, sp.topic, flushed, dropped, spooled)
+	}
+}
+
+func (s *sinks) stats() []SinkStats {
+	if s == nil {
+		return nil
+	}
+
+	stats := make([]SinkStats, 0, len(s.producers))
+	for _, sp := range s.producers {
+		st := SinkStats{
+			Name:    sp.sink.Name,
+			MQName:  sp.sink.MQName,
+			Topic:   sp.topic,
+			Queue:   len(sp.ch),
+			Errors:  atomic.LoadUint64(&sp.errors),
+			Dropped: atomic.LoadUint64(&sp.dropped),
+		}
+
+		if sp.spool != nil {
+			spoolStats := sp.spool.Stats()
+			st.Spool = &spoolStats
+		}
+
+		stats = append(stats, st)
+	}
+
+	return stats
+}
+
+// errors returns the total errors of the sinks
+func (s *sinks) errors() uint64 {
+	var n uint64
+
+	if s == nil {
+		return 0
+	}
+
+	for _, sp := range s.producers {
+		n += atomic.LoadUint64(&sp.errors)
+	}
+
+	return n
+}
+
+// sinkCollector exposes the sinks stats per protocol and sink
+type sinkCollector struct {
+	sinks   map[string][]*sinks
+	queue   *prometheus.Desc
+	errors  *prometheus.Desc
+	dropped *prometheus.Desc
+
+	spoolDepth   *prometheus.Desc
+	spoolBytes   *prometheus.Desc
+	spoolDropped *prometheus.Desc
+}
+
+func newSinkCollector(protos []proto) *sinkCollector {
+	labels := []string{"protocol", "sink", "topic"}
+	c := &sinkCollector{
+		sinks: make(map[string][]*sinks),
+		queue: prometheus.NewDesc("vflow_sink_queue",
+			"number of messages in the sink queue", labels, nil),
+		errors: prometheus.NewDesc("vflow_sink_errors",
+			"number of messages which the sink couldn't produce", labels, nil),
+		dropped: prometheus.NewDesc("vflow_sink_dropped",
+			"number of messages which were dropped as the sink queue was full", labels, nil),
+		spoolDepth: prometheus.NewDesc("vflow_sink_spool_depth",
+			"number of messages in the sink spool", labels, nil),
+		spoolBytes: prometheus.NewDesc("vflow_sink_spool_bytes",
+			"size of the sink spool segments on disk", labels, nil),
+		spoolDropped: prometheus.NewDesc("vflow_sink_spool_dropped",
+			"number of messages which were dropped by the spool overflow policy",
+			append(labels, "policy"), nil),
+	}
+
+	for _, p := range protos {
+		switch flow := p.(type) {
+		case *IPFIX:
+			c.sinks["ipfix"] = []*sinks{flow.sinks}
+		case *SFlow:
+			c.sinks["sflow"] = []*sinks{flow.sinks, flow.discardSinks}
+		case *NetflowV5:
+			c.sinks["netflow5"] = []*sinks{flow.sinks}
+		case *NetflowV9:
+			c.sinks["netflow9"] = []*sinks{flow.sinks}
+		}
+	}
+
+	return c
+}
+
+func (c *sinkCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.queue
+	ch <- c.errors
+	ch <- c.dropped
+	ch <- c.spoolDepth
+	ch <- c.spoolBytes
+	ch <- c.spoolDropped
+}
+
+func (c *sinkCollector) Collect(ch chan<- prometheus.Metric) {
+	for proto, ss := range c.sinks {
+		for _, s := range ss {
+			for _, st := range s.stats() {
+				ch <- prometheus.MustNewConstMetric(c.queue, prometheus.GaugeValue,
+					float64(st.Queue), proto, st.Name, st.Topic)
+				ch <- prometheus.MustNewConstMetric(c.errors, prometheus.CounterValue,
+					float64(st.Errors), proto, st.Name, st.Topic)
+				ch <- prometheus.MustNewConstMetric(c.dropped, prometheus.CounterValue,
+					float64(st.Dropped), proto, st.Name, st.Topic)
+
+				if st.Spool == nil {
+					continue
+				}
+
+				ch <- prometheus.MustNewConstMetric(c.spoolDepth, prometheus.GaugeValue,
+					float64(st.Spool.Depth), proto, st.Name, st.Topic)
+				ch <- prometheus.MustNewConstMetric(c.spoolBytes, prometheus.GaugeValue,
+					float64(st.Spool.Bytes), proto, st.Name, st.Topic)
+				ch <- prometheus.MustNewConstMetric(c.spoolDropped, prometheus.CounterValue,
+					float64(st.Spool.Dropped), proto, st.Name, st.Topic, st.Spool.Policy)
+			}
+		}
+	}
+}
+
+func (sink Sink) has(proto string) bool {
+	if len(sink.Protocols) == 0 {
+		return true
+	}
+
+	for _, p := range sink.Protocols {
+		if p == proto {
+			return true
+		}
+	}
+
+	return false
+}
+
+// enabled returns true if the sink protocol is enabled
+func (opts *Options) enabled(proto string) bool {
+	switch proto {
+	case "ipfix":
+		return opts.IPFIXEnabled
+	case "sflow":
+		return opts.SFlowEnabled
+	case "netflow5":
+		return opts.NetflowV5Enabled
+	case "netflow9":
+		return opts.NetflowV9Enabled
+	}
+
+	return false
+}
+
+func sinkProtocol(proto string) bool {
+	for _, p := range sinkProtocols {
+		if p == proto {
+			return true
+		}
+	}
+
+	return false
+}
+
+// configFile returns the file path, the relative
+// path is relative to the vflow configuration path
+func configFile(file string) string {
+	if path.IsAbs(file) {
+		return file
+	}
+
+	return path.Join(opts.VFlowConfigPath, file)
+}
@@ -0,0 +1,262 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    sink_test.go
+//: details: TODO
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/EdgeCast/vflow/producer"
+	"github.com/EdgeCast/vflow/spool"
+)
+
+func TestGetSinks(t *testing.T) {
+	o := &Options{MQName: "kafka", MQConfigFile: "mq.conf"}
+
+	sinks := o.getSinks()
+	if len(sinks) != 1 || sinks[0].Name != "default" || sinks[0].MQName != "kafka" {
+		t.Fatalf("expect the default kafka sink, got %+v", sinks)
+	}
+
+	o.Sinks = []Sink{
+		{MQName: "nats", Protocols: []string{"sflow"}},
+		{Name: "archive", MQName: "file", MQConfigFile: "file.conf", QueueSize: 10},
+	}
+
+	sinks = o.getSinks()
+	if sinks[0].Name != "nats" || sinks[0].MQConfigFile != "mq.conf" || sinks[0].QueueSize != 1000 {
+		t.Errorf("unexpected sink defaults %+v", sinks[0])
+	}
+
+	if sinks[1].MQConfigFile != "file.conf" || sinks[1].QueueSize != 10 {
+		t.Errorf("unexpected sink %+v", sinks[1])
+	}
+
+	if sinks[0].has("ipfix") || !sinks[0].has("sflow") {
+		t.Error("expect the nats sink has only sflow")
+	}
+
+	if !sinks[1].has("ipfix") || !sinks[1].has("netflow9") {
+		t.Error("expect the archive sink has all the protocols")
+	}
+}
+
+func TestSinksFanOut(t *testing.T) {
+	var (
+		ch   = make(chan producer.Message, 3)
+		fast = &sinkProducer{sink: Sink{Name: "fast"}, ch: make(chan producer.Message, 3)}
+		slow = &sinkProducer{sink: Sink{Name: "slow"}, ch: make(chan producer.Message, 1)}
+		s    = &sinks{producers: []*sinkProducer{fast, slow}}
+	)
+
+	for i := 0; i < 3; i++ {
+		ch <- producer.Message{Value: []byte{byte(i)}, Exporter: "192.0.2.1", Domain: uint64(i)}
+	}
+	close(ch)
+
+	s.fanOut(ch)
+
+	stats := s.stats()
+	if stats[0].Queue != 3 || stats[0].Dropped != 0 {
+		t.Errorf("expect 3 queued and 0 dropped, got %+v", stats[0])
+	}
+
+	if stats[1].Queue != 1 || stats[1].Dropped != 2 {
+		t.Errorf("expect 1 queued and 2 dropped, got %+v", stats[1])
+	}
+
+	if _, ok := <-slow.ch; !ok {
+		t.Error("expect the queued message")
+	}
+
+	if _, ok := <-slow.ch; ok {
+		t.Error("expect the sink channel is closed")
+	}
+
+	var n *sinks
+	if n.stats() != nil || n.errors() != 0 {
+		t.Error("expect nil sinks have no stats")
+	}
+}
+
+func TestSinksSpool(t *testing.T) {
+	q, err := spool.Open(spool.Config{Dir: t.TempDir(), MaxSize: 1 << 20})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	var (
+		ch = make(chan producer.Message)
+		sp = &sinkProducer{
+			sink:   Sink{Name: "archive"},
+			ch:     make(chan producer.Message, 1),
+			spool:  q,
+			notify: make(chan struct{}, 1),
+			done:   make(chan struct{}),
+		}
+		s = &sinks{producers: []*sinkProducer{sp}}
+	)
+
+	go s.fanOut(ch)
+
+	// the sink queue is full so the rest spill over to the spool
+	for i := 0; i < 5; i++ {
+		ch <- producer.Message{Value: []byte{byte(i)}, Exporter: "192.0.2.1", Domain: uint64(i)}
+	}
+
+	if st := s.stats()[0]; st.Spool == nil || st.Spool.Spilled == 0 {
+		t.Errorf("expect the spilled messages, got %+v", st)
+	}
+
+	go sp.replay(context.Background())
+
+	for i := 0; i < 5; i++ {
+		m := <-sp.ch
+		if m.Value[0] != byte(i) || m.Exporter != "192.0.2.1" || m.Domain != uint64(i) {
+			t.Fatalf("expect message %d, got %+v", i, m)
+		}
+	}
+
+	close(ch)
+
+	if _, ok := <-sp.ch; ok {
+		t.Error("expect the sink channel is closed")
+	}
+
+	if st := s.stats()[0]; st.Dropped != 0 || st.Spool.Depth != 0 {
+		t.Errorf("unexpected stats %+v", st)
+	}
+}
+
+type mqMock struct {
+	block   bool
+	pending bool
+	msgs    chan producer.Message
+}
+
+func (m *mqMock) Setup(configFile string, logger *log.Logger) error {
+	return nil
+}
+
+func (m *mqMock) Input(ctx context.Context, topic string, mCh chan producer.Message, ec *uint64) error {
+	if m.block {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	// the messages are buffered until the producer is canceled
+	if m.pending {
+		var n uint64
+		for {
+			select {
+			case _, ok := <-mCh:
+				if ok {
+					n++
+				} else {
+					mCh = nil
+				}
+			case <-ctx.Done():
+				atomic.AddUint64(ec, n)
+				return ctx.Err()
+			}
+		}
+	}
+
+	for msg := range mCh {
+		m.msgs <- msg
+	}
+
+	return nil
+}
+
+func (m *mqMock) Close(ctx context.Context) error {
+	close(m.msgs)
+	return nil
+}
+
+var (
+	mqMockFlush = &mqMock{msgs: make(chan producer.Message, 10)}
+	mqMockBlock = &mqMock{msgs: make(chan producer.Message, 10), block: true}
+	mqMockPend  = &mqMock{msgs: make(chan producer.Message, 10), pending: true}
+)
+
+func init() {
+	producer.Register("mock.flush", func() producer.MQueue { return mqMockFlush })
+	producer.Register("mock.block", func() producer.MQueue { return mqMockBlock })
+	producer.Register("mock.pending", func() producer.MQueue { return mqMockPend })
+}
+
+func TestSinksShutdown(t *testing.T) {
+	var (
+		buf bytes.Buffer
+		ch  = make(chan producer.Message, 10)
+		s   = &sinks{producers: []*sinkProducer{
+			{sink: Sink{Name: "flush", MQName: "mock.flush"}, topic: "vflow", ch: make(chan producer.Message, 10)},
+			{sink: Sink{Name: "block", MQName: "mock.block"}, topic: "vflow", ch: make(chan producer.Message, 10)},
+			{sink: Sink{Name: "pending", MQName: "mock.pending"}, topic: "vflow", ch: make(chan producer.Message, 10)},
+		}}
+	)
+
+	logger = log.New(&buf, "", 0)
+
+	s.start(ch)
+
+	for i := 0; i < 3; i++ {
+		ch <- producer.Message{Value: []byte{byte(i)}, Exporter: "192.0.2.1", Domain: uint64(i)}
+	}
+
+	s.mark()
+	close(ch)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	s.shutdown(ctx, "test")
+
+	n := 0
+	for range mqMockFlush.msgs {
+		n++
+	}
+
+	if n != 3 {
+		t.Error("expect 3 flushed messages, got", n)
+	}
+
+	// the blocked producer is canceled after the deadline
+	if _, ok := <-mqMockBlock.msgs; ok {
+		t.Error("expect the blocked producer is closed")
+	}
+
+	for _, line := range []string{
+		"test sink flush (vflow): flushed 3, dropped 0",
+		"test sink block (vflow): flushed 0, dropped 3",
+		"test sink pending (vflow): flushed 0, dropped 3",
+	} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("expect %q in the log:\n%s", line, buf.String())
+		}
+	}
+}
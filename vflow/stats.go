@@ -27,8 +27,10 @@ import (
 	"net"
 	"net/http"
 	"runtime"
+	"strconv"
 	"time"
 
+	"github.com/EdgeCast/vflow/sequence"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -98,15 +100,30 @@ func statsFlowHandler(protos []proto) http.HandlerFunc {
 			case *IPFIX:
 				ipfix, _ := p.(*IPFIX)
 				rd.IPFIX = ipfix.status()
+				rd.IPFIX.Sequences = ipfix.seq.Stats()
+				rd.IPFIX.Mirror = mirrorStats("ipfix")
+				rd.IPFIX.Sinks = ipfix.sinks.stats()
 			case *SFlow:
 				sflow, _ := p.(*SFlow)
 				rd.SFlow = sflow.status()
+				rd.SFlow.Sequences = sflow.seq.Stats()
+				rd.SFlow.SampleSequences = sflow.sampleSeq.Stats()
+				rd.SFlow.CounterSequences = sflow.counterSeq.Stats()
+				rd.SFlow.DiscardSequences = sflow.discardSeq.Stats()
+				rd.SFlow.Mirror = mirrorStats("sflow")
+				rd.SFlow.Sinks = append(sflow.sinks.stats(), sflow.discardSinks.stats()...)
 			case *NetflowV5:
 				netflowv5, _ := p.(*NetflowV5)
 				rd.NetflowV5 = netflowv5.status()
+				rd.NetflowV5.Sequences = netflowv5.seq.Stats()
+				rd.NetflowV5.Mirror = mirrorStats("netflow5")
+				rd.NetflowV5.Sinks = netflowv5.sinks.stats()
 			case *NetflowV9:
 				netflowv9, _ := p.(*NetflowV9)
 				rd.NetflowV9 = netflowv9.status()
+				rd.NetflowV9.Sequences = netflowv9.seq.Stats()
+				rd.NetflowV9.Mirror = mirrorStats("netflow9")
+				rd.NetflowV9.Sinks = netflowv9.sinks.stats()
 			}
 		}
 
@@ -151,13 +168,18 @@ func statsPrometheus(protos []proto) {
 	for _, p := range protos {
 		promCounterDecoded(p)
 		promCounterMQError(p)
+		promCounterMQDrop(p)
 		promCounterUDP(p)
 		promGaugeMessageQueue(p)
 		promGaugeUDPQueue(p)
 		promGaugeWorkers(p)
 		promGaugeUDPMirrorQueue(p)
+		promSequence(p)
 	}
 
+	prometheus.MustRegister(newMirrorCollector())
+	prometheus.MustRegister(newSinkCollector(protos))
+
 	logger.Println("starting prometheus http server ...")
 
 	addr := net.JoinHostPort(opts.StatsHTTPAddr, opts.StatsHTTPPort)
@@ -239,6 +261,57 @@ func promCounterMQError(p interface{}) {
 	}
 }
 
+func promCounterMQDrop(p interface{}) {
+	switch flow := p.(type) {
+	case *IPFIX:
+		promauto.NewCounterFunc(prometheus.CounterOpts{
+			Name: "vflow_ipfix_mq_dropped",
+			Help: "number of messages which couldn't be queued for the message queue",
+		},
+			func() float64 {
+				return float64(flow.status().MQDropCount)
+			})
+	case *SFlow:
+		promauto.NewCounterFunc(prometheus.CounterOpts{
+			Name: "vflow_sflow_mq_dropped",
+			Help: "number of messages which couldn't be queued for the message queue",
+		},
+			func() float64 {
+				return float64(flow.status().MQDropCount)
+			})
+		promauto.NewCounterFunc(prometheus.CounterOpts{
+			Name: "vflow_sflow_discard_mq_dropped",
+			Help: "number of discard messages which couldn't be queued for the message queue",
+		},
+			func() float64 {
+				return float64(flow.status().DiscardMQDropCount)
+			})
+		promauto.NewCounterFunc(prometheus.CounterOpts{
+			Name: "vflow_sflow_enterprise_errors",
+			Help: "number of samples and records which the registered decoders failed to decode",
+		},
+			func() float64 {
+				return float64(flow.status().EnterpriseErrors)
+			})
+	case *NetflowV5:
+		promauto.NewCounterFunc(prometheus.CounterOpts{
+			Name: "vflow_netflowv5_mq_dropped",
+			Help: "number of messages which couldn't be queued for the message queue",
+		},
+			func() float64 {
+				return float64(flow.status().MQDropCount)
+			})
+	case *NetflowV9:
+		promauto.NewCounterFunc(prometheus.CounterOpts{
+			Name: "vflow_netflowv9_mq_dropped",
+			Help: "number of messages which couldn't be queued for the message queue",
+		},
+			func() float64 {
+				return float64(flow.status().MQDropCount)
+			})
+	}
+}
+
 func promCounterUDP(p interface{}) {
 	switch flow := p.(type) {
 	case *IPFIX:
@@ -397,5 +470,98 @@ func promGaugeUDPMirrorQueue(p interface{}) {
 			func() float64 {
 				return float64(flow.status().UDPMirrorQueue)
 			})
+	case *NetflowV5:
+		promauto.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "vflow_netflowv5_udp_mirror_queue",
+			Help: "",
+		},
+			func() float64 {
+				return float64(flow.status().UDPMirrorQueue)
+			})
+	case *NetflowV9:
+		promauto.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "vflow_netflowv9_udp_mirror_queue",
+			Help: "",
+		},
+			func() float64 {
+				return float64(flow.status().UDPMirrorQueue)
+			})
+	}
+}
+
+// seqCollector exposes the sequence stats per exporter and domain
+type seqCollector struct {
+	tracker   *sequence.Tracker
+	received  *prometheus.Desc
+	lost      *prometheus.Desc
+	gaps      *prometheus.Desc
+	resets    *prometheus.Desc
+	reordered *prometheus.Desc
+	dups      *prometheus.Desc
+	drops     *prometheus.Desc
+}
+
+func newSeqCollector(prefix string, tracker *sequence.Tracker) *seqCollector {
+	labels := []string{"exporter", "domain"}
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prefix+"_"+name, help, labels, nil)
+	}
+
+	return &seqCollector{
+		tracker:   tracker,
+		received:  desc("received", "number of received packets"),
+		lost:      desc("lost", "estimated number of lost units"),
+		gaps:      desc("gaps", "number of sequence gaps"),
+		resets:    desc("resets", "number of sequence resets"),
+		reordered: desc("reordered", "number of late packets that filled a gap"),
+		dups:      desc("duplicates", "number of duplicate or unexpected late packets"),
+		drops:     desc("drops", "number of drops that the exporter reported"),
+	}
+}
+
+func (c *seqCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.received
+	ch <- c.lost
+	ch <- c.gaps
+	ch <- c.resets
+	ch <- c.reordered
+	ch <- c.dups
+	ch <- c.drops
+}
+
+func (c *seqCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, s := range c.tracker.Stats() {
+		domain := strconv.FormatUint(s.Domain, 10)
+
+		ch <- prometheus.MustNewConstMetric(c.received, prometheus.CounterValue,
+			float64(s.Received), s.Exporter, domain)
+		ch <- prometheus.MustNewConstMetric(c.lost, prometheus.GaugeValue,
+			float64(s.Lost), s.Exporter, domain)
+		ch <- prometheus.MustNewConstMetric(c.gaps, prometheus.CounterValue,
+			float64(s.Gaps), s.Exporter, domain)
+		ch <- prometheus.MustNewConstMetric(c.resets, prometheus.CounterValue,
+			float64(s.Resets), s.Exporter, domain)
+		ch <- prometheus.MustNewConstMetric(c.reordered, prometheus.CounterValue,
+			float64(s.Reordered), s.Exporter, domain)
+		ch <- prometheus.MustNewConstMetric(c.dups, prometheus.CounterValue,
+			float64(s.Duplicates), s.Exporter, domain)
+		ch <- prometheus.MustNewConstMetric(c.drops, prometheus.GaugeValue,
+			float64(s.Drops), s.Exporter, domain)
+	}
+}
+
+func promSequence(p interface{}) {
+	switch flow := p.(type) {
+	case *IPFIX:
+		prometheus.MustRegister(newSeqCollector("vflow_ipfix_sequence", flow.seq))
+	case *SFlow:
+		prometheus.MustRegister(newSeqCollector("vflow_sflow_sequence", flow.seq))
+		prometheus.MustRegister(newSeqCollector("vflow_sflow_sample_sequence", flow.sampleSeq))
+		prometheus.MustRegister(newSeqCollector("vflow_sflow_counter_sequence", flow.counterSeq))
+		prometheus.MustRegister(newSeqCollector("vflow_sflow_discard_sequence", flow.discardSeq))
+	case *NetflowV5:
+		prometheus.MustRegister(newSeqCollector("vflow_netflowv5_sequence", flow.seq))
+	case *NetflowV9:
+		prometheus.MustRegister(newSeqCollector("vflow_netflowv9_sequence", flow.seq))
 	}
 }
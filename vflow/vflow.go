@@ -24,12 +24,14 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 	"os/signal"
 	"runtime"
 	"sync"
 	"syscall"
+	"time"
 )
 
 var (
@@ -39,7 +41,7 @@ var (
 
 type proto interface {
 	run()
-	shutdown()
+	shutdown(ctx context.Context)
 }
 
 func main() {
@@ -72,13 +74,37 @@ func main() {
 
 	<-signalCh
 
+	// the protocols drain their queues and flush the
+	// message queues until the shutdown deadline
+	ctx, cancel := context.WithTimeout(context.Background(),
+		time.Duration(opts.ShutdownTimeout)*time.Second)
+	defer cancel()
+
 	for _, p := range protos {
 		wg.Add(1)
 		go func(p proto) {
 			defer wg.Done()
-			p.shutdown()
+			p.shutdown(ctx)
 		}(p)
 	}
 
 	wg.Wait()
 }
+
+// wait waits for the wait group until the context is done,
+// it returns false if the context is done first
+func wait(ctx context.Context, wg *sync.WaitGroup) bool {
+	done := make(chan struct{})
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}